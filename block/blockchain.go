@@ -2,9 +2,10 @@ package block
 
 import (
 	"crypto-blockchain/utils"
-	"crypto/ecdsa"
 	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"strings"
@@ -16,6 +17,18 @@ type Transaction struct {
 	senderAddress    string
 	recipientAddress string
 	value            float32
+	fee              float32
+	senderPublicKey  utils.Verifier
+	signature        []byte
+	multisig         *Multisig
+	inputs           []*OutPoint
+	unlockScripts    []Script
+	outputs          []*TxOutput
+	height           int
+	lockHeight       int
+	lockTime         int64
+	replaces         *[32]byte
+	chainId          string
 }
 
 type Block struct {
@@ -23,22 +36,49 @@ type Block struct {
 	previousHash [32]byte
 	timestamp    int64
 	transactions []*Transaction
+	sealer       utils.Verifier
+	signature    []byte
 }
 
 type Blockchain struct {
-	transactionPool   []*Transaction
-	chain             []*Block
-	blockchainAddress string
-	port              uint16
-	mux               sync.Mutex
+	chainId              string
+	clock                Clock
+	mempool              *Mempool
+	chain                []*Block
+	tree                 *BlockTree
+	branchStates         map[[32]byte]*UTXOSet
+	orphans              *OrphanPool
+	fetcher              BlockFetcher
+	reorgs               []*ReorgEvent
+	reorgListeners       []ReorgListener
+	blockListeners       []BlockListener
+	transactionListeners []TransactionListener
+	blockchainAddress    string
+	port                 uint16
+	mux                  sync.Mutex
+	ledgerMode           LedgerMode
+	engine               ConsensusEngine
+	finality             *FinalityGadget
+	emission             *EmissionSchedule
+	coinbaseMaturity     int
+	utxoSet              *UTXOSet
 }
 
 type TransactionRequest struct {
-	SenderAddress    *string  `json:"senderAddress"`
-	RecipientAddress *string  `json:"recipientAddress"`
-	SenderPublicKey  *string  `json:"senderPublicKey"`
-	Value            *float32 `json:"value"`
-	Signature        *string  `json:"signature"`
+	SenderAddress    *string            `json:"senderAddress"`
+	RecipientAddress *string            `json:"recipientAddress"`
+	SenderPublicKey  *string            `json:"senderPublicKey"`
+	Value            *float32           `json:"value"`
+	Fee              *float32           `json:"fee"`
+	Signature        *string            `json:"signature"`
+	KeyType          *string            `json:"keyType"`
+	Multisig         *MultisigRequest   `json:"multisig"`
+	Inputs           []*TxInputRequest  `json:"inputs"`
+	Outputs          []*TxOutputRequest `json:"outputs"`
+	LockHeight       *int               `json:"lockHeight"`
+	LockTime         *int64             `json:"lockTime"`
+	Replaces         *string            `json:"replaces"`
+	ChainId          *string            `json:"chainId"`
 }
 
 type AmountResponse struct {
@@ -50,14 +90,16 @@ const (
 	MINING_SENDER     = "BLOCKCHAIN"
 	MINING_REWARD     = 1.0
 	MINING_TIMER_SEC  = 20
+
+	MAX_TRANSACTION_OUTPUTS = 1000
 )
 
 // NewTransaction generates and returns new Transaction
 func NewTransaction(sender string, recipient string, value float32) *Transaction {
 	return &Transaction{
-		sender,
-		recipient,
-		value,
+		senderAddress:    sender,
+		recipientAddress: recipient,
+		value:            value,
 	}
 }
 
@@ -71,40 +113,194 @@ func NewBlock(nonce int, previousHash [32]byte, transactions []*Transaction) *Bl
 	}
 }
 
-// NewBlockChain starts new blockchain with init block
+// NewBlockChain starts new account-style blockchain with init block
 func NewBlockChain(blockchainAddress string, port uint16) *Blockchain {
-	initBlock := &Block{}
+	return NewBlockChainWithConfig(blockchainAddress, port, DefaultChainConfig())
+}
+
+// NewBlockChainWithLedgerMode starts new blockchain with init block,
+// keeping balances the way the LedgerMode says
+func NewBlockChainWithLedgerMode(blockchainAddress string, port uint16, ledgerMode LedgerMode) *Blockchain {
+	config := DefaultChainConfig()
+	config.LedgerMode = ledgerMode
+
+	return NewBlockChainWithConfig(blockchainAddress, port, config)
+}
+
+// NewBlockChainWithConfig starts new blockchain with the genesis block
+// of the network, following the rules of the ChainConfig
+func NewBlockChainWithConfig(blockchainAddress string, port uint16, config *ChainConfig) *Blockchain {
+	genesis := config.Genesis
+	if genesis == nil {
+		genesis = DefaultGenesis()
+	}
+
 	blockchain := new(Blockchain)
+	blockchain.chainId = genesis.chainId
+	blockchain.clock = config.Clock
+	if blockchain.clock == nil {
+		blockchain.clock = SystemClock{}
+	}
 	blockchain.blockchainAddress = blockchainAddress
-	blockchain.CreateBlock(0, initBlock.Hash())
+	blockchain.ledgerMode = config.LedgerMode
+	blockchain.engine = config.Engine
+	if blockchain.engine == nil {
+		blockchain.engine = NewProofOfWorkEngine(MINING_DIFFICULTY)
+	}
+	blockchain.emission = config.Emission
+	blockchain.coinbaseMaturity = config.CoinbaseMaturity
+	blockchain.utxoSet = NewUTXOSet()
+	blockchain.tree = NewBlockTree()
+	blockchain.branchStates = make(map[[32]byte]*UTXOSet)
+	blockchain.orphans = NewOrphanPool(MAX_ORPHAN_BLOCKS, MAX_ORPHANS_PER_SOURCE, time.Second*ORPHAN_EXPIRY_SEC)
+	blockchain.mempool = NewMempool(MEMPOOL_MAX_BYTES, MEMPOOL_MAX_TRANSACTIONS,
+		MEMPOOL_MAX_PER_SENDER, time.Second*MEMPOOL_EXPIRY_SEC)
+	// The genesis block spends nothing, so it always connects
+	blockchain.appendBlock(genesis.Block())
 	blockchain.port = port
 
+	// The genesis block is final from the start
+	if config.Finality != nil {
+		checkpoint := Checkpoint{0, blockchain.chain[0].Hash()}
+		blockchain.finality = config.Finality
+		blockchain.finality.chainId = blockchain.chainId
+		blockchain.finality.justified = checkpoint
+		blockchain.finality.finalized = checkpoint
+	}
+
 	return blockchain
 }
 
 func (transaction *Transaction) MarshalJSON() ([]byte, error) {
+	var senderPublicKey, keyType, signature string
+	if transaction.senderPublicKey != nil {
+		senderPublicKey = transaction.senderPublicKey.String()
+		keyType = string(transaction.senderPublicKey.KeyType())
+	}
+	if transaction.signature != nil {
+		signature = fmt.Sprintf("%x", transaction.signature)
+	}
+	replaces := transaction.replacesStr()
+	var unlockScripts []string
+	for _, unlockScript := range transaction.unlockScripts {
+		unlockScripts = append(unlockScripts, hex.EncodeToString(unlockScript))
+	}
+
 	return json.Marshal(struct {
-		SenderAddress    string  `json:"senderAddress"`
-		RecipientAddress string  `json:"recipientAddress"`
-		Value            float32 `json:"value"`
+		Id               string      `json:"id"`
+		SenderAddress    string      `json:"senderAddress"`
+		RecipientAddress string      `json:"recipientAddress"`
+		Value            float32     `json:"value"`
+		Fee              float32     `json:"fee,omitempty"`
+		SenderPublicKey  string      `json:"senderPublicKey,omitempty"`
+		KeyType          string      `json:"keyType,omitempty"`
+		Signature        string      `json:"signature,omitempty"`
+		Multisig         *Multisig   `json:"multisig,omitempty"`
+		Inputs           []*OutPoint `json:"inputs,omitempty"`
+		UnlockScripts    []string    `json:"unlockScripts,omitempty"`
+		Outputs          []*TxOutput `json:"outputs,omitempty"`
+		Height           int         `json:"height,omitempty"`
+		LockHeight       int         `json:"lockHeight,omitempty"`
+		LockTime         int64       `json:"lockTime,omitempty"`
+		Replaces         string      `json:"replaces,omitempty"`
+		ChainId          string      `json:"chainId,omitempty"`
 	}{
+		Id:               fmt.Sprintf("%x", transaction.Hash()),
 		SenderAddress:    transaction.senderAddress,
 		RecipientAddress: transaction.recipientAddress,
 		Value:            transaction.value,
+		Fee:              transaction.fee,
+		SenderPublicKey:  senderPublicKey,
+		KeyType:          keyType,
+		Signature:        signature,
+		Multisig:         transaction.multisig,
+		Inputs:           transaction.inputs,
+		UnlockScripts:    unlockScripts,
+		Outputs:          transaction.outputs,
+		Height:           transaction.height,
+		LockHeight:       transaction.lockHeight,
+		LockTime:         transaction.lockTime,
+		Replaces:         replaces,
+		ChainId:          transaction.chainId,
 	})
 }
 
+// SigningHash calculates the hash of the fields covered by the
+// sender's signature. It must match the hash the wallet signs.
+// Unlock scripts carry signatures themselves, so they are left out
+func (transaction *Transaction) SigningHash() [32]byte {
+	replaces := transaction.replacesStr()
+	marshal, _ := json.Marshal(struct {
+		SenderAddress    string      `json:"senderAddress"`
+		RecipientAddress string      `json:"recipientAddress"`
+		Value            float32     `json:"value"`
+		Fee              float32     `json:"fee,omitempty"`
+		Inputs           []*OutPoint `json:"inputs,omitempty"`
+		Outputs          []*TxOutput `json:"outputs,omitempty"`
+		Height           int         `json:"height,omitempty"`
+		LockHeight       int         `json:"lockHeight,omitempty"`
+		LockTime         int64       `json:"lockTime,omitempty"`
+		Replaces         string      `json:"replaces,omitempty"`
+		ChainId          string      `json:"chainId,omitempty"`
+	}{
+		SenderAddress:    transaction.senderAddress,
+		RecipientAddress: transaction.recipientAddress,
+		Value:            transaction.value,
+		Fee:              transaction.fee,
+		Inputs:           transaction.inputs,
+		Outputs:          transaction.outputs,
+		Height:           transaction.height,
+		LockHeight:       transaction.lockHeight,
+		LockTime:         transaction.lockTime,
+		Replaces:         replaces,
+		ChainId:          transaction.chainId,
+	})
+
+	return sha256.Sum256(marshal)
+}
+
+// Hash calculates the transaction ID from the signed fields and the
+// signature. Signatures are deterministic and canonical, so a transaction
+// keeps the same ID no matter who relays it. Unlock scripts are left out,
+// like segregated witnesses: the signatures they carry can't cover them,
+// so a relayer could re-encode them. The Block hash still commits to them.
+// Multisig signatures are left out the same way: any threshold of the
+// members authorises the Transaction, so a relayer could drop or swap some
+func (transaction *Transaction) Hash() [32]byte {
+	signingHash := transaction.SigningHash()
+	if transaction.multisig != nil {
+		return sha256.Sum256(signingHash[:])
+	}
+
+	return sha256.Sum256(append(signingHash[:], transaction.signature...))
+}
+
 func (block *Block) MarshalJSON() ([]byte, error) {
+	var sealer, sealerKeyType, signature string
+	if block.sealer != nil {
+		sealer = block.sealer.String()
+		sealerKeyType = string(block.sealer.KeyType())
+	}
+	if block.signature != nil {
+		signature = fmt.Sprintf("%x", block.signature)
+	}
+
 	return json.Marshal(struct {
-		Timestamp    int64          `json:"timestamp"`
-		Nonce        int            `json:"nonce"`
-		PreviousHash string         `json:"previousHash"`
-		Transactions []*Transaction `json:"transactions"`
+		Timestamp     int64          `json:"timestamp"`
+		Nonce         int            `json:"nonce"`
+		PreviousHash  string         `json:"previousHash"`
+		Transactions  []*Transaction `json:"transactions"`
+		Sealer        string         `json:"sealer,omitempty"`
+		SealerKeyType string         `json:"sealerKeyType,omitempty"`
+		Signature     string         `json:"signature,omitempty"`
 	}{
-		Timestamp:    block.timestamp,
-		Nonce:        block.nonce,
-		PreviousHash: fmt.Sprintf("%x", block.previousHash),
-		Transactions: block.transactions,
+		Timestamp:     block.timestamp,
+		Nonce:         block.nonce,
+		PreviousHash:  fmt.Sprintf("%x", block.previousHash),
+		Transactions:  block.transactions,
+		Sealer:        sealer,
+		SealerKeyType: sealerKeyType,
+		Signature:     signature,
 	})
 }
 
@@ -131,15 +327,230 @@ func (block *Block) Hash() [32]byte {
 	return sha256.Sum256([]byte(marshal))
 }
 
-// CreateBlock appends new Block to Blockchain
-func (blockchain *Blockchain) CreateBlock(nonce int, previousHash [32]byte) *Block {
-	block := NewBlock(nonce, previousHash, blockchain.transactionPool)
+// Transactions returns the transactions of the Block, coinbase first
+func (block *Block) Transactions() []*Transaction {
+	return block.transactions
+}
+
+// UnmarshalJSON decodes a Block relayed by another node
+func (block *Block) UnmarshalJSON(data []byte) error {
+	var decoded struct {
+		Timestamp     int64          `json:"timestamp"`
+		Nonce         int            `json:"nonce"`
+		PreviousHash  string         `json:"previousHash"`
+		Transactions  []*Transaction `json:"transactions"`
+		Sealer        string         `json:"sealer"`
+		SealerKeyType string         `json:"sealerKeyType"`
+		Signature     string         `json:"signature"`
+	}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return err
+	}
+
+	previousHash, err := decodeBlockHash(decoded.PreviousHash)
+	if err != nil {
+		return err
+	}
+
+	*block = Block{
+		nonce:        decoded.Nonce,
+		previousHash: *previousHash,
+		timestamp:    decoded.Timestamp,
+		transactions: decoded.Transactions,
+	}
+	if block.transactions == nil {
+		block.transactions = []*Transaction{}
+	}
+
+	if decoded.Sealer != "" {
+		keyType, err := utils.ParseKeyType(decoded.SealerKeyType)
+		if err != nil {
+			return err
+		}
+		if block.sealer, err = utils.VerifierFromString(keyType, decoded.Sealer); err != nil {
+			return err
+		}
+	}
+	if decoded.Signature != "" {
+		if block.signature, err = hex.DecodeString(decoded.Signature); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// UnmarshalJSON decodes a Transaction of a relayed Block. The ID it
+// carries must match the one calculated from the decoded fields
+func (transaction *Transaction) UnmarshalJSON(data []byte) error {
+	var decoded struct {
+		Id               string             `json:"id"`
+		SenderAddress    string             `json:"senderAddress"`
+		RecipientAddress string             `json:"recipientAddress"`
+		Value            float32            `json:"value"`
+		Fee              float32            `json:"fee"`
+		SenderPublicKey  string             `json:"senderPublicKey"`
+		KeyType          string             `json:"keyType"`
+		Signature        string             `json:"signature"`
+		Multisig         *MultisigRequest   `json:"multisig"`
+		Inputs           []*TxInputRequest  `json:"inputs"`
+		UnlockScripts    []string           `json:"unlockScripts"`
+		Outputs          []*TxOutputRequest `json:"outputs"`
+		Height           int                `json:"height"`
+		LockHeight       int                `json:"lockHeight"`
+		LockTime         int64              `json:"lockTime"`
+		Replaces         string             `json:"replaces"`
+		ChainId          string             `json:"chainId"`
+	}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return err
+	}
+
+	*transaction = Transaction{
+		senderAddress:    decoded.SenderAddress,
+		recipientAddress: decoded.RecipientAddress,
+		value:            decoded.Value,
+		fee:              decoded.Fee,
+		height:           decoded.Height,
+		lockHeight:       decoded.LockHeight,
+		lockTime:         decoded.LockTime,
+		chainId:          decoded.ChainId,
+	}
+
+	var err error
+	if decoded.SenderPublicKey != "" {
+		keyType, err := utils.ParseKeyType(decoded.KeyType)
+		if err != nil {
+			return err
+		}
+		if transaction.senderPublicKey, err = utils.VerifierFromString(keyType, decoded.SenderPublicKey); err != nil {
+			return err
+		}
+	}
+	if decoded.Signature != "" {
+		if transaction.signature, err = hex.DecodeString(decoded.Signature); err != nil {
+			return err
+		}
+	}
+	if decoded.Multisig != nil {
+		if !decoded.Multisig.Validate() {
+			return errors.New("multisig needs a threshold and a public key for every signer")
+		}
+		if transaction.multisig, err = decoded.Multisig.Multisig(); err != nil {
+			return err
+		}
+	}
+	if decoded.Replaces != "" {
+		if transaction.replaces, err = decodeTransactionId(decoded.Replaces); err != nil {
+			return err
+		}
+	}
+
+	for _, inputRequest := range decoded.Inputs {
+		input, err := inputRequest.OutPoint()
+		if err != nil {
+			return err
+		}
+		transaction.inputs = append(transaction.inputs, input)
+	}
+	if len(decoded.UnlockScripts) > 0 && len(decoded.UnlockScripts) != len(decoded.Inputs) {
+		return errors.New("every input needs an unlock script entry")
+	}
+	for _, unlockScript := range decoded.UnlockScripts {
+		script, err := hex.DecodeString(unlockScript)
+		if err != nil {
+			return fmt.Errorf("invalid unlock script %q", unlockScript)
+		}
+		if len(script) == 0 {
+			script = nil
+		}
+		transaction.unlockScripts = append(transaction.unlockScripts, script)
+	}
+	for _, outputRequest := range decoded.Outputs {
+		output, err := outputRequest.TxOutput()
+		if err != nil {
+			return err
+		}
+		transaction.outputs = append(transaction.outputs, output)
+	}
+
+	if id := fmt.Sprintf("%x", transaction.Hash()); decoded.Id != "" && decoded.Id != id {
+		return fmt.Errorf("transaction ID %s does not match %s", decoded.Id, id)
+	}
+
+	return nil
+}
+
+// SealHash calculates the hash of the Block without its signature,
+// which is what the sealer signs
+func (block *Block) SealHash() [32]byte {
+	unsigned := *block
+	unsigned.signature = nil
+
+	return unsigned.Hash()
+}
+
+// CreateBlock appends new Block with the transactions to Blockchain
+func (blockchain *Blockchain) CreateBlock(
+	nonce int,
+	previousHash [32]byte,
+	transactions []*Transaction,
+) *Block {
+	block := NewBlock(nonce, previousHash, transactions)
+	if err := blockchain.appendBlock(block); err != nil {
+		log.Printf("ERROR Appending block: %v", err)
+		return nil
+	}
+
+	return block
+}
+
+// appendBlock appends the Block to Blockchain and drops its
+// transactions and the transactions conflicting with them from mempool.
+// A Block that can't be connected leaves the chain as it was
+func (blockchain *Blockchain) appendBlock(block *Block) error {
+	if _, err := blockchain.tree.add(block); err != nil {
+		return err
+	}
+
+	if blockchain.ledgerMode == LEDGER_MODE_UTXO {
+		if err := blockchain.utxoSet.connectBlock(block, len(blockchain.chain)); err != nil {
+			return err
+		}
+	}
+
 	blockchain.chain = append(blockchain.chain, block)
-	blockchain.transactionPool = []*Transaction{}
+	blockchain.mempool.RemoveBlock(block)
+
+	if blockchain.finality != nil {
+		blockchain.updateFinality()
+	}
+
+	blockchain.notifyBlock(block, len(blockchain.chain)-1)
+	return nil
+}
+
+// disconnectTip removes the last Block from Blockchain when it gets
+// orphaned, restoring the ledger state it had changed. The Block stays
+// in the BlockTree. Callers make sure it is not finalized
+func (blockchain *Blockchain) disconnectTip() *Block {
+	block := blockchain.LastBlock()
+	blockchain.chain = blockchain.chain[:len(blockchain.chain)-1]
+
+	if blockchain.ledgerMode == LEDGER_MODE_UTXO {
+		blockchain.utxoSet.disconnectBlock(block)
+	}
 
 	return block
 }
 
+// IsFinal checks whether the Transaction may be included into a Block
+// at the height with the timestamp, both locks have to be reached
+func (transaction *Transaction) IsFinal(height int, timestamp int64) bool {
+	return transaction.lockHeight <= height &&
+		transaction.lockTime <= time.Unix(0, timestamp).Unix()
+}
+
 // LastBlock returns the last Block from the Blockchain
 func (blockchain *Blockchain) LastBlock() *Block {
 	return blockchain.chain[len(blockchain.chain)-1]
@@ -149,9 +560,12 @@ func (blockchain *Blockchain) CreateTransaction(
 	sender string,
 	recipient string,
 	value float32,
-	senderPublicKey *ecdsa.PublicKey,
-	signature *utils.Signature,
+	senderPublicKey utils.Verifier,
+	signature []byte,
 ) bool {
+	blockchain.mux.Lock()
+	defer blockchain.mux.Unlock()
+
 	isTransacted := blockchain.AddTransaction(sender, recipient, value, senderPublicKey, signature)
 
 	// TODO: Add sync
@@ -159,125 +573,419 @@ func (blockchain *Blockchain) CreateTransaction(
 	return isTransacted
 }
 
-// AddTransaction appends new Transaction to transaction pool
+// SubmitTransaction adds a Transaction decoded from a TransactionRequest,
+// failing with an Error that tells why it was rejected
+func (blockchain *Blockchain) SubmitTransaction(transaction *Transaction) error {
+	blockchain.mux.Lock()
+	defer blockchain.mux.Unlock()
+
+	err := blockchain.addTransaction(transaction)
+
+	// TODO: Add sync
+
+	return err
+}
+
+// AddTransaction appends new Transaction of this network to transaction
+// pool, the signature has to cover the chain ID of the Blockchain
 func (blockchain *Blockchain) AddTransaction(
 	sender string,
 	recipient string,
 	value float32,
-	senderPublicKey *ecdsa.PublicKey,
-	signature *utils.Signature,
+	senderPublicKey utils.Verifier,
+	signature []byte,
 ) bool {
 	transaction := NewTransaction(sender, recipient, value)
+	transaction.chainId = blockchain.chainId
+	transaction.senderPublicKey = senderPublicKey
+	transaction.signature = signature
 
-	if sender == MINING_SENDER {
-		blockchain.transactionPool = append(blockchain.transactionPool, transaction)
-		return true
+	if err := blockchain.addTransaction(transaction); err != nil {
+		log.Printf("ERROR Validating transaction: %v", err)
+		return false
 	}
 
-	if blockchain.VerifyTransactionSignature(senderPublicKey, signature, transaction) {
-		blockchain.transactionPool = append(blockchain.transactionPool, transaction)
-		return true
+	return true
+}
+
+// addTransaction verifies that the Transaction is authorised by
+// the sender and adds it to mempool. A coinbase is only ever created
+// by Mining and put straight into the Block, so it is never accepted
+func (blockchain *Blockchain) addTransaction(transaction *Transaction) error {
+	if transaction.IsCoinbase() {
+		return NewError(ERROR_INVALID_TRANSACTION, "coinbase transactions are created by the miner only")
+	}
+
+	// Signatures cover the chain ID, so transactions of
+	// other networks can't be replayed here
+	if transaction.chainId != blockchain.chainId {
+		return Errorf(ERROR_WRONG_CHAIN, "transaction is for chain %q instead of %q", transaction.chainId, blockchain.chainId)
+	}
+
+	if transaction.replaces != nil {
+		return blockchain.replaceTransaction(transaction)
+	}
+
+	if err := blockchain.verifyTransaction(blockchain.tipState(), transaction); err != nil {
+		return err
+	}
+
+	if err := blockchain.mempool.Add(transaction, blockchain.now()); err != nil {
+		return err
 	}
 
-	log.Println("ERROR Validating transaction")
-	return false
+	blockchain.notifyTransaction(transaction)
+	return nil
 }
 
-// VerifyTransactionSignature verifies the signature in r, s
-// of hash using the senderPublicKey. Its return true
-// whether the signature is valid
+// verifyLedger checks that the shape of the Transaction matches the
+// LedgerMode and that the ledgerState covers what it spends
+func (blockchain *Blockchain) verifyLedger(state *ledgerState, transaction *Transaction) error {
+	if err := verifyFee(transaction.fee); err != nil {
+		return err
+	}
+
+	if blockchain.ledgerMode == LEDGER_MODE_UTXO {
+		return blockchain.verifyUTXOTransaction(state, transaction)
+	}
+
+	if len(transaction.inputs) > 0 {
+		return errors.New("inputs need the UTXO ledger mode")
+	}
+
+	// A batch payment is accepted or rejected as a whole,
+	// all of its outputs have to be covered by the sender's balance
+	if err := verifyOutputs(transaction.Outputs()); err != nil {
+		return err
+	}
+
+	available := blockchain.availableAmount(state, transaction.senderAddress)
+	if value := transaction.Cost(); value > available {
+		return Errorf(ERROR_INSUFFICIENT_FUNDS, "insufficient funds: %.8f available, %.8f needed", available, value)
+	}
+
+	return nil
+}
+
+// verifyOutputs checks that there are outputs, that there are not
+// too many of them and that every one pays a positive value
+func verifyOutputs(outputs []*TxOutput) error {
+	if len(outputs) == 0 {
+		return errors.New("transaction has no outputs")
+	}
+	if len(outputs) > MAX_TRANSACTION_OUTPUTS {
+		return fmt.Errorf("transaction has more than %d outputs", MAX_TRANSACTION_OUTPUTS)
+	}
+
+	for _, output := range outputs {
+		if output.value <= 0 {
+			return errors.New("output value must be positive")
+		}
+	}
+
+	return nil
+}
+
+// verifyFee checks that the fee is neither negative nor NaN
+func verifyFee(fee float32) error {
+	if !(fee >= 0) {
+		return errors.New("fee must not be negative")
+	}
+
+	return nil
+}
+
+// Cost returns what the Transaction takes from the sender,
+// the value of all outputs plus the fee
+func (transaction *Transaction) Cost() float32 {
+	return transaction.TotalValue() + transaction.fee
+}
+
+// Fee returns the fee the Transaction pays to the miner
+func (transaction *Transaction) Fee() float32 {
+	return transaction.fee
+}
+
+// TotalValue returns the sum of all outputs of the Transaction
+func (transaction *Transaction) TotalValue() float32 {
+	var totalValue float32
+	for _, output := range transaction.Outputs() {
+		totalValue += output.value
+	}
+
+	return totalValue
+}
+
+// verifyAuthorisation checks that the keys of the Transaction derive
+// the sender address and that enough of them signed it
+func (blockchain *Blockchain) verifyAuthorisation(transaction *Transaction) bool {
+	if transaction.multisig != nil {
+		return blockchain.VerifyMultisigSignatures(transaction.multisig, transaction)
+	}
+
+	if transaction.senderPublicKey == nil ||
+		utils.AddressFromPublicKey(transaction.senderPublicKey) != transaction.senderAddress {
+		return false
+	}
+
+	return blockchain.VerifyTransactionSignature(transaction.senderPublicKey, transaction.signature, transaction)
+}
+
+// VerifyTransactionSignature verifies the signature of hash
+// using the senderPublicKey of any supported KeyType.
+// Its return true whether the signature is valid
 func (blockchain *Blockchain) VerifyTransactionSignature(
-	senderPublicKey *ecdsa.PublicKey,
-	signature *utils.Signature,
+	senderPublicKey utils.Verifier,
+	signature []byte,
 	transaction *Transaction,
 ) bool {
-	marshal, _ := json.Marshal(transaction)
-	hash := sha256.Sum256([]byte(marshal))
+	hash := transaction.SigningHash()
 
-	return ecdsa.Verify(senderPublicKey, hash[:], signature.R, signature.S)
+	return senderPublicKey.Verify(hash[:], signature)
 }
 
 // CopyTransactionPool returns current transaction pool
 func (blockchain *Blockchain) CopyTransactionPool() []*Transaction {
+	blockchain.mux.Lock()
+	defer blockchain.mux.Unlock()
+
 	transactions := make([]*Transaction, 0)
-	for _, transaction := range blockchain.transactionPool {
-		transactions = append(transactions, NewTransaction(
-			transaction.senderAddress,
-			transaction.recipientAddress,
-			transaction.value,
-		))
+	for _, transaction := range blockchain.mempool.Transactions() {
+		copied := *transaction
+		transactions = append(transactions, &copied)
 	}
 
 	return transactions
 }
 
-// ValidProof checks whether first three numbers in nonce are zeros
-func (blockchain *Blockchain) ValidProof(
-	nonce int,
-	previousHash [32]byte,
-	transactions []*Transaction,
-	difficulty int,
-) bool {
-	zeros := strings.Repeat("0", difficulty)
+// Mining creates new block in the Blockchain, sealed the way the
+// ConsensusEngine says. It fails when this node may not create the block
+func (blockchain *Blockchain) Mining() bool {
+	blockchain.mux.Lock()
+	defer blockchain.mux.Unlock()
 
-	guessBlock := Block{nonce, previousHash, 0, transactions}
-	guessHashStr := fmt.Sprintf("%x", guessBlock.Hash())
+	if _, err := blockchain.mine(blockchain.blockchainAddress); err != nil {
+		log.Printf("Not mining: %v", err)
+		return false
+	}
 
-	return guessHashStr[:difficulty] == zeros
+	return true
 }
 
-// ProofOfWork iterates through the nonce set until the nonce is correct,
-// and returns it. Correct nonce = nonce which starts from three zeros
-func (blockchain *Blockchain) ProofOfWork() int {
-	transactions := blockchain.CopyTransactionPool()
-	previousHash := blockchain.LastBlock().Hash()
+// mine creates new block paying the coinbase to the address
+func (blockchain *Blockchain) mine(address string) (*Block, error) {
+	height := len(blockchain.chain)
+	now := blockchain.now()
+	timestamp := nextTimestamp(blockchain.chain, now)
+	blockchain.mempool.Expire(now)
+	transactions := blockchain.mempool.Select(height, timestamp, MAX_BLOCK_TRANSACTIONS)
+
+	// Senders can only spend what they have, so the mining reward is the
+	// only source of coins and blocks are mined even without pending
+	// transactions. The miner also collects the fees of the block
+	var fees float32
+	for _, transaction := range transactions {
+		fees += transaction.fee
+	}
+	subsidy := blockchain.emission.Subsidy(height)
+	coinbase := NewTransaction(MINING_SENDER, address, subsidy+fees)
+	coinbase.height = height
+	transactions = append([]*Transaction{coinbase}, transactions...)
 
-	// While nonce is not correct, we will continue
-	nonce := 0
-	for !blockchain.ValidProof(nonce, previousHash, transactions, MINING_DIFFICULTY) {
-		nonce += 1
+	block := NewBlock(0, blockchain.LastBlock().Hash(), transactions)
+	block.timestamp = timestamp
+	if err := blockchain.engine.Prepare(blockchain.chain, block); err != nil {
+		return nil, err
+	}
+	if err := blockchain.engine.Seal(blockchain.chain, block); err != nil {
+		return nil, fmt.Errorf("sealing block: %w", err)
 	}
 
-	return nonce
+	if err := blockchain.appendBlock(block); err != nil {
+		return nil, fmt.Errorf("appending block: %w", err)
+	}
+	return block, nil
 }
 
-// Mining creates new block in the Blockchain
-func (blockchain *Blockchain) Mining() bool {
-	blockchain.mux.Lock()
-	defer blockchain.mux.Unlock()
+func (blockchain *Blockchain) StartMining() {
+	blockchain.Mining()
+	_ = time.AfterFunc(time.Second*MINING_TIMER_SEC, blockchain.StartMining)
+}
 
-	if len(blockchain.transactionPool) == 0 {
+// ValidChain checks that every Block links to the previous one,
+// is sealed by the rules of the ConsensusEngine and only includes
+// transactions that were already unlocked at its height and time,
+// and that are valid on top of the blocks before it
+func (blockchain *Blockchain) ValidChain(chain []*Block) bool {
+	if len(chain) == 0 || chain[0].Hash() != blockchain.chain[0].Hash() {
+		log.Println("ERROR Chain starts from the genesis block of another network")
 		return false
 	}
 
-	blockchain.AddTransaction(MINING_SENDER, blockchain.blockchainAddress, MINING_REWARD, nil, nil)
+	utxoSet := NewUTXOSet()
+	if err := utxoSet.connectBlock(chain[0], 0); err != nil {
+		log.Printf("ERROR Genesis block is invalid: %v", err)
+		return false
+	}
+
+	for height := 1; height < len(chain); height++ {
+		block := chain[height]
+
+		if block.previousHash != chain[height-1].Hash() {
+			log.Printf("ERROR Block %d does not link to the previous block", height)
+			return false
+		}
 
-	nonce := blockchain.ProofOfWork()
-	previousHash := blockchain.LastBlock().Hash()
+		if err := blockchain.validateTimestamp(chain[:height], block); err != nil {
+			log.Printf("ERROR Block %d is invalid: %v", height, err)
+			return false
+		}
+
+		if err := blockchain.engine.VerifySeal(chain[:height], block); err != nil {
+			log.Printf("ERROR Block %d has an invalid seal: %v", height, err)
+			return false
+		}
+
+		if err := blockchain.validateBlock(block, height); err != nil {
+			log.Printf("ERROR Block %d is invalid: %v", height, err)
+			return false
+		}
+
+		state := &ledgerState{chain: chain[:height], utxoSet: utxoSet, pending: newBlockSpends()}
+		if err := blockchain.verifyBlockTransactions(state, block); err != nil {
+			log.Printf("ERROR Block %d is invalid: %v", height, err)
+			return false
+		}
+		if err := utxoSet.connectBlock(block, height); err != nil {
+			log.Printf("ERROR Block %d is invalid: %v", height, err)
+			return false
+		}
+	}
 
-	blockchain.CreateBlock(nonce, previousHash)
 	return true
 }
 
-func (blockchain *Blockchain) StartMining() {
-	blockchain.Mining()
-	_ = time.AfterFunc(time.Second*MINING_TIMER_SEC, blockchain.StartMining)
+// validateBlock checks the transactions of the Block at the height.
+// The Block starts with exactly one coinbase, which pays no more than
+// the subsidy and the fees
+func (blockchain *Blockchain) validateBlock(block *Block, height int) error {
+	if err := validateCoinbase(block, height); err != nil {
+		return err
+	}
+
+	var fees, minted float32
+	for _, transaction := range block.transactions {
+		if !transaction.IsFinal(height, block.timestamp) {
+			return fmt.Errorf("transaction %x is locked until height %d, time %d",
+				transaction.Hash(), transaction.lockHeight, transaction.lockTime)
+		}
+
+		if transaction.IsCoinbase() {
+			minted += transaction.TotalValue()
+			continue
+		}
+
+		if transaction.chainId != blockchain.chainId {
+			return fmt.Errorf("transaction %x is for chain %q", transaction.Hash(), transaction.chainId)
+		}
+		fees += transaction.fee
+	}
+
+	if allowed := blockchain.emission.Subsidy(height) + fees; minted > allowed {
+		return fmt.Errorf("coinbase pays %.8f, more than the allowed %.8f", minted, allowed)
+	}
+
+	return nil
+}
+
+// validateCoinbase checks that the first Transaction of the Block is
+// the only coinbase, that it is built for the height and that it
+// carries nothing but the reward
+func validateCoinbase(block *Block, height int) error {
+	if len(block.transactions) == 0 || !block.transactions[0].IsCoinbase() {
+		return errors.New("block does not start with a coinbase")
+	}
+
+	for _, transaction := range block.transactions[1:] {
+		if transaction.IsCoinbase() {
+			return errors.New("block has more than one coinbase")
+		}
+	}
+
+	coinbase := block.transactions[0]
+	if coinbase.height != height {
+		return fmt.Errorf("coinbase is built for height %d", coinbase.height)
+	}
+	if coinbase.senderPublicKey != nil || coinbase.signature != nil || coinbase.multisig != nil ||
+		len(coinbase.inputs) > 0 || len(coinbase.outputs) > 0 || coinbase.fee != 0 ||
+		coinbase.replaces != nil {
+		return errors.New("coinbase carries more than the reward")
+	}
+
+	return nil
+}
+
+// IsCoinbase tells whether the Transaction mints the block reward
+func (transaction *Transaction) IsCoinbase() bool {
+	return transaction.senderAddress == MINING_SENDER
+}
+
+// isMature tells whether the outputs of the coinbase at the height
+// may be spent by a Transaction in the next Block of the ledgerState
+func (blockchain *Blockchain) isMature(state *ledgerState, coinbaseHeight int) bool {
+	return len(state.chain)-coinbaseHeight >= blockchain.coinbaseMaturity
+}
+
+// immatureAmount returns the coins paid to the address by coinbases
+// that may not be spent yet
+func (blockchain *Blockchain) immatureAmount(state *ledgerState, blockchainAddress string) float32 {
+	var immatureAmount float32
+	for height := len(state.chain) - 1; height > 0 && !blockchain.isMature(state, height); height-- {
+		for _, transaction := range state.chain[height].transactions {
+			if !transaction.IsCoinbase() {
+				continue
+			}
+
+			for _, output := range transaction.Outputs() {
+				if output.address == blockchainAddress {
+					immatureAmount += output.value
+				}
+			}
+		}
+	}
+
+	return immatureAmount
 }
 
 // CalculateTotalAmount iterates through all transactions in the Blockchain
 // and returns total amount of user's coins
 func (blockchain *Blockchain) CalculateTotalAmount(blockchainAddress string) float32 {
+	blockchain.mux.Lock()
+	defer blockchain.mux.Unlock()
+
+	return blockchain.calculateTotalAmount(blockchain.tipState(), blockchainAddress)
+}
+
+func (blockchain *Blockchain) calculateTotalAmount(state *ledgerState, blockchainAddress string) float32 {
 	var totalAmount float32 = 0.0
-	for _, block := range blockchain.chain {
-		for _, transaction := range block.transactions {
-			value := transaction.value
+	if blockchain.ledgerMode == LEDGER_MODE_UTXO {
+		for _, utxo := range state.utxoSet.FindByAddress(blockchainAddress) {
+			totalAmount += utxo.output.value
+		}
+
+		return totalAmount
+	}
 
-			if blockchainAddress == transaction.recipientAddress {
-				totalAmount += value
+	for _, block := range state.chain {
+		for _, transaction := range block.transactions {
+			for _, output := range transaction.Outputs() {
+				if blockchainAddress == output.address {
+					totalAmount += output.value
+				}
 			}
 
 			if blockchainAddress == transaction.senderAddress {
-				totalAmount -= value
+				totalAmount -= transaction.Cost()
 			}
 		}
 	}
@@ -285,12 +993,167 @@ func (blockchain *Blockchain) CalculateTotalAmount(blockchainAddress string) flo
 	return totalAmount
 }
 
-// Validate checks that all fields are not nil
+// AvailableAmount returns the confirmed amount of user's coins minus
+// immature coinbase rewards and what the user's pending transactions
+// already spend
+func (blockchain *Blockchain) AvailableAmount(blockchainAddress string) float32 {
+	blockchain.mux.Lock()
+	defer blockchain.mux.Unlock()
+
+	return blockchain.availableAmount(blockchain.tipState(), blockchainAddress)
+}
+
+func (blockchain *Blockchain) availableAmount(state *ledgerState, blockchainAddress string) float32 {
+	return blockchain.calculateTotalAmount(state, blockchainAddress) -
+		blockchain.immatureAmount(state, blockchainAddress) -
+		state.pending.Spent(blockchainAddress)
+}
+
+// Balance returns the total and the available amount of user's coins,
+// both calculated from the same state of the Blockchain
+func (blockchain *Blockchain) Balance(blockchainAddress string) (float32, float32) {
+	blockchain.mux.Lock()
+	defer blockchain.mux.Unlock()
+
+	state := blockchain.tipState()
+	return blockchain.calculateTotalAmount(state, blockchainAddress), blockchain.availableAmount(state, blockchainAddress)
+}
+
+// Transaction decodes the keys, signatures, inputs and outputs of
+// the request into a Transaction. The request has to be validated first
+func (transactionRequest *TransactionRequest) Transaction() (*Transaction, error) {
+	transaction := NewTransaction(*transactionRequest.SenderAddress, "", 0)
+	if transactionRequest.RecipientAddress != nil {
+		transaction.recipientAddress = *transactionRequest.RecipientAddress
+	}
+	if transactionRequest.Value != nil {
+		transaction.value = *transactionRequest.Value
+	}
+	if transactionRequest.Fee != nil {
+		transaction.fee = *transactionRequest.Fee
+	}
+	if transactionRequest.LockHeight != nil {
+		transaction.lockHeight = *transactionRequest.LockHeight
+	}
+	if transactionRequest.LockTime != nil {
+		transaction.lockTime = *transactionRequest.LockTime
+	}
+	if transactionRequest.ChainId != nil {
+		transaction.chainId = *transactionRequest.ChainId
+	}
+	if transactionRequest.Replaces != nil {
+		replaces, err := decodeTransactionId(*transactionRequest.Replaces)
+		if err != nil {
+			return nil, WrapError(ERROR_INVALID_REQUEST, err)
+		}
+		transaction.replaces = replaces
+	}
+
+	hasUnlockScripts := false
+	for _, inputRequest := range transactionRequest.Inputs {
+		input, err := inputRequest.OutPoint()
+		if err != nil {
+			return nil, WrapError(ERROR_INVALID_REQUEST, err)
+		}
+		unlockScript, err := inputRequest.Script()
+		if err != nil {
+			return nil, WrapError(ERROR_INVALID_REQUEST, err)
+		}
+		transaction.inputs = append(transaction.inputs, input)
+		transaction.unlockScripts = append(transaction.unlockScripts, unlockScript)
+		hasUnlockScripts = hasUnlockScripts || unlockScript != nil
+	}
+	if !hasUnlockScripts {
+		transaction.unlockScripts = nil
+	}
+
+	for _, outputRequest := range transactionRequest.Outputs {
+		output, err := outputRequest.TxOutput()
+		if err != nil {
+			return nil, WrapError(ERROR_INVALID_REQUEST, err)
+		}
+		transaction.outputs = append(transaction.outputs, output)
+	}
+
+	if transactionRequest.Multisig != nil {
+		multisig, err := transactionRequest.Multisig.Multisig()
+		if err != nil {
+			return nil, WrapError(ERROR_INVALID_REQUEST, err)
+		}
+		transaction.multisig = multisig
+
+		return transaction, nil
+	}
+
+	if transactionRequest.SenderPublicKey == nil {
+		return transaction, nil
+	}
+
+	keyType, err := transactionRequest.KeyTypeOrDefault()
+	if err != nil {
+		return nil, WrapError(ERROR_MALFORMED_KEY, err)
+	}
+
+	transaction.senderPublicKey, err = utils.VerifierFromString(keyType, *transactionRequest.SenderPublicKey)
+	if err != nil {
+		return nil, WrapError(ERROR_MALFORMED_KEY, err)
+	}
+
+	transaction.signature, err = hex.DecodeString(*transactionRequest.Signature)
+	if err != nil {
+		return nil, WrapError(ERROR_INVALID_SIGNATURE, err)
+	}
+
+	return transaction, nil
+}
+
+// KeyTypeOrDefault returns the requested KeyType,
+// falling back to utils.DEFAULT_KEY_TYPE when it is omitted
+func (transactionRequest *TransactionRequest) KeyTypeOrDefault() (utils.KeyType, error) {
+	if transactionRequest.KeyType == nil {
+		return utils.DEFAULT_KEY_TYPE, nil
+	}
+
+	return utils.ParseKeyType(*transactionRequest.KeyType)
+}
+
+// Validate checks that all fields are not nil. Multisig transactions
+// carry their keys and signatures in the Multisig field instead, batch
+// and UTXO transactions carry outputs instead of a recipient,
+// cancellations carry nothing but the replaced ID, and transactions
+// unlocking scripts on every input need no sender key. Nobody may
+// send as MINING_SENDER or GENESIS_SENDER, coinbases are created by
+// the miner only and allocations by the genesis block
 func (transactionRequest *TransactionRequest) Validate() bool {
+	if transactionRequest.SenderAddress == nil ||
+		*transactionRequest.SenderAddress == MINING_SENDER ||
+		*transactionRequest.SenderAddress == GENESIS_SENDER {
+		return false
+	}
+
+	if len(transactionRequest.Outputs) > 0 {
+		if transactionRequest.RecipientAddress != nil || transactionRequest.Value != nil {
+			return false
+		}
+	} else if transactionRequest.isCancellation() {
+		if transactionRequest.Fee != nil {
+			return false
+		}
+	} else if len(transactionRequest.Inputs) > 0 || transactionRequest.RecipientAddress == nil ||
+		transactionRequest.Value == nil {
+		return false
+	}
+
+	if transactionRequest.Multisig != nil {
+		return transactionRequest.Multisig.Validate()
+	}
+
+	if transactionRequest.SenderPublicKey == nil && transactionRequest.Signature == nil &&
+		transactionRequest.unlocksEveryInput() {
+		return true
+	}
+
 	if transactionRequest.SenderPublicKey == nil ||
-		transactionRequest.SenderAddress == nil ||
-		transactionRequest.RecipientAddress == nil ||
-		transactionRequest.Value == nil ||
 		transactionRequest.Signature == nil {
 		return false
 	}
@@ -298,15 +1161,66 @@ func (transactionRequest *TransactionRequest) Validate() bool {
 	return true
 }
 
+func (transactionRequest *TransactionRequest) isCancellation() bool {
+	return transactionRequest.Replaces != nil &&
+		transactionRequest.RecipientAddress == nil &&
+		transactionRequest.Value == nil &&
+		len(transactionRequest.Inputs) == 0
+}
+
+func (transactionRequest *TransactionRequest) unlocksEveryInput() bool {
+	for _, input := range transactionRequest.Inputs {
+		if input == nil || input.UnlockScript == nil || *input.UnlockScript == "" {
+			return false
+		}
+	}
+
+	return len(transactionRequest.Inputs) > 0
+}
+
+// FindTransaction returns the Transaction with the ID and the height of
+// the Block of the chain including it, -1 while it is pending in mempool
+func (blockchain *Blockchain) FindTransaction(transactionId [32]byte) (*Transaction, int, bool) {
+	blockchain.mux.Lock()
+	defer blockchain.mux.Unlock()
+
+	if transaction, ok := blockchain.mempool.Get(transactionId); ok {
+		return transaction, -1, true
+	}
+
+	for height := len(blockchain.chain) - 1; height >= 0; height-- {
+		for _, transaction := range blockchain.chain[height].transactions {
+			if transaction.Hash() == transactionId {
+				return transaction, height, true
+			}
+		}
+	}
+
+	return nil, 0, false
+}
+
 // TransactionPool returns blockchain transaction pool
 func (blockchain *Blockchain) TransactionPool() []*Transaction {
-	return blockchain.transactionPool
+	blockchain.mux.Lock()
+	defer blockchain.mux.Unlock()
+
+	return blockchain.mempool.Transactions()
+}
+
+// QueryTransactionPool returns the page of pending transactions
+// matching the query and the number of all matching transactions
+func (blockchain *Blockchain) QueryTransactionPool(query *MempoolQuery) ([]*Transaction, int) {
+	blockchain.mux.Lock()
+	defer blockchain.mux.Unlock()
+
+	return blockchain.mempool.Query(query)
 }
 
 // Print is built-in function to print the Transaction
 func (transaction *Transaction) Print() {
 	separator := strings.Repeat("-", 50)
 
+	log.Printf("     id                %x\n", transaction.Hash())
 	log.Printf("     sender_address    %s\n", transaction.senderAddress)
 	log.Printf("     recipient_address %s\n", transaction.recipientAddress)
 	log.Printf("     value             %.1f\n", transaction.value)
@@ -320,6 +1234,9 @@ func (block *Block) Print() {
 	log.Printf(" timestamp         %d\n", block.timestamp)
 	log.Printf(" nonce             %d\n", block.nonce)
 	log.Printf(" previousHash      %x\n", block.previousHash)
+	if block.sealer != nil {
+		log.Printf(" sealer            %s\n", utils.AddressFromPublicKey(block.sealer))
+	}
 
 	if len(block.transactions) > 0 {
 		fmt.Printf("%s Transactions %s\n", separator, separator)
@@ -0,0 +1,85 @@
+package block
+
+import (
+	"fmt"
+)
+
+const (
+	MAX_FORK_DEPTH    = 100
+	MAX_BRANCH_STATES = 8
+)
+
+// sideBranch returns the blocks from the genesis block up to the node,
+// the ones of the chain up to where the node's branch forks off followed
+// by the ones only the branch has. Branches forking off more than
+// MAX_FORK_DEPTH blocks below the tip are refused, so following a side
+// branch never walks or replays more than that
+func (blockchain *Blockchain) sideBranch(node *treeNode) ([]*Block, error) {
+	limit := len(blockchain.chain) - 1 - MAX_FORK_DEPTH
+	side := make([]*Block, 0)
+	for node.height >= len(blockchain.chain) || blockchain.chain[node.height] != node.block {
+		if node.height <= limit {
+			return nil, fmt.Errorf("branch forks off more than %d blocks below the tip", MAX_FORK_DEPTH)
+		}
+		side = append(side, node.block)
+		node = node.parent
+	}
+	if node.height < limit {
+		return nil, fmt.Errorf("branch forks off more than %d blocks below the tip", MAX_FORK_DEPTH)
+	}
+
+	// Capped, so appending to the branch never writes into the chain
+	end := node.height + 1
+	branch := blockchain.chain[:end:end]
+	for i := len(side) - 1; i >= 0; i-- {
+		branch = append(branch, side[i])
+	}
+
+	return branch, nil
+}
+
+// keepBranchState remembers the outputs left by the Block, which was
+// added to a side branch in the ledgerState of its parent. The next Block
+// on top of it is then verified without replaying the branch. The state
+// kept for the parent is taken over, so it is not kept twice
+func (blockchain *Blockchain) keepBranchState(state *ledgerState, block *Block) {
+	if blockchain.ledgerMode != LEDGER_MODE_UTXO {
+		return
+	}
+
+	utxoSet := state.utxoSet
+	if utxoSet == blockchain.utxoSet {
+		utxoSet = utxoSet.clone()
+	}
+	delete(blockchain.branchStates, block.previousHash)
+	if err := utxoSet.connectBlock(block, len(state.chain)); err != nil {
+		return
+	}
+	blockchain.branchStates[block.Hash()] = utxoSet
+
+	blockchain.pruneBranchStates()
+}
+
+// pruneBranchStates forgets the states of the blocks that joined the
+// chain or fell more than MAX_FORK_DEPTH below the tip, and the lowest
+// ones while more than MAX_BRANCH_STATES are kept
+func (blockchain *Blockchain) pruneBranchStates() {
+	limit := len(blockchain.chain) - 1 - MAX_FORK_DEPTH
+	for hash := range blockchain.branchStates {
+		node := blockchain.tree.nodes[hash]
+		inChain := node.height < len(blockchain.chain) && blockchain.chain[node.height] == node.block
+		if inChain || node.height < limit {
+			delete(blockchain.branchStates, hash)
+		}
+	}
+
+	for len(blockchain.branchStates) > MAX_BRANCH_STATES {
+		var lowest *treeNode
+		for hash := range blockchain.branchStates {
+			if node := blockchain.tree.nodes[hash]; lowest == nil || node.height < lowest.height {
+				lowest = node
+			}
+		}
+		delete(blockchain.branchStates, lowest.block.Hash())
+	}
+}
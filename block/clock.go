@@ -0,0 +1,88 @@
+package block
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock tells Blockchain the current time in unix nanoseconds,
+// used for block timestamps, time locks and mempool expiry
+type Clock interface {
+	Now() int64
+}
+
+// SystemClock is the wall clock
+type SystemClock struct{}
+
+// MockClock only moves when it is set or advanced, so tests
+// can unlock time-locked transactions deterministically
+type MockClock struct {
+	mux sync.Mutex
+	now int64
+}
+
+type ClockRequest struct {
+	Time    *int64 `json:"time"`
+	Advance *int64 `json:"advance"`
+}
+
+func (clock SystemClock) Now() int64 {
+	return time.Now().UnixNano()
+}
+
+// NewMockClock generates and returns new MockClock set to the unix nanoseconds
+func NewMockClock(now int64) *MockClock {
+	return &MockClock{now: now}
+}
+
+func (clock *MockClock) Now() int64 {
+	clock.mux.Lock()
+	defer clock.mux.Unlock()
+
+	return clock.now
+}
+
+// Set moves the MockClock to the unix nanoseconds. Like Advance, it never
+// moves backwards, so block timestamps and time locks keep their order
+func (clock *MockClock) Set(now int64) error {
+	clock.mux.Lock()
+	defer clock.mux.Unlock()
+
+	if now < clock.now {
+		return NewError(ERROR_INVALID_REQUEST, "the clock can't go backwards")
+	}
+	clock.now = now
+	return nil
+}
+
+// Advance moves the MockClock forward by the duration
+func (clock *MockClock) Advance(duration time.Duration) {
+	clock.mux.Lock()
+	defer clock.mux.Unlock()
+
+	clock.now += duration.Nanoseconds()
+}
+
+// Validate checks that exactly one of the fields is not nil
+func (clockRequest *ClockRequest) Validate() bool {
+	return (clockRequest.Time == nil) != (clockRequest.Advance == nil)
+}
+
+// Apply sets the MockClock to the unix time in seconds,
+// or advances it by the seconds
+func (clockRequest *ClockRequest) Apply(clock *MockClock) error {
+	if clockRequest.Advance != nil {
+		if *clockRequest.Advance < 0 {
+			return NewError(ERROR_INVALID_REQUEST, "the clock can't go backwards")
+		}
+		clock.Advance(time.Duration(*clockRequest.Advance) * time.Second)
+		return nil
+	}
+
+	return clock.Set(time.Unix(*clockRequest.Time, 0).UnixNano())
+}
+
+// now returns the current time of the Blockchain's Clock
+func (blockchain *Blockchain) now() int64 {
+	return blockchain.clock.Now()
+}
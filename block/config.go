@@ -0,0 +1,27 @@
+package block
+
+// ChainConfig holds the rules a Blockchain is started with,
+// Finality is optional and Clock defaults to SystemClock
+type ChainConfig struct {
+	Genesis          *Genesis
+	LedgerMode       LedgerMode
+	Engine           ConsensusEngine
+	Finality         *FinalityGadget
+	Emission         *EmissionSchedule
+	CoinbaseMaturity int
+	Clock            Clock
+}
+
+// DefaultChainConfig returns the account-style proof of work
+// configuration of DefaultGenesis with the default emission
+// schedule and coinbase maturity
+func DefaultChainConfig() *ChainConfig {
+	return &ChainConfig{
+		Genesis:          DefaultGenesis(),
+		LedgerMode:       LEDGER_MODE_ACCOUNT,
+		Engine:           NewProofOfWorkEngine(MINING_DIFFICULTY),
+		Emission:         DefaultEmissionSchedule(),
+		CoinbaseMaturity: COINBASE_MATURITY,
+		Clock:            SystemClock{},
+	}
+}
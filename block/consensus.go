@@ -0,0 +1,174 @@
+package block
+
+import (
+	"crypto-blockchain/utils"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ConsensusType names a ConsensusEngine, so it can be picked at node start
+type ConsensusType string
+
+const (
+	CONSENSUS_POW ConsensusType = "pow"
+	CONSENSUS_POS ConsensusType = "pos"
+	CONSENSUS_POA ConsensusType = "poa"
+)
+
+// ConsensusEngine decides who may create the next Block and how the
+// Block proves it. Every method gets the chain the Block extends, the
+// Block at height len(chain) being the new one
+type ConsensusEngine interface {
+	Type() ConsensusType
+
+	// Prepare fills the consensus fields of a new Block, failing when
+	// this node may not create it
+	Prepare(chain []*Block, block *Block) error
+
+	// Seal finishes the prepared Block, e.g. by finding a nonce or signing it
+	Seal(chain []*Block, block *Block) error
+
+	// VerifySeal checks that the Block was sealed by the rules of the engine
+	VerifySeal(chain []*Block, block *Block) error
+
+	// ForkChoice tells whether the candidate chain is better than the current one
+	ForkChoice(current []*Block, candidate []*Block) bool
+}
+
+// ProofOfWorkEngine seals blocks with a nonce giving
+// a hash that starts with difficulty zeros
+type ProofOfWorkEngine struct {
+	difficulty int
+}
+
+// ParseConsensusType converts a string into a ConsensusType,
+// an empty string stands for CONSENSUS_POW
+func ParseConsensusType(str string) (ConsensusType, error) {
+	switch consensusType := ConsensusType(str); consensusType {
+	case "":
+		return CONSENSUS_POW, nil
+	case CONSENSUS_POW, CONSENSUS_POS, CONSENSUS_POA:
+		return consensusType, nil
+	default:
+		return "", fmt.Errorf("unsupported consensus %q", str)
+	}
+}
+
+// NewConsensusEngine generates and returns the ConsensusEngine of the type.
+// Proof of work needs difficulty zeros, engines signing blocks seal with
+// the signer. Proof of authority takes turns between the authorities,
+// proof of stake lets the first one propose until anybody stakes. Both
+// fall back to the signer alone when there are none
+func NewConsensusEngine(
+	consensusType ConsensusType,
+	difficulty int,
+	signer utils.Signer,
+	authorities []utils.Verifier,
+) (ConsensusEngine, error) {
+	switch consensusType {
+	case CONSENSUS_POW:
+		return NewProofOfWorkEngine(difficulty), nil
+	case CONSENSUS_POS:
+		bootstrap := signer.Verifier()
+		if len(authorities) > 0 {
+			bootstrap = authorities[0]
+		}
+		return NewProofOfStakeEngine(signer, bootstrap), nil
+	case CONSENSUS_POA:
+		if len(authorities) == 0 {
+			authorities = []utils.Verifier{signer.Verifier()}
+		}
+		return NewProofOfAuthorityEngine(signer, authorities)
+	default:
+		return nil, fmt.Errorf("unsupported consensus %q", consensusType)
+	}
+}
+
+// ParsePublicKeys decodes a comma-separated list of hex public keys,
+// each optionally prefixed with its key type, e.g. "ed25519:<key>"
+func ParsePublicKeys(str string) ([]utils.Verifier, error) {
+	var publicKeys []utils.Verifier
+	for _, entry := range strings.Split(str, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		keyTypeStr, publicKeyStr := "", entry
+		if i := strings.Index(entry, ":"); i >= 0 {
+			keyTypeStr, publicKeyStr = entry[:i], entry[i+1:]
+		}
+
+		keyType, err := utils.ParseKeyType(keyTypeStr)
+		if err != nil {
+			return nil, err
+		}
+		publicKey, err := utils.VerifierFromString(keyType, publicKeyStr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid public key %q: %v", entry, err)
+		}
+
+		publicKeys = append(publicKeys, publicKey)
+	}
+
+	return publicKeys, nil
+}
+
+// NewProofOfWorkEngine generates and returns new ProofOfWorkEngine
+func NewProofOfWorkEngine(difficulty int) *ProofOfWorkEngine {
+	return &ProofOfWorkEngine{difficulty}
+}
+
+func (engine *ProofOfWorkEngine) Type() ConsensusType {
+	return CONSENSUS_POW
+}
+
+// Prepare lets anybody mine, there is nothing to fill in
+func (engine *ProofOfWorkEngine) Prepare(chain []*Block, block *Block) error {
+	return nil
+}
+
+// Seal iterates through the nonce set until the nonce is correct
+func (engine *ProofOfWorkEngine) Seal(chain []*Block, block *Block) error {
+	// While nonce is not correct, we will continue
+	block.nonce = 0
+	for !engine.ValidProof(block.nonce, block.previousHash, block.timestamp, block.transactions) {
+		block.nonce += 1
+	}
+
+	return nil
+}
+
+func (engine *ProofOfWorkEngine) VerifySeal(chain []*Block, block *Block) error {
+	if block.sealer != nil || block.signature != nil {
+		return errors.New("proof of work block must not be signed")
+	}
+	if !engine.ValidProof(block.nonce, block.previousHash, block.timestamp, block.transactions) {
+		return errors.New("invalid proof of work")
+	}
+
+	return nil
+}
+
+// ForkChoice prefers the chain with more work. Every block needs
+// the same difficulty, so that is the longer chain
+func (engine *ProofOfWorkEngine) ForkChoice(current []*Block, candidate []*Block) bool {
+	return len(candidate) > len(current)
+}
+
+// ValidProof checks whether first difficulty numbers in hash are zeros.
+// The timestamp is hashed too, so it can't be changed after sealing
+func (engine *ProofOfWorkEngine) ValidProof(
+	nonce int,
+	previousHash [32]byte,
+	timestamp int64,
+	transactions []*Transaction,
+) bool {
+	zeros := strings.Repeat("0", engine.difficulty)
+
+	guessBlock := Block{nonce: nonce, previousHash: previousHash, timestamp: timestamp, transactions: transactions}
+	guessHashStr := fmt.Sprintf("%x", guessBlock.Hash())
+
+	return guessHashStr[:engine.difficulty] == zeros
+}
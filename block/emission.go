@@ -0,0 +1,108 @@
+package block
+
+import (
+	"fmt"
+	"math"
+)
+
+// EmissionSchedule decides how many new coins the coinbase of each block
+// may create. The subsidy halves every halvingInterval blocks and stops
+// once maxSupply coins have been issued. Zero disables either rule
+type EmissionSchedule struct {
+	initialReward   float32
+	halvingInterval int
+	maxSupply       float32
+}
+
+const (
+	HALVING_INTERVAL  = 210000
+	MAX_SUPPLY        = 0
+	COINBASE_MATURITY = 10
+
+	// After this many halvings the subsidy is below float32 precision
+	MAX_HALVINGS = 64
+)
+
+// NewEmissionSchedule generates and returns new EmissionSchedule
+func NewEmissionSchedule(initialReward float32, halvingInterval int, maxSupply float32) (*EmissionSchedule, error) {
+	if initialReward < 0 || halvingInterval < 0 || maxSupply < 0 {
+		return nil, fmt.Errorf("emission schedule must not be negative")
+	}
+
+	return &EmissionSchedule{
+		initialReward:   initialReward,
+		halvingInterval: halvingInterval,
+		maxSupply:       maxSupply,
+	}, nil
+}
+
+// DefaultEmissionSchedule returns the schedule of MINING_REWARD
+// halving every HALVING_INTERVAL blocks up to MAX_SUPPLY
+func DefaultEmissionSchedule() *EmissionSchedule {
+	schedule, _ := NewEmissionSchedule(MINING_REWARD, HALVING_INTERVAL, MAX_SUPPLY)
+	return schedule
+}
+
+// eraReward returns the subsidy of every block in the halving era
+func (schedule *EmissionSchedule) eraReward(era int) float64 {
+	if era >= MAX_HALVINGS {
+		return 0
+	}
+
+	return math.Ldexp(float64(schedule.initialReward), -era)
+}
+
+// era returns the halving era of the height, the first mined block is
+// height 1 as the genesis block carries no coinbase
+func (schedule *EmissionSchedule) era(height int) int {
+	if schedule.halvingInterval == 0 {
+		return 0
+	}
+
+	return (height - 1) / schedule.halvingInterval
+}
+
+// Supply returns how many coins the blocks up to and including
+// the height may have created at most
+func (schedule *EmissionSchedule) Supply(height int) float32 {
+	var supply float64
+	for mined := 0; mined < height; {
+		era := schedule.era(mined + 1)
+		reward := schedule.eraReward(era)
+		if reward == 0 {
+			break
+		}
+
+		blocks := height - mined
+		if schedule.halvingInterval != 0 {
+			blocks = int(math.Min(float64(blocks), float64((era+1)*schedule.halvingInterval-mined)))
+		}
+
+		supply += reward * float64(blocks)
+		mined += blocks
+	}
+
+	if schedule.maxSupply != 0 {
+		supply = math.Min(supply, float64(schedule.maxSupply))
+	}
+
+	return float32(supply)
+}
+
+// Subsidy returns how many new coins the coinbase of the block at the
+// height may create, not counting the fees it collects
+func (schedule *EmissionSchedule) Subsidy(height int) float32 {
+	if height < 1 {
+		return 0
+	}
+
+	subsidy := float32(schedule.eraReward(schedule.era(height)))
+	if schedule.maxSupply != 0 {
+		remaining := schedule.maxSupply - schedule.Supply(height-1)
+		if remaining < subsidy {
+			subsidy = float32(math.Max(float64(remaining), 0))
+		}
+	}
+
+	return subsidy
+}
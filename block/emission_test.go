@@ -0,0 +1,179 @@
+package block
+
+import (
+	"math"
+	"testing"
+)
+
+func TestEmissionSubsidy(t *testing.T) {
+	cases := []struct {
+		name            string
+		reward          float32
+		halvingInterval int
+		maxSupply       float32
+		height          int
+		subsidy         float32
+	}{
+		{"genesis", 1, 10, 0, 0, 0},
+		{"first block", 1, 10, 0, 1, 1},
+		{"last block of the first era", 1, 10, 0, 10, 1},
+		{"first block of the second era", 1, 10, 0, 11, 0.5},
+		{"last block of the second era", 1, 10, 0, 20, 0.5},
+		{"first block of the third era", 1, 10, 0, 21, 0.25},
+		{"no halving", 1, 0, 0, 1000000, 1},
+		{"last halving", 1, 1, 0, MAX_HALVINGS, float32(math.Ldexp(1, 1-MAX_HALVINGS))},
+		{"after the last halving", 1, 1, 0, MAX_HALVINGS + 1, 0},
+		{"below the cap", 1, 0, 2.5, 2, 1},
+		{"reaching the cap", 1, 0, 2.5, 3, 0.5},
+		{"above the cap", 1, 0, 2.5, 4, 0},
+		{"reaching the cap after a halving", 1, 2, 3, 4, 0.5},
+		{"above the cap after a halving", 1, 2, 3, 5, 0},
+	}
+
+	for _, test := range cases {
+		t.Run(test.name, func(t *testing.T) {
+			schedule, err := NewEmissionSchedule(test.reward, test.halvingInterval, test.maxSupply)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if subsidy := schedule.Subsidy(test.height); subsidy != test.subsidy {
+				t.Errorf("subsidy %v at height %d, want %v", subsidy, test.height, test.subsidy)
+			}
+		})
+	}
+}
+
+func TestEmissionSupply(t *testing.T) {
+	cases := []struct {
+		name            string
+		halvingInterval int
+		maxSupply       float32
+		height          int
+		supply          float32
+	}{
+		{"genesis", 10, 0, 0, 0},
+		{"first era", 10, 0, 10, 10},
+		{"into the second era", 10, 0, 15, 12.5},
+		{"two eras", 10, 0, 20, 15},
+		{"converging", 10, 0, 10 * (MAX_HALVINGS + 5), 20},
+		{"no halving", 0, 0, 1000, 1000},
+		{"capped", 10, 12, 20, 12},
+	}
+
+	for _, test := range cases {
+		t.Run(test.name, func(t *testing.T) {
+			schedule, err := NewEmissionSchedule(1, test.halvingInterval, test.maxSupply)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if supply := schedule.Supply(test.height); supply != test.supply {
+				t.Errorf("supply %v at height %d, want %v", supply, test.height, test.supply)
+			}
+
+			// The subsidies add up to the supply
+			var total float32
+			for height := 1; height <= test.height; height++ {
+				total += schedule.Subsidy(height)
+			}
+			if math.Abs(float64(total-test.supply)) > 1e-3 {
+				t.Errorf("subsidies add up to %v, want %v", total, test.supply)
+			}
+		})
+	}
+}
+
+func TestEmissionEnforced(t *testing.T) {
+	config := testChainConfig(LEDGER_MODE_ACCOUNT)
+	schedule, err := NewEmissionSchedule(1, 2, 2.75)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.Emission = schedule
+	blockchain := newTestChain(t, config)
+
+	mined, err := blockchain.Generate(5, TEST_MINER)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, want := range []float32{1, 1, 0.5, 0.25, 0} {
+		if reward := mined[i].transactions[0].TotalValue(); reward != want {
+			t.Errorf("block %d pays %v, want %v", i+1, reward, want)
+		}
+	}
+
+	// Past the cap the coinbase may only collect the fees
+	cases := []struct {
+		name     string
+		reward   float32
+		accepted bool
+	}{
+		{"coinbase minting past the cap", 0.1, false},
+		{"coinbase minting nothing", 0, true},
+	}
+
+	for _, test := range cases {
+		t.Run(test.name, func(t *testing.T) {
+			block := nextBlock(t, blockchain, blockchain.chain, blockchain.LastBlock().timestamp+1)
+			coinbase := NewTransaction(MINING_SENDER, TEST_MINER, test.reward)
+			coinbase.height = len(blockchain.chain)
+			block.transactions[0] = coinbase
+			if err := blockchain.engine.Seal(blockchain.chain, block); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := blockchain.AddBlock(block, ""); (err == nil) != test.accepted {
+				t.Errorf("added with %v, want accepted %t", err, test.accepted)
+			}
+		})
+	}
+}
+
+func TestCoinbaseMaturity(t *testing.T) {
+	const maturity = 3
+
+	cases := []struct {
+		name       string
+		ledgerMode LedgerMode
+		// confirmations counts the blocks on top of the coinbase
+		confirmations int
+		spendable     bool
+	}{
+		{"account fresh coinbase", LEDGER_MODE_ACCOUNT, 0, false},
+		{"account one block short", LEDGER_MODE_ACCOUNT, maturity - 2, false},
+		{"account mature", LEDGER_MODE_ACCOUNT, maturity - 1, true},
+		{"utxo fresh coinbase", LEDGER_MODE_UTXO, 0, false},
+		{"utxo one block short", LEDGER_MODE_UTXO, maturity - 2, false},
+		{"utxo mature", LEDGER_MODE_UTXO, maturity - 1, true},
+	}
+
+	for _, test := range cases {
+		t.Run(test.name, func(t *testing.T) {
+			config := testChainConfig(test.ledgerMode)
+			config.CoinbaseMaturity = maturity
+			blockchain := newTestChain(t, config)
+			sender := newTestKey(t)
+			fund(t, blockchain, sender.address)
+			funding := blockchain.LastBlock().transactions[0]
+			for i := 0; i < test.confirmations; i++ {
+				fund(t, blockchain, TEST_MINER)
+			}
+
+			amount, available := blockchain.Balance(sender.address)
+			var want float32
+			if test.spendable {
+				want = MINING_REWARD
+			}
+			if amount != MINING_REWARD || available != want {
+				t.Errorf("balance %v with %v available, want %v with %v", amount, available, float32(MINING_REWARD), want)
+			}
+
+			spend := sender.transfer(t, blockchain, "recipient", 0.5)
+			if test.ledgerMode == LEDGER_MODE_UTXO {
+				spend = utxoPayment(t, blockchain, sender, funding, 0.5, 0, nil)
+			}
+			if err := blockchain.SubmitTransaction(spend); (err == nil) != test.spendable {
+				t.Errorf("submitted with %v, want accepted %t", err, test.spendable)
+			}
+		})
+	}
+}
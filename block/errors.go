@@ -0,0 +1,131 @@
+package block
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// ErrorCode tells clients what kind of failure an Error is,
+// so they can react without parsing its message
+type ErrorCode string
+
+// Error is a failure carrying an ErrorCode. It wraps the error
+// describing it, so errors.Is and errors.As see through it
+type Error struct {
+	code ErrorCode
+	err  error
+}
+
+// ErrorResponse is the body of every failed request to the servers
+type ErrorResponse struct {
+	Error ErrorBody `json:"error"`
+}
+
+type ErrorBody struct {
+	Code    ErrorCode `json:"code"`
+	Message string    `json:"message"`
+}
+
+const (
+	ERROR_INVALID_REQUEST     ErrorCode = "invalid_request"
+	ERROR_MALFORMED_KEY       ErrorCode = "malformed_key"
+	ERROR_INVALID_SIGNATURE   ErrorCode = "invalid_signature"
+	ERROR_INSUFFICIENT_FUNDS  ErrorCode = "insufficient_funds"
+	ERROR_INSUFFICIENT_FEE    ErrorCode = "insufficient_fee"
+	ERROR_INVALID_TRANSACTION ErrorCode = "invalid_transaction"
+	ERROR_WRONG_CHAIN         ErrorCode = "wrong_chain"
+	ERROR_ALREADY_KNOWN       ErrorCode = "already_known"
+	ERROR_DOUBLE_SPEND        ErrorCode = "double_spend"
+	ERROR_TOO_MANY_PENDING    ErrorCode = "too_many_pending"
+	ERROR_MEMPOOL_FULL        ErrorCode = "mempool_full"
+	ERROR_INVALID_BLOCK       ErrorCode = "invalid_block"
+	ERROR_ORPHAN_BLOCK        ErrorCode = "orphan_block"
+	ERROR_INVALID_VOTE        ErrorCode = "invalid_vote"
+	ERROR_MINING_FAILED       ErrorCode = "mining_failed"
+	ERROR_NOT_FOUND           ErrorCode = "not_found"
+	ERROR_UNAUTHORIZED        ErrorCode = "unauthorized"
+	ERROR_METHOD_NOT_ALLOWED  ErrorCode = "method_not_allowed"
+	ERROR_GATEWAY             ErrorCode = "gateway_error"
+	ERROR_INTERNAL            ErrorCode = "internal_error"
+)
+
+var errorStatusCodes = map[ErrorCode]int{
+	ERROR_INVALID_REQUEST:     http.StatusBadRequest,
+	ERROR_MALFORMED_KEY:       http.StatusBadRequest,
+	ERROR_INVALID_SIGNATURE:   http.StatusUnprocessableEntity,
+	ERROR_INSUFFICIENT_FUNDS:  http.StatusUnprocessableEntity,
+	ERROR_INSUFFICIENT_FEE:    http.StatusUnprocessableEntity,
+	ERROR_INVALID_TRANSACTION: http.StatusUnprocessableEntity,
+	ERROR_WRONG_CHAIN:         http.StatusUnprocessableEntity,
+	ERROR_ALREADY_KNOWN:       http.StatusConflict,
+	ERROR_DOUBLE_SPEND:        http.StatusConflict,
+	ERROR_TOO_MANY_PENDING:    http.StatusTooManyRequests,
+	ERROR_MEMPOOL_FULL:        http.StatusServiceUnavailable,
+	ERROR_INVALID_BLOCK:       http.StatusUnprocessableEntity,
+	ERROR_ORPHAN_BLOCK:        http.StatusAccepted,
+	ERROR_INVALID_VOTE:        http.StatusUnprocessableEntity,
+	ERROR_MINING_FAILED:       http.StatusConflict,
+	ERROR_NOT_FOUND:           http.StatusNotFound,
+	ERROR_UNAUTHORIZED:        http.StatusUnauthorized,
+	ERROR_METHOD_NOT_ALLOWED:  http.StatusMethodNotAllowed,
+	ERROR_GATEWAY:             http.StatusBadGateway,
+	ERROR_INTERNAL:            http.StatusInternalServerError,
+}
+
+// NewError generates and returns new Error with the message
+func NewError(code ErrorCode, message string) *Error {
+	return &Error{code: code, err: errors.New(message)}
+}
+
+// Errorf generates and returns new Error formatted like fmt.Errorf
+func Errorf(code ErrorCode, format string, args ...interface{}) *Error {
+	return &Error{code: code, err: fmt.Errorf(format, args...)}
+}
+
+// WrapError gives the error the ErrorCode unless it already carries one
+func WrapError(code ErrorCode, err error) error {
+	var coded *Error
+	if err == nil || errors.As(err, &coded) {
+		return err
+	}
+
+	return &Error{code: code, err: err}
+}
+
+func (err *Error) Error() string {
+	return err.err.Error()
+}
+
+func (err *Error) Unwrap() error {
+	return err.err
+}
+
+func (err *Error) Code() ErrorCode {
+	return err.code
+}
+
+// ErrorCodeOf returns the ErrorCode of the first Error wrapped by
+// err, errors without one are internal errors
+func ErrorCodeOf(err error) ErrorCode {
+	var coded *Error
+	if errors.As(err, &coded) {
+		return coded.code
+	}
+
+	return ERROR_INTERNAL
+}
+
+// StatusCode returns the HTTP status code answering an Error with the code
+func (code ErrorCode) StatusCode() int {
+	if statusCode, ok := errorStatusCodes[code]; ok {
+		return statusCode
+	}
+
+	return http.StatusInternalServerError
+}
+
+// NewErrorResponse describes the error for clients
+func NewErrorResponse(err error) *ErrorResponse {
+	return &ErrorResponse{ErrorBody{Code: ErrorCodeOf(err), Message: err.Error()}}
+}
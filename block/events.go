@@ -0,0 +1,43 @@
+package block
+
+// BlockListener is told about every Block connected to the chain with
+// its height. It is called while Blockchain is locked, so it must not
+// call back into it
+type BlockListener func(block *Block, height int)
+
+// TransactionListener is told about every Transaction entering mempool.
+// It is called while Blockchain is locked, so it must not call back into it
+type TransactionListener func(transaction *Transaction)
+
+// OnBlock registers the BlockListener
+func (blockchain *Blockchain) OnBlock(listener BlockListener) {
+	blockchain.mux.Lock()
+	defer blockchain.mux.Unlock()
+
+	blockchain.blockListeners = append(blockchain.blockListeners, listener)
+}
+
+// OnTransaction registers the TransactionListener
+func (blockchain *Blockchain) OnTransaction(listener TransactionListener) {
+	blockchain.mux.Lock()
+	defer blockchain.mux.Unlock()
+
+	blockchain.transactionListeners = append(blockchain.transactionListeners, listener)
+}
+
+func (blockchain *Blockchain) notifyBlock(block *Block, height int) {
+	for _, listener := range blockchain.blockListeners {
+		listener(block, height)
+	}
+}
+
+func (blockchain *Blockchain) notifyTransaction(transaction *Transaction) {
+	for _, listener := range blockchain.transactionListeners {
+		listener(transaction)
+	}
+}
+
+// Involves tells whether the Transaction spends from or pays to the address
+func (transaction *Transaction) Involves(address string) bool {
+	return transaction.senderAddress == address || transaction.PaysTo(address)
+}
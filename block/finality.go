@@ -0,0 +1,544 @@
+package block
+
+import (
+	"crypto-blockchain/utils"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+)
+
+// FinalityGadget finalizes checkpoints, the blocks at every interval-th
+// height, on top of the ConsensusEngine. Validators vote in two phases:
+// a checkpoint with prevotes from more than 2/3 of them is justified,
+// a justified checkpoint with precommits from more than 2/3 of them is
+// final, and Blockchain never reverts a final checkpoint. Every vote
+// links a justified source to its target, and a validator may neither
+// vote for two targets at one height nor cast a vote whose link
+// surrounds or lies within another of its links
+type FinalityGadget struct {
+	chainId    string
+	interval   int
+	validators []utils.Verifier
+	signer     utils.Signer
+
+	votes     map[VoteType]map[Checkpoint]map[string]*Vote
+	voted     map[VoteType]map[int]map[string]*Vote
+	justified Checkpoint
+	finalized Checkpoint
+}
+
+// Checkpoint is the Block at a height divisible by the interval
+type Checkpoint struct {
+	height int
+	hash   [32]byte
+}
+
+// VoteType is the phase a Vote is cast in
+type VoteType string
+
+// Vote is a validator's signed vote for a Checkpoint of a network,
+// cast from the source, the last Checkpoint the validator saw justified
+type Vote struct {
+	chainId    string
+	voteType   VoteType
+	source     Checkpoint
+	checkpoint Checkpoint
+	voter      utils.Verifier
+	signature  []byte
+}
+
+// FinalityStatus is a snapshot of the latest justified
+// and finalized checkpoints
+type FinalityStatus struct {
+	interval  int
+	justified Checkpoint
+	finalized Checkpoint
+}
+
+type VoteRequest struct {
+	Type         *string `json:"type"`
+	SourceHeight *int    `json:"sourceHeight"`
+	SourceHash   *string `json:"sourceHash"`
+	Height       *int    `json:"height"`
+	Hash         *string `json:"hash"`
+	Voter        *string `json:"voter"`
+	KeyType      *string `json:"keyType"`
+	Signature    *string `json:"signature"`
+	ChainId      *string `json:"chainId"`
+}
+
+const (
+	VOTE_PREVOTE   VoteType = "prevote"
+	VOTE_PRECOMMIT VoteType = "precommit"
+
+	CHECKPOINT_INTERVAL = 10
+)
+
+// NewFinalityGadget generates and returns new FinalityGadget. The
+// signer votes for this node and may be nil when it is no validator
+func NewFinalityGadget(interval int, validators []utils.Verifier, signer utils.Signer) (*FinalityGadget, error) {
+	if interval < 1 {
+		return nil, errors.New("checkpoint interval must be positive")
+	}
+	if len(validators) == 0 {
+		return nil, errors.New("finality needs at least one validator")
+	}
+
+	seen := make(map[string]bool)
+	for _, validator := range validators {
+		address := utils.AddressFromPublicKey(validator)
+		if seen[address] {
+			return nil, fmt.Errorf("validator %s is listed twice", address)
+		}
+		seen[address] = true
+	}
+
+	return &FinalityGadget{
+		interval:   interval,
+		validators: validators,
+		signer:     signer,
+		votes:      make(map[VoteType]map[Checkpoint]map[string]*Vote),
+		voted:      make(map[VoteType]map[int]map[string]*Vote),
+	}, nil
+}
+
+// NewVote signs and returns new Vote from the source to the Checkpoint
+// of the network
+func NewVote(chainId string, voteType VoteType, source Checkpoint, checkpoint Checkpoint, signer utils.Signer) (*Vote, error) {
+	vote := &Vote{chainId: chainId, voteType: voteType, source: source, checkpoint: checkpoint, voter: signer.Verifier()}
+
+	hash := vote.SigningHash()
+	signature, err := signer.Sign(hash[:])
+	if err != nil {
+		return nil, err
+	}
+	vote.signature = signature
+
+	return vote, nil
+}
+
+// NewCheckpoint generates and returns new Checkpoint
+func NewCheckpoint(height int, hash [32]byte) Checkpoint {
+	return Checkpoint{height, hash}
+}
+
+func (checkpoint Checkpoint) Height() int {
+	return checkpoint.height
+}
+
+func (checkpoint Checkpoint) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Height int    `json:"height"`
+		Hash   string `json:"hash"`
+	}{
+		Height: checkpoint.height,
+		Hash:   fmt.Sprintf("%x", checkpoint.hash),
+	})
+}
+
+// SigningHash calculates the hash the voter signs
+func (vote *Vote) SigningHash() [32]byte {
+	marshal, _ := json.Marshal(struct {
+		ChainId    string     `json:"chainId"`
+		Type       VoteType   `json:"type"`
+		Source     Checkpoint `json:"source"`
+		Checkpoint Checkpoint `json:"checkpoint"`
+	}{
+		ChainId:    vote.chainId,
+		Type:       vote.voteType,
+		Source:     vote.source,
+		Checkpoint: vote.checkpoint,
+	})
+
+	return sha256.Sum256(marshal)
+}
+
+func (vote *Vote) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Type         VoteType      `json:"type"`
+		SourceHeight int           `json:"sourceHeight"`
+		SourceHash   string        `json:"sourceHash"`
+		Height       int           `json:"height"`
+		Hash         string        `json:"hash"`
+		Voter        string        `json:"voter"`
+		KeyType      utils.KeyType `json:"keyType"`
+		Signature    string        `json:"signature"`
+		ChainId      string        `json:"chainId"`
+	}{
+		Type:         vote.voteType,
+		SourceHeight: vote.source.height,
+		SourceHash:   fmt.Sprintf("%x", vote.source.hash),
+		Height:       vote.checkpoint.height,
+		Hash:         fmt.Sprintf("%x", vote.checkpoint.hash),
+		Voter:        vote.voter.String(),
+		KeyType:      vote.voter.KeyType(),
+		Signature:    fmt.Sprintf("%x", vote.signature),
+		ChainId:      vote.chainId,
+	})
+}
+
+// Validate checks that all fields but the key type are not nil
+func (voteRequest *VoteRequest) Validate() bool {
+	return voteRequest.ChainId != nil &&
+		voteRequest.Type != nil &&
+		voteRequest.SourceHeight != nil &&
+		voteRequest.SourceHash != nil &&
+		voteRequest.Height != nil &&
+		voteRequest.Hash != nil &&
+		voteRequest.Voter != nil &&
+		voteRequest.Signature != nil
+}
+
+// Vote decodes the Vote, the signature is checked once it is added
+func (voteRequest *VoteRequest) Vote() (*Vote, error) {
+	voteType := VoteType(*voteRequest.Type)
+	if voteType != VOTE_PREVOTE && voteType != VOTE_PRECOMMIT {
+		return nil, Errorf(ERROR_INVALID_REQUEST, "unsupported vote type %q", voteType)
+	}
+
+	sourceHash, err := decodeBlockHash(*voteRequest.SourceHash)
+	if err != nil {
+		return nil, WrapError(ERROR_INVALID_REQUEST, err)
+	}
+	hash, err := decodeBlockHash(*voteRequest.Hash)
+	if err != nil {
+		return nil, WrapError(ERROR_INVALID_REQUEST, err)
+	}
+
+	keyType := utils.DEFAULT_KEY_TYPE
+	if voteRequest.KeyType != nil {
+		if keyType, err = utils.ParseKeyType(*voteRequest.KeyType); err != nil {
+			return nil, WrapError(ERROR_MALFORMED_KEY, err)
+		}
+	}
+	voter, err := utils.VerifierFromString(keyType, *voteRequest.Voter)
+	if err != nil {
+		return nil, WrapError(ERROR_MALFORMED_KEY, err)
+	}
+
+	signature, err := hex.DecodeString(*voteRequest.Signature)
+	if err != nil {
+		return nil, WrapError(ERROR_INVALID_SIGNATURE, err)
+	}
+
+	return &Vote{
+		chainId:    *voteRequest.ChainId,
+		voteType:   voteType,
+		source:     Checkpoint{*voteRequest.SourceHeight, *sourceHash},
+		checkpoint: Checkpoint{*voteRequest.Height, *hash},
+		voter:      voter,
+		signature:  signature,
+	}, nil
+}
+
+// decodeBlockHash decodes a hex Block hash
+func decodeBlockHash(str string) (*[32]byte, error) {
+	decoded, err := hex.DecodeString(str)
+	if err != nil || len(decoded) != 32 {
+		return nil, fmt.Errorf("invalid block hash %q", str)
+	}
+
+	var hash [32]byte
+	copy(hash[:], decoded)
+
+	return &hash, nil
+}
+
+func (status *FinalityStatus) Interval() int {
+	return status.interval
+}
+
+func (status *FinalityStatus) Justified() Checkpoint {
+	return status.justified
+}
+
+func (status *FinalityStatus) Finalized() Checkpoint {
+	return status.finalized
+}
+
+func (status *FinalityStatus) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Interval  int        `json:"interval"`
+		Justified Checkpoint `json:"justified"`
+		Finalized Checkpoint `json:"finalized"`
+	}{
+		Interval:  status.interval,
+		Justified: status.justified,
+		Finalized: status.finalized,
+	})
+}
+
+// isValidator tells whether the key may vote
+func (gadget *FinalityGadget) isValidator(key utils.Verifier) bool {
+	address := utils.AddressFromPublicKey(key)
+	for _, validator := range gadget.validators {
+		if utils.AddressFromPublicKey(validator) == address {
+			return true
+		}
+	}
+
+	return false
+}
+
+// hasQuorum tells whether more than 2/3 of the validators cast the votes
+func (gadget *FinalityGadget) hasQuorum(votes map[string]*Vote) bool {
+	return 3*len(votes) > 2*len(gadget.validators)
+}
+
+// addVote records the Vote for a Checkpoint of the chain. A validator
+// voting for two checkpoints at the same height in the same phase, or
+// casting a vote whose link surrounds or lies within the link of another
+// of its votes in the phase, is equivocating, so only its first vote counts
+func (gadget *FinalityGadget) addVote(chain []*Block, vote *Vote) error {
+	if vote.chainId != gadget.chainId {
+		return Errorf(ERROR_WRONG_CHAIN, "vote is for chain %q", vote.chainId)
+	}
+
+	checkpoint := vote.checkpoint
+	if checkpoint.height <= gadget.finalized.height || checkpoint.height%gadget.interval != 0 {
+		return fmt.Errorf("height %d is not an open checkpoint", checkpoint.height)
+	}
+	if checkpoint.height >= len(chain) || chain[checkpoint.height].Hash() != checkpoint.hash {
+		return fmt.Errorf("checkpoint %x is not on the chain", checkpoint.hash)
+	}
+	source := vote.source
+	if source.height >= checkpoint.height || source.height%gadget.interval != 0 || chain[source.height].Hash() != source.hash {
+		return fmt.Errorf("source %x is no checkpoint on the chain below the target", source.hash)
+	}
+
+	if !gadget.isValidator(vote.voter) {
+		return fmt.Errorf("%s is not a validator", utils.AddressFromPublicKey(vote.voter))
+	}
+	hash := vote.SigningHash()
+	if !vote.voter.Verify(hash[:], vote.signature) {
+		return NewError(ERROR_INVALID_SIGNATURE, "invalid vote signature")
+	}
+
+	voter := utils.AddressFromPublicKey(vote.voter)
+	if gadget.voted[vote.voteType] == nil {
+		gadget.voted[vote.voteType] = make(map[int]map[string]*Vote)
+		gadget.votes[vote.voteType] = make(map[Checkpoint]map[string]*Vote)
+	}
+	if voted, ok := gadget.voted[vote.voteType][checkpoint.height][voter]; ok {
+		if voted.source != source || voted.checkpoint != checkpoint {
+			log.Printf("ERROR Validator %s equivocated at height %d", voter, checkpoint.height)
+			return fmt.Errorf("%s already voted for another checkpoint", voter)
+		}
+		return nil
+	}
+	for _, byVoter := range gadget.voted[vote.voteType] {
+		voted, ok := byVoter[voter]
+		if ok && (surrounds(vote, voted) || surrounds(voted, vote)) {
+			log.Printf("ERROR Validator %s equivocated with a surround vote at height %d", voter, checkpoint.height)
+			return fmt.Errorf("%s already voted from %d to %d", voter, voted.source.height, voted.checkpoint.height)
+		}
+	}
+
+	if gadget.voted[vote.voteType][checkpoint.height] == nil {
+		gadget.voted[vote.voteType][checkpoint.height] = make(map[string]*Vote)
+	}
+	gadget.voted[vote.voteType][checkpoint.height][voter] = vote
+
+	if gadget.votes[vote.voteType][checkpoint] == nil {
+		gadget.votes[vote.voteType][checkpoint] = make(map[string]*Vote)
+	}
+	gadget.votes[vote.voteType][checkpoint][voter] = vote
+
+	return nil
+}
+
+// surrounds tells whether the link of the Vote surrounds the link of the
+// inner one, starting below its source and ending above its target
+func surrounds(vote *Vote, inner *Vote) bool {
+	return vote.source.height < inner.source.height && inner.checkpoint.height < vote.checkpoint.height
+}
+
+// tally justifies and finalizes the checkpoints the votes allow,
+// and tells whether the finalized Checkpoint moved
+func (gadget *FinalityGadget) tally() bool {
+	for checkpoint, votes := range gadget.votes[VOTE_PREVOTE] {
+		if checkpoint.height > gadget.justified.height && gadget.hasQuorum(votes) {
+			gadget.justified = checkpoint
+		}
+	}
+
+	finalized := false
+	for checkpoint, votes := range gadget.votes[VOTE_PRECOMMIT] {
+		if checkpoint.height <= gadget.finalized.height || !gadget.hasQuorum(votes) {
+			continue
+		}
+
+		// Precommits only finalize a checkpoint that was justified
+		if !gadget.hasQuorum(gadget.votes[VOTE_PREVOTE][checkpoint]) {
+			continue
+		}
+
+		gadget.finalized = checkpoint
+		finalized = true
+	}
+
+	if finalized {
+		gadget.prune()
+	}
+
+	return finalized
+}
+
+// prune drops the votes nobody needs once their height is final
+func (gadget *FinalityGadget) prune() {
+	for voteType, votes := range gadget.votes {
+		for checkpoint := range votes {
+			if checkpoint.height <= gadget.finalized.height {
+				delete(votes, checkpoint)
+			}
+		}
+		for height := range gadget.voted[voteType] {
+			if height <= gadget.finalized.height {
+				delete(gadget.voted[voteType], height)
+			}
+		}
+	}
+}
+
+// Votes returns the votes cast for the checkpoints at the height
+func (gadget *FinalityGadget) Votes(height int) []*Vote {
+	votes := make([]*Vote, 0)
+	for _, voteType := range []VoteType{VOTE_PREVOTE, VOTE_PRECOMMIT} {
+		for checkpoint, byVoter := range gadget.votes[voteType] {
+			if checkpoint.height != height {
+				continue
+			}
+			for _, vote := range byVoter {
+				votes = append(votes, vote)
+			}
+		}
+	}
+
+	return votes
+}
+
+// castVote signs a Vote for the Checkpoint when this node is a validator
+func (gadget *FinalityGadget) castVote(chain []*Block, voteType VoteType, checkpoint Checkpoint) {
+	if gadget.signer == nil || !gadget.isValidator(gadget.signer.Verifier()) {
+		return
+	}
+
+	// Never sign two checkpoints at the same height, e.g. after a reorg
+	voter := utils.AddressFromPublicKey(gadget.signer.Verifier())
+	if _, ok := gadget.voted[voteType][checkpoint.height][voter]; ok {
+		return
+	}
+
+	// The source is the latest justified Checkpoint below the target
+	source := gadget.finalized
+	if gadget.justified.height < checkpoint.height {
+		source = gadget.justified
+	}
+
+	vote, err := NewVote(gadget.chainId, voteType, source, checkpoint, gadget.signer)
+	if err != nil {
+		log.Printf("ERROR Signing %s: %v", voteType, err)
+		return
+	}
+	if err := gadget.addVote(chain, vote); err != nil {
+		log.Printf("ERROR Casting %s: %v", voteType, err)
+	}
+}
+
+// IsFinalized tells whether the Block at the height can never be reverted
+func (blockchain *Blockchain) IsFinalized(height int) bool {
+	return blockchain.finality != nil && height <= blockchain.finality.finalized.height
+}
+
+// Finality returns the latest justified and finalized checkpoints,
+// if the Blockchain runs the FinalityGadget
+func (blockchain *Blockchain) Finality() (*FinalityStatus, bool) {
+	blockchain.mux.Lock()
+	defer blockchain.mux.Unlock()
+
+	if blockchain.finality == nil {
+		return nil, false
+	}
+
+	return &FinalityStatus{
+		interval:  blockchain.finality.interval,
+		justified: blockchain.finality.justified,
+		finalized: blockchain.finality.finalized,
+	}, true
+}
+
+// Votes returns the votes cast for the checkpoints at the height,
+// so they can be passed on to other nodes
+func (blockchain *Blockchain) Votes(height int) []*Vote {
+	blockchain.mux.Lock()
+	defer blockchain.mux.Unlock()
+
+	if blockchain.finality == nil {
+		return nil
+	}
+
+	return blockchain.finality.Votes(height)
+}
+
+// AddVote records a validator's Vote and finalizes what it allows
+func (blockchain *Blockchain) AddVote(vote *Vote) error {
+	blockchain.mux.Lock()
+	defer blockchain.mux.Unlock()
+
+	if blockchain.finality == nil {
+		return NewError(ERROR_NOT_FOUND, "finality is disabled")
+	}
+
+	if err := blockchain.finality.addVote(blockchain.chain, vote); err != nil {
+		return WrapError(ERROR_INVALID_VOTE, err)
+	}
+	blockchain.updateFinality()
+
+	return nil
+}
+
+// updateFinality has this node vote where it has not yet, precommitting
+// a checkpoint once it is justified, and counts the votes
+func (blockchain *Blockchain) updateFinality() {
+	gadget := blockchain.finality
+	for {
+		tip := len(blockchain.chain) - 1
+		if height := tip - tip%gadget.interval; height > gadget.finalized.height {
+			gadget.castVote(blockchain.chain, VOTE_PREVOTE, Checkpoint{height, blockchain.chain[height].Hash()})
+		}
+		if gadget.justified.height > gadget.finalized.height {
+			gadget.castVote(blockchain.chain, VOTE_PRECOMMIT, gadget.justified)
+		}
+
+		justified, finalized := gadget.justified, gadget.finalized
+		if gadget.tally() {
+			log.Printf("Finalized block %d %x", gadget.finalized.height, gadget.finalized.hash)
+		}
+		if gadget.justified == justified && gadget.finalized == finalized {
+			return
+		}
+	}
+}
+
+// ForkChoice tells whether the candidate chain should replace the chain.
+// A candidate reverting a finalized Checkpoint is never taken
+func (blockchain *Blockchain) ForkChoice(candidate []*Block) bool {
+	blockchain.mux.Lock()
+	defer blockchain.mux.Unlock()
+
+	return blockchain.forkChoice(candidate)
+}
+
+func (blockchain *Blockchain) forkChoice(candidate []*Block) bool {
+	if blockchain.finality != nil {
+		finalized := blockchain.finality.finalized
+		if finalized.height >= len(candidate) || candidate[finalized.height].Hash() != finalized.hash {
+			return false
+		}
+	}
+
+	return blockchain.engine.ForkChoice(blockchain.chain, candidate)
+}
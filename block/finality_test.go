@@ -0,0 +1,222 @@
+package block
+
+import (
+	"crypto-blockchain/utils"
+	"testing"
+)
+
+// testBlocks returns a chain of the length on top of the blocks,
+// told apart from other chains by the nonce
+func testBlocks(blocks []*Block, length int, nonce int) []*Block {
+	chain := append([]*Block{}, blocks...)
+	for len(chain) < length {
+		var previousHash [32]byte
+		if len(chain) > 0 {
+			previousHash = chain[len(chain)-1].Hash()
+		}
+		block := NewBlock(nonce, previousHash, nil)
+		block.timestamp = int64(TEST_CLOCK_START + len(chain))
+		chain = append(chain, block)
+	}
+
+	return chain
+}
+
+// newTestGadget returns a FinalityGadget with a checkpoint every second
+// block and the keys of its validators, this node not being one of them
+func newTestGadget(t *testing.T, validators int, genesis *Block) (*FinalityGadget, []*testKey) {
+	t.Helper()
+	keys := make([]*testKey, validators)
+	verifiers := make([]utils.Verifier, validators)
+	for i := range keys {
+		keys[i] = newTestKey(t)
+		verifiers[i] = keys[i].signer.Verifier()
+	}
+
+	gadget, err := NewFinalityGadget(2, verifiers, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gadget.chainId = DEFAULT_CHAIN_ID
+	gadget.justified = Checkpoint{0, genesis.Hash()}
+	gadget.finalized = gadget.justified
+
+	return gadget, keys
+}
+
+// castTestVote adds the Vote of the key from the source to the target
+// height of the chain
+func castTestVote(t *testing.T, gadget *FinalityGadget, chain []*Block, key *testKey, voteType VoteType, source int, target int) error {
+	t.Helper()
+	vote, err := NewVote(gadget.chainId, voteType,
+		Checkpoint{source, chain[source].Hash()}, Checkpoint{target, chain[target].Hash()}, key.signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return gadget.addVote(chain, vote)
+}
+
+func TestFinalityThreshold(t *testing.T) {
+	cases := []struct {
+		name       string
+		validators int
+		votes      int
+		justified  bool
+	}{
+		{"single validator", 1, 1, true},
+		{"two of three", 3, 2, false},
+		{"three of three", 3, 3, true},
+		{"two of four", 4, 2, false},
+		{"three of four", 4, 3, true},
+		{"six of nine", 9, 6, false},
+		{"seven of nine", 9, 7, true},
+	}
+
+	for _, test := range cases {
+		t.Run(test.name, func(t *testing.T) {
+			chain := testBlocks(nil, 3, 0)
+			gadget, keys := newTestGadget(t, test.validators, chain[0])
+			for _, key := range keys[:test.votes] {
+				if err := castTestVote(t, gadget, chain, key, VOTE_PREVOTE, 0, 2); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			gadget.tally()
+			if justified := gadget.justified.height == 2; justified != test.justified {
+				t.Errorf("justified %t, want %t", justified, test.justified)
+			}
+		})
+	}
+}
+
+func TestFinalityOrder(t *testing.T) {
+	chain := testBlocks(nil, 3, 0)
+	gadget, keys := newTestGadget(t, 4, chain[0])
+
+	// The steps run in order on the same FinalityGadget
+	steps := []struct {
+		name      string
+		voteType  VoteType
+		voters    []*testKey
+		justified int
+		finalized int
+	}{
+		{"precommits before prevotes", VOTE_PRECOMMIT, keys[:3], 0, 0},
+		{"prevotes short of the quorum", VOTE_PREVOTE, keys[:2], 0, 0},
+		{"prevote reaching the quorum", VOTE_PREVOTE, keys[2:3], 2, 2},
+	}
+
+	for _, step := range steps {
+		t.Run(step.name, func(t *testing.T) {
+			for _, key := range step.voters {
+				if err := castTestVote(t, gadget, chain, key, step.voteType, 0, 2); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			gadget.tally()
+			if gadget.justified.height != step.justified || gadget.finalized.height != step.finalized {
+				t.Errorf("justified %d and finalized %d, want %d and %d",
+					gadget.justified.height, gadget.finalized.height, step.justified, step.finalized)
+			}
+		})
+	}
+}
+
+func TestFinalityEquivocation(t *testing.T) {
+	type link struct {
+		voteType VoteType
+		source   int
+		target   int
+		// fork votes for the checkpoint of another branch
+		fork bool
+	}
+
+	cases := []struct {
+		name     string
+		first    *link
+		second   link
+		accepted bool
+	}{
+		{"source at the target", nil, link{VOTE_PREVOTE, 2, 2, false}, false},
+		{"source above the target", nil, link{VOTE_PREVOTE, 4, 2, false}, false},
+		{"source off the checkpoints", nil, link{VOTE_PREVOTE, 1, 2, false}, false},
+		{"same vote twice", &link{VOTE_PREVOTE, 0, 2, false}, link{VOTE_PREVOTE, 0, 2, false}, true},
+		{"double vote", &link{VOTE_PREVOTE, 0, 4, false}, link{VOTE_PREVOTE, 0, 4, true}, false},
+		{"double vote from another source", &link{VOTE_PREVOTE, 0, 4, false}, link{VOTE_PREVOTE, 2, 4, false}, false},
+		{"surrounding vote", &link{VOTE_PREVOTE, 2, 4, false}, link{VOTE_PREVOTE, 0, 6, false}, false},
+		{"surrounded vote", &link{VOTE_PREVOTE, 0, 6, false}, link{VOTE_PREVOTE, 2, 4, false}, false},
+		{"consecutive links", &link{VOTE_PREVOTE, 0, 2, false}, link{VOTE_PREVOTE, 2, 4, false}, true},
+		{"overlapping links", &link{VOTE_PREVOTE, 0, 4, false}, link{VOTE_PREVOTE, 2, 6, false}, true},
+		{"surrounded in the other phase", &link{VOTE_PREVOTE, 0, 6, false}, link{VOTE_PRECOMMIT, 2, 4, false}, true},
+	}
+
+	for _, test := range cases {
+		t.Run(test.name, func(t *testing.T) {
+			chain := testBlocks(nil, 7, 0)
+			fork := testBlocks(chain[:3], 7, 1)
+			gadget, keys := newTestGadget(t, 4, chain[0])
+
+			cast := func(link link) error {
+				voted := chain
+				if link.fork {
+					voted = fork
+				}
+				return castTestVote(t, gadget, voted, keys[0], link.voteType, link.source, link.target)
+			}
+			if test.first != nil {
+				if err := cast(*test.first); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if err := cast(test.second); (err == nil) != test.accepted {
+				t.Errorf("voted with %v, want accepted %t", err, test.accepted)
+			}
+		})
+	}
+}
+
+func TestFinalityForkChoice(t *testing.T) {
+	config := testChainConfig(LEDGER_MODE_ACCOUNT)
+	validator := newTestKey(t)
+	finality, err := NewFinalityGadget(2, []utils.Verifier{validator.signer.Verifier()}, validator.signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.Finality = finality
+	blockchain := newTestChain(t, config)
+	if _, err := blockchain.Generate(5, "main"); err != nil {
+		t.Fatal(err)
+	}
+	finalized := blockchain.finality.finalized.height
+	if finalized != 4 {
+		t.Fatalf("finalized height %d, want 4", finalized)
+	}
+
+	fork := func(height int, count int) []*Block {
+		return append(append([]*Block{}, blockchain.chain[:height+1]...), sideBlocks(t, blockchain, height, count)...)
+	}
+
+	cases := []struct {
+		name      string
+		candidate []*Block
+		preferred bool
+	}{
+		{"longer chain", fork(len(blockchain.chain)-1, 1), true},
+		{"longer fork above the finalized block", fork(finalized, 3), true},
+		{"longer fork below the finalized block", fork(finalized-1, 4), false},
+		{"longer fork from genesis", fork(0, 8), false},
+		{"shorter chain", blockchain.chain[:finalized+1], false},
+	}
+
+	for _, test := range cases {
+		t.Run(test.name, func(t *testing.T) {
+			if preferred := blockchain.ForkChoice(test.candidate); preferred != test.preferred {
+				t.Errorf("preferred %t, want %t", preferred, test.preferred)
+			}
+		})
+	}
+}
@@ -0,0 +1,331 @@
+package block
+
+import (
+	"crypto-blockchain/utils"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// Genesis describes a network: its ID, the first Block with the
+// initial allocations and the rules every node of it follows
+type Genesis struct {
+	chainId            string
+	timestamp          int64
+	difficulty         int
+	ledgerMode         LedgerMode
+	consensus          ConsensusType
+	authorities        []utils.Verifier
+	finalityInterval   int
+	finalityValidators []utils.Verifier
+	emission           *EmissionSchedule
+	coinbaseMaturity   int
+	allocations        []*TxOutput
+}
+
+type GenesisRequest struct {
+	ChainId          *string                  `json:"chainId"`
+	Timestamp        *int64                   `json:"timestamp"`
+	Difficulty       *int                     `json:"difficulty"`
+	Ledger           *string                  `json:"ledger"`
+	Consensus        *GenesisConsensusRequest `json:"consensus"`
+	Emission         *GenesisEmissionRequest  `json:"emission"`
+	CoinbaseMaturity *int                     `json:"coinbaseMaturity"`
+	Alloc            []*TxOutputRequest       `json:"alloc"`
+}
+
+type GenesisConsensusRequest struct {
+	Type               *string  `json:"type"`
+	Authorities        []string `json:"authorities"`
+	FinalityInterval   *int     `json:"finalityInterval"`
+	FinalityValidators []string `json:"finalityValidators"`
+}
+
+type GenesisEmissionRequest struct {
+	Reward          *float32 `json:"reward"`
+	HalvingInterval *int     `json:"halvingInterval"`
+	MaxSupply       *float32 `json:"maxSupply"`
+}
+
+const (
+	DEFAULT_CHAIN_ID = "devnet"
+	GENESIS_SENDER   = "GENESIS"
+)
+
+// DefaultGenesis returns the local development network:
+// proof of work, account-style balances and no allocations
+func DefaultGenesis() *Genesis {
+	return &Genesis{
+		chainId:          DEFAULT_CHAIN_ID,
+		difficulty:       MINING_DIFFICULTY,
+		ledgerMode:       LEDGER_MODE_ACCOUNT,
+		consensus:        CONSENSUS_POW,
+		emission:         DefaultEmissionSchedule(),
+		coinbaseMaturity: COINBASE_MATURITY,
+	}
+}
+
+// LoadGenesis reads the Genesis from a JSON file, fields
+// left out of it keep the values of DefaultGenesis
+func LoadGenesis(path string) (*Genesis, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var genesisRequest GenesisRequest
+	if err := json.Unmarshal(data, &genesisRequest); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	genesis, err := genesisRequest.Genesis()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return genesis, nil
+}
+
+// Genesis decodes the request on top of DefaultGenesis
+func (genesisRequest *GenesisRequest) Genesis() (*Genesis, error) {
+	genesis := DefaultGenesis()
+
+	if genesisRequest.ChainId != nil {
+		if *genesisRequest.ChainId == "" {
+			return nil, errors.New("chain ID must not be empty")
+		}
+		genesis.chainId = *genesisRequest.ChainId
+	}
+	if genesisRequest.Timestamp != nil {
+		genesis.timestamp = *genesisRequest.Timestamp
+	}
+	if genesisRequest.Difficulty != nil {
+		if *genesisRequest.Difficulty < 0 || *genesisRequest.Difficulty > 64 {
+			return nil, fmt.Errorf("difficulty %d is out of range", *genesisRequest.Difficulty)
+		}
+		genesis.difficulty = *genesisRequest.Difficulty
+	}
+	if genesisRequest.CoinbaseMaturity != nil {
+		if *genesisRequest.CoinbaseMaturity < 0 {
+			return nil, errors.New("coinbase maturity must not be negative")
+		}
+		genesis.coinbaseMaturity = *genesisRequest.CoinbaseMaturity
+	}
+
+	var err error
+	if genesisRequest.Ledger != nil {
+		if genesis.ledgerMode, err = ParseLedgerMode(*genesisRequest.Ledger); err != nil {
+			return nil, err
+		}
+	}
+
+	if consensus := genesisRequest.Consensus; consensus != nil {
+		if consensus.Type != nil {
+			if genesis.consensus, err = ParseConsensusType(*consensus.Type); err != nil {
+				return nil, err
+			}
+		}
+		if genesis.authorities, err = parsePublicKeyList(consensus.Authorities); err != nil {
+			return nil, err
+		}
+		if consensus.FinalityInterval != nil {
+			if *consensus.FinalityInterval < 0 {
+				return nil, errors.New("finality interval must not be negative")
+			}
+			genesis.finalityInterval = *consensus.FinalityInterval
+		}
+		if genesis.finalityValidators, err = parsePublicKeyList(consensus.FinalityValidators); err != nil {
+			return nil, err
+		}
+	}
+
+	if emission := genesisRequest.Emission; emission != nil {
+		reward, halvingInterval, maxSupply := float32(MINING_REWARD), HALVING_INTERVAL, float32(MAX_SUPPLY)
+		if emission.Reward != nil {
+			reward = *emission.Reward
+		}
+		if emission.HalvingInterval != nil {
+			halvingInterval = *emission.HalvingInterval
+		}
+		if emission.MaxSupply != nil {
+			maxSupply = *emission.MaxSupply
+		}
+		if genesis.emission, err = NewEmissionSchedule(reward, halvingInterval, maxSupply); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, allocRequest := range genesisRequest.Alloc {
+		allocation, err := allocRequest.TxOutput()
+		if err != nil {
+			return nil, fmt.Errorf("alloc: %w", err)
+		}
+		if allocation.value <= 0 {
+			return nil, fmt.Errorf("alloc to %s must be positive", allocation.address)
+		}
+		genesis.allocations = append(genesis.allocations, allocation)
+	}
+
+	return genesis, nil
+}
+
+// parsePublicKeyList decodes public keys given one per entry
+// in the format of ParsePublicKeys
+func parsePublicKeyList(entries []string) ([]utils.Verifier, error) {
+	publicKeys := make([]utils.Verifier, 0, len(entries))
+	for _, entry := range entries {
+		parsed, err := ParsePublicKeys(entry)
+		if err != nil {
+			return nil, err
+		}
+		if len(parsed) != 1 {
+			return nil, fmt.Errorf("expected one public key, got %q", entry)
+		}
+		publicKeys = append(publicKeys, parsed[0])
+	}
+
+	return publicKeys, nil
+}
+
+func (genesis *Genesis) ChainId() string {
+	return genesis.chainId
+}
+
+func (genesis *Genesis) LedgerMode() LedgerMode {
+	return genesis.ledgerMode
+}
+
+func (genesis *Genesis) Consensus() ConsensusType {
+	return genesis.consensus
+}
+
+// Block builds the first Block of the network. It only depends on the
+// Genesis, so every node of the network starts from the same hash. Its
+// single transaction pays the allocations and carries the chain ID,
+// which sets networks apart even without allocations. It has no parent,
+// so its previous hash commits to the rules instead, and nodes following
+// other rules start from another hash
+func (genesis *Genesis) Block() *Block {
+	allocation := NewTransaction(GENESIS_SENDER, "", 0)
+	allocation.outputs = genesis.allocations
+	allocation.chainId = genesis.chainId
+
+	return &Block{
+		previousHash: genesis.rulesHash(),
+		timestamp:    time.Unix(genesis.timestamp, 0).UnixNano(),
+		transactions: []*Transaction{allocation},
+	}
+}
+
+// rulesHash calculates the hash of the Genesis as JSON, covering the
+// consensus, difficulty, emission, ledger mode and coinbase maturity
+func (genesis *Genesis) rulesHash() [32]byte {
+	marshal, _ := json.Marshal(genesis)
+
+	return sha256.Sum256(marshal)
+}
+
+// Hash calculates the hash of the genesis Block
+func (genesis *Genesis) Hash() [32]byte {
+	return genesis.Block().Hash()
+}
+
+// ChainConfig returns the rules of the network for a node
+// sealing blocks and voting with the signer
+func (genesis *Genesis) ChainConfig(signer utils.Signer) (*ChainConfig, error) {
+	engine, err := NewConsensusEngine(genesis.consensus, genesis.difficulty, signer, genesis.authorities)
+	if err != nil {
+		return nil, err
+	}
+
+	config := &ChainConfig{
+		Genesis:          genesis,
+		LedgerMode:       genesis.ledgerMode,
+		Engine:           engine,
+		Emission:         genesis.emission,
+		CoinbaseMaturity: genesis.coinbaseMaturity,
+	}
+
+	if genesis.finalityInterval != 0 {
+		validators := genesis.finalityValidators
+		if len(validators) == 0 {
+			validators = genesis.authorities
+		}
+		if len(validators) == 0 {
+			validators = []utils.Verifier{signer.Verifier()}
+		}
+
+		if config.Finality, err = NewFinalityGadget(genesis.finalityInterval, validators, signer); err != nil {
+			return nil, err
+		}
+	}
+
+	return config, nil
+}
+
+func (genesis *Genesis) MarshalJSON() ([]byte, error) {
+	type consensus struct {
+		Type               ConsensusType `json:"type"`
+		Authorities        []string      `json:"authorities"`
+		FinalityInterval   int           `json:"finalityInterval"`
+		FinalityValidators []string      `json:"finalityValidators"`
+	}
+	type emission struct {
+		Reward          float32 `json:"reward"`
+		HalvingInterval int     `json:"halvingInterval"`
+		MaxSupply       float32 `json:"maxSupply"`
+	}
+
+	publicKeys := func(verifiers []utils.Verifier) []string {
+		entries := make([]string, 0, len(verifiers))
+		for _, verifier := range verifiers {
+			entries = append(entries, string(verifier.KeyType())+":"+verifier.String())
+		}
+		return entries
+	}
+
+	return json.Marshal(struct {
+		ChainId          string      `json:"chainId"`
+		Timestamp        int64       `json:"timestamp"`
+		Difficulty       int         `json:"difficulty"`
+		Ledger           LedgerMode  `json:"ledger"`
+		Consensus        consensus   `json:"consensus"`
+		Emission         emission    `json:"emission"`
+		CoinbaseMaturity int         `json:"coinbaseMaturity"`
+		Alloc            []*TxOutput `json:"alloc"`
+	}{
+		ChainId:    genesis.chainId,
+		Timestamp:  genesis.timestamp,
+		Difficulty: genesis.difficulty,
+		Ledger:     genesis.ledgerMode,
+		Consensus: consensus{
+			Type:               genesis.consensus,
+			Authorities:        publicKeys(genesis.authorities),
+			FinalityInterval:   genesis.finalityInterval,
+			FinalityValidators: publicKeys(genesis.finalityValidators),
+		},
+		Emission: emission{
+			Reward:          genesis.emission.initialReward,
+			HalvingInterval: genesis.emission.halvingInterval,
+			MaxSupply:       genesis.emission.maxSupply,
+		},
+		CoinbaseMaturity: genesis.coinbaseMaturity,
+		Alloc:            genesis.allocations,
+	})
+}
+
+// ChainId returns the ID of the network the Blockchain belongs to
+func (blockchain *Blockchain) ChainId() string {
+	return blockchain.chainId
+}
+
+// GenesisHash returns the hash of the genesis Block
+func (blockchain *Blockchain) GenesisHash() [32]byte {
+	blockchain.mux.Lock()
+	defer blockchain.mux.Unlock()
+
+	return blockchain.chain[0].Hash()
+}
@@ -0,0 +1,79 @@
+package block
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestGenesisHashCoversRules(t *testing.T) {
+	base := DefaultGenesis().Hash()
+	authority := newTestKey(t).signer.Verifier()
+
+	cases := []struct {
+		name    string
+		request string
+	}{
+		{"chain ID", `{"chainId": "testnet"}`},
+		{"timestamp", `{"timestamp": 1}`},
+		{"difficulty", `{"difficulty": 5}`},
+		{"ledger mode", `{"ledger": "utxo"}`},
+		{"consensus", `{"consensus": {"type": "poa", "authorities": ["` + string(authority.KeyType()) + `:` + authority.String() + `"]}}`},
+		{"finality", `{"consensus": {"finalityInterval": 5}}`},
+		{"reward", `{"emission": {"reward": 25}}`},
+		{"halving interval", `{"emission": {"halvingInterval": 1000}}`},
+		{"max supply", `{"emission": {"maxSupply": 1000}}`},
+		{"coinbase maturity", `{"coinbaseMaturity": 1}`},
+		{"allocation", `{"alloc": [{"address": "address", "value": 1}]}`},
+	}
+
+	seen := map[[32]byte]string{base: "the default"}
+	for _, test := range cases {
+		t.Run(test.name, func(t *testing.T) {
+			var request GenesisRequest
+			if err := json.Unmarshal([]byte(test.request), &request); err != nil {
+				t.Fatal(err)
+			}
+			genesis, err := request.Genesis()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			hash := genesis.Hash()
+			if other, ok := seen[hash]; ok {
+				t.Errorf("hash %x is the same as with %s", hash, other)
+			}
+			seen[hash] = test.name
+		})
+	}
+}
+
+func TestValidChainChecksGenesis(t *testing.T) {
+	cases := []struct {
+		name string
+		// chain returns the chain checked by the Blockchain
+		chain func(blockchain *Blockchain) []*Block
+		valid bool
+	}{
+		{"own genesis", func(blockchain *Blockchain) []*Block {
+			return blockchain.chain
+		}, true},
+		{"genesis of another network", func(blockchain *Blockchain) []*Block {
+			genesis := *blockchain.chain[0]
+			genesis.timestamp++
+			return []*Block{&genesis}
+		}, false},
+		{"genesis spending a missing output", func(blockchain *Blockchain) []*Block {
+			blockchain.chain[0].transactions[0].inputs = []*OutPoint{NewOutPoint([32]byte{1}, 0)}
+			return blockchain.chain
+		}, false},
+	}
+
+	for _, test := range cases {
+		t.Run(test.name, func(t *testing.T) {
+			blockchain := newTestChain(t, testChainConfig(LEDGER_MODE_UTXO))
+			if valid := blockchain.ValidChain(test.chain(blockchain)); valid != test.valid {
+				t.Errorf("valid %t, want %t", valid, test.valid)
+			}
+		})
+	}
+}
@@ -0,0 +1,113 @@
+package block
+
+import (
+	"crypto-blockchain/utils"
+	"testing"
+	"time"
+)
+
+const (
+	TEST_CLOCK_START = 1700000000
+	TEST_MINER       = "miner"
+)
+
+// testChainConfig returns the regtest rules in the LedgerMode: blocks need
+// no proof of work, coinbases can be spent right away and the clock only
+// moves when it is told to
+func testChainConfig(ledgerMode LedgerMode) *ChainConfig {
+	config := DefaultChainConfig()
+	config.LedgerMode = ledgerMode
+	config.Engine = NewProofOfWorkEngine(0)
+	config.CoinbaseMaturity = 0
+	config.Clock = NewMockClock(time.Unix(TEST_CLOCK_START, 0).UnixNano())
+
+	return config
+}
+
+// newTestChain starts a Blockchain with the ChainConfig
+func newTestChain(t *testing.T, config *ChainConfig) *Blockchain {
+	t.Helper()
+	return NewBlockChainWithConfig(TEST_MINER, 0, config)
+}
+
+// testKey signs the transactions of one address
+type testKey struct {
+	signer  utils.Signer
+	address string
+}
+
+func newTestKey(t *testing.T) *testKey {
+	t.Helper()
+	signer, err := utils.GenerateSigner(utils.KEY_TYPE_P256)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &testKey{signer, utils.AddressFromPublicKey(signer.Verifier())}
+}
+
+// sign signs the Transaction with the key
+func (key *testKey) sign(t *testing.T, transaction *Transaction) *Transaction {
+	t.Helper()
+	transaction.senderPublicKey = key.signer.Verifier()
+	hash := transaction.SigningHash()
+	signature, err := key.signer.Sign(hash[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	transaction.signature = signature
+
+	return transaction
+}
+
+// transfer returns the signed Transaction of the value from the key
+// to the recipient, changed by the edits before it is signed
+func (key *testKey) transfer(t *testing.T, blockchain *Blockchain, recipient string, value float32, edits ...func(*Transaction)) *Transaction {
+	t.Helper()
+	transaction := NewTransaction(key.address, recipient, value)
+	transaction.chainId = blockchain.chainId
+	for _, edit := range edits {
+		edit(transaction)
+	}
+
+	return key.sign(t, transaction)
+}
+
+// fund mines a Block paying its coinbase to the address
+func fund(t *testing.T, blockchain *Blockchain, address string) {
+	t.Helper()
+	if _, err := blockchain.Generate(1, address); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// nextBlock returns a Block on top of the branch with the timestamp and
+// the transactions after a coinbase paying TEST_MINER, sealed by the
+// engine of the Blockchain
+func nextBlock(t *testing.T, blockchain *Blockchain, branch []*Block, timestamp int64, transactions ...*Transaction) *Block {
+	t.Helper()
+	height := len(branch)
+	var fees float32
+	for _, transaction := range transactions {
+		fees += transaction.fee
+	}
+	coinbase := NewTransaction(MINING_SENDER, TEST_MINER, blockchain.emission.Subsidy(height)+fees)
+	coinbase.height = height
+
+	block := NewBlock(0, branch[height-1].Hash(), append([]*Transaction{coinbase}, transactions...))
+	block.timestamp = timestamp
+	if err := blockchain.engine.Seal(branch, block); err != nil {
+		t.Fatal(err)
+	}
+
+	return block
+}
+
+// errorCode returns the ErrorCode of the error, empty when there is none
+func errorCode(err error) ErrorCode {
+	if err == nil {
+		return ""
+	}
+
+	return ErrorCodeOf(err)
+}
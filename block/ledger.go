@@ -0,0 +1,146 @@
+package block
+
+import (
+	"fmt"
+)
+
+// ledgerState is what a Transaction is verified against: the blocks up
+// to a tip, the unspent outputs they leave in UTXO mode, and the
+// transactions already spending on top of them
+type ledgerState struct {
+	chain   []*Block
+	utxoSet *UTXOSet
+	pending pendingSpends
+}
+
+// pendingSpends are the transactions spending on top of a ledgerState,
+// the ones in mempool or the ones before in the same Block
+type pendingSpends interface {
+	Spender(outPoint OutPoint) ([32]byte, bool)
+	Spent(sender string) float32
+}
+
+// blockSpends are the transactions of a Block verified so far
+type blockSpends struct {
+	ids      map[[32]byte]bool
+	spenders map[OutPoint][32]byte
+	spent    map[string]float32
+}
+
+func newBlockSpends() *blockSpends {
+	return &blockSpends{
+		ids:      make(map[[32]byte]bool),
+		spenders: make(map[OutPoint][32]byte),
+		spent:    make(map[string]float32),
+	}
+}
+
+func (spends *blockSpends) Spender(outPoint OutPoint) ([32]byte, bool) {
+	spender, ok := spends.spenders[outPoint]
+	return spender, ok
+}
+
+func (spends *blockSpends) Spent(sender string) float32 {
+	return spends.spent[sender]
+}
+
+func (spends *blockSpends) add(transaction *Transaction) {
+	transactionId := transaction.Hash()
+	spends.ids[transactionId] = true
+	for _, input := range transaction.inputs {
+		spends.spenders[*input] = transactionId
+	}
+	spends.spent[transaction.senderAddress] += transaction.Cost()
+}
+
+// tipState returns the ledgerState of the chain with mempool on top
+func (blockchain *Blockchain) tipState() *ledgerState {
+	return &ledgerState{
+		chain:   blockchain.chain,
+		utxoSet: blockchain.utxoSet,
+		pending: blockchain.mempool,
+	}
+}
+
+// branchState returns the ledgerState at the tip of the branch, which
+// shares the blocks up to a common ancestor with the chain. In UTXO mode
+// the outputs kept for the tip by keepBranchState are used, or else the
+// outputs of the chain are rolled back to the ancestor and rolled
+// forward along the branch on a copy
+func (blockchain *Blockchain) branchState(branch []*Block) (*ledgerState, error) {
+	state := &ledgerState{chain: branch, utxoSet: blockchain.utxoSet, pending: newBlockSpends()}
+	if blockchain.ledgerMode != LEDGER_MODE_UTXO {
+		return state, nil
+	}
+	if utxoSet, ok := blockchain.branchStates[branch[len(branch)-1].Hash()]; ok {
+		state.utxoSet = utxoSet
+		return state, nil
+	}
+
+	ancestor := len(blockchain.chain) - 1
+	if len(branch)-1 < ancestor {
+		ancestor = len(branch) - 1
+	}
+	for blockchain.chain[ancestor] != branch[ancestor] {
+		ancestor--
+	}
+	if ancestor == len(blockchain.chain)-1 && ancestor == len(branch)-1 {
+		return state, nil
+	}
+
+	state.utxoSet = blockchain.utxoSet.clone()
+	for height := len(blockchain.chain) - 1; height > ancestor; height-- {
+		state.utxoSet.disconnectBlock(blockchain.chain[height])
+	}
+	for height := ancestor + 1; height < len(branch); height++ {
+		if err := state.utxoSet.connectBlock(branch[height], height); err != nil {
+			return nil, fmt.Errorf("block %d of the branch: %w", height, err)
+		}
+	}
+
+	return state, nil
+}
+
+// verifyTransaction checks that the Transaction is authorised by the
+// sender and only spends what the sender has in the ledgerState
+func (blockchain *Blockchain) verifyTransaction(state *ledgerState, transaction *Transaction) error {
+	// Spending script-locked outputs only is authorised by the scripts
+	if !blockchain.isScriptSpend(state, transaction) && !blockchain.verifyAuthorisation(transaction) {
+		return NewError(ERROR_INVALID_SIGNATURE, "transaction is not signed by the sender")
+	}
+
+	if err := blockchain.verifyLedger(state, transaction); err != nil {
+		return WrapError(ERROR_INVALID_TRANSACTION, err)
+	}
+
+	return nil
+}
+
+// verifyBlockTransactions runs the checks of mempool on every Transaction
+// of the Block but the coinbase, against the ledgerState of its branch.
+// The transactions spend one after another, so none of them may be
+// included twice, spend an input spent before or more than the sender has
+func (blockchain *Blockchain) verifyBlockTransactions(state *ledgerState, block *Block) error {
+	included := make(map[[32]byte]bool)
+	for _, previous := range state.chain {
+		for _, transaction := range previous.transactions {
+			included[transaction.Hash()] = true
+		}
+	}
+
+	spends := newBlockSpends()
+	state = &ledgerState{chain: state.chain, utxoSet: state.utxoSet, pending: spends}
+	for _, transaction := range block.transactions[1:] {
+		transactionId := transaction.Hash()
+		if included[transactionId] || spends.ids[transactionId] {
+			return fmt.Errorf("transaction %x is included twice", transactionId)
+		}
+
+		if err := blockchain.verifyTransaction(state, transaction); err != nil {
+			return fmt.Errorf("transaction %x: %w", transactionId, err)
+		}
+		spends.add(transaction)
+	}
+
+	return nil
+}
@@ -0,0 +1,359 @@
+package block
+
+import (
+	"encoding/json"
+	"sort"
+	"time"
+)
+
+// Mempool keeps the transactions waiting to be mined. It is bounded in
+// bytes, in count and per sender, and when it is full the transactions
+// paying the lowest fee per byte are evicted first. Inputs spent by
+// pooled transactions are tracked, so conflicting spends are rejected
+type Mempool struct {
+	entries      []*mempoolEntry
+	byId         map[[32]byte]*mempoolEntry
+	spends       map[OutPoint][32]byte
+	bySender     map[string]int
+	size         int
+	maxBytes     int
+	maxCount     int
+	maxPerSender int
+	expiry       time.Duration
+}
+
+type mempoolEntry struct {
+	transaction *Transaction
+	id          [32]byte
+	size        int
+	addedAt     int64
+}
+
+const (
+	MEMPOOL_MAX_BYTES        = 1 << 20
+	MEMPOOL_MAX_TRANSACTIONS = 5000
+	MEMPOOL_MAX_PER_SENDER   = 25
+	MEMPOOL_EXPIRY_SEC       = 60 * 60 * 24
+
+	MAX_BLOCK_TRANSACTIONS = 1000
+
+	MEMPOOL_SORT_TIME = "time"
+	MEMPOOL_SORT_FEE  = "fee"
+)
+
+// MempoolQuery filters, sorts and pages pending transactions. Empty
+// filters match everything and a zero Limit returns all matches
+type MempoolQuery struct {
+	Sender     string
+	Recipient  string
+	SortBy     string
+	Descending bool
+	Offset     int
+	Limit      int
+}
+
+// NewMempool generates and returns empty Mempool with the given limits
+func NewMempool(maxBytes int, maxCount int, maxPerSender int, expiry time.Duration) *Mempool {
+	return &Mempool{
+		entries:      make([]*mempoolEntry, 0),
+		byId:         make(map[[32]byte]*mempoolEntry),
+		spends:       make(map[OutPoint][32]byte),
+		bySender:     make(map[string]int),
+		maxBytes:     maxBytes,
+		maxCount:     maxCount,
+		maxPerSender: maxPerSender,
+		expiry:       expiry,
+	}
+}
+
+// feeRate returns the fee the Transaction pays per byte
+func (entry *mempoolEntry) feeRate() float64 {
+	return float64(entry.transaction.fee) / float64(entry.size)
+}
+
+// Add puts the Transaction into the Mempool at the time in nanoseconds,
+// evicting cheaper transactions when there is no room left
+func (mempool *Mempool) Add(transaction *Transaction, now int64) error {
+	mempool.Expire(now)
+
+	marshal, _ := json.Marshal(transaction)
+	entry := &mempoolEntry{
+		transaction: transaction,
+		id:          transaction.Hash(),
+		size:        len(marshal),
+		addedAt:     now,
+	}
+
+	if _, ok := mempool.byId[entry.id]; ok {
+		return Errorf(ERROR_ALREADY_KNOWN, "transaction %x is already pending", entry.id)
+	}
+	for _, input := range transaction.inputs {
+		if spender, ok := mempool.spends[*input]; ok {
+			return Errorf(ERROR_DOUBLE_SPEND, "input %s is already spent by pending transaction %x", input, spender)
+		}
+	}
+	if mempool.bySender[transaction.senderAddress] >= mempool.maxPerSender {
+		return Errorf(ERROR_TOO_MANY_PENDING, "%s has %d pending transactions already", transaction.senderAddress, mempool.maxPerSender)
+	}
+	if entry.size > mempool.maxBytes {
+		return Errorf(ERROR_MEMPOOL_FULL, "transaction of %d bytes does not fit into the mempool", entry.size)
+	}
+
+	victims, err := mempool.victimsFor(entry)
+	if err != nil {
+		return err
+	}
+	for _, victim := range victims {
+		mempool.remove(victim)
+	}
+
+	mempool.insert(entry)
+	return nil
+}
+
+// insert puts the entry into the Mempool without checking the limits,
+// entries are kept ordered by arrival
+func (mempool *Mempool) insert(entry *mempoolEntry) {
+	position := len(mempool.entries)
+	for position > 0 && mempool.entries[position-1].addedAt > entry.addedAt {
+		position -= 1
+	}
+
+	mempool.entries = append(mempool.entries, nil)
+	copy(mempool.entries[position+1:], mempool.entries[position:])
+	mempool.entries[position] = entry
+	mempool.byId[entry.id] = entry
+	mempool.bySender[entry.transaction.senderAddress] += 1
+	mempool.size += entry.size
+	for _, input := range entry.transaction.inputs {
+		mempool.spends[*input] = entry.id
+	}
+}
+
+// victimsFor picks the cheapest entries to evict to make room for the
+// entry. Only entries paying a lower fee per byte may be evicted
+func (mempool *Mempool) victimsFor(entry *mempoolEntry) ([]*mempoolEntry, error) {
+	count := len(mempool.entries) + 1
+	size := mempool.size + entry.size
+	if count <= mempool.maxCount && size <= mempool.maxBytes {
+		return nil, nil
+	}
+
+	candidates := make([]*mempoolEntry, len(mempool.entries))
+	copy(candidates, mempool.entries)
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].feeRate() < candidates[j].feeRate()
+	})
+
+	victims := make([]*mempoolEntry, 0)
+	for _, candidate := range candidates {
+		if count <= mempool.maxCount && size <= mempool.maxBytes {
+			break
+		}
+		if candidate.feeRate() >= entry.feeRate() {
+			return nil, NewError(ERROR_MEMPOOL_FULL, "mempool is full, fee is too low")
+		}
+
+		victims = append(victims, candidate)
+		count -= 1
+		size -= candidate.size
+	}
+
+	return victims, nil
+}
+
+func (mempool *Mempool) remove(entry *mempoolEntry) {
+	if _, ok := mempool.byId[entry.id]; !ok {
+		return
+	}
+
+	for i, pooled := range mempool.entries {
+		if pooled == entry {
+			mempool.entries = append(mempool.entries[:i], mempool.entries[i+1:]...)
+			break
+		}
+	}
+
+	delete(mempool.byId, entry.id)
+	mempool.size -= entry.size
+	if mempool.bySender[entry.transaction.senderAddress] -= 1; mempool.bySender[entry.transaction.senderAddress] == 0 {
+		delete(mempool.bySender, entry.transaction.senderAddress)
+	}
+	for _, input := range entry.transaction.inputs {
+		if mempool.spends[*input] == entry.id {
+			delete(mempool.spends, *input)
+		}
+	}
+}
+
+// take drops the Transaction with the ID from the Mempool and returns
+// its entry, so it can be put back with insert
+func (mempool *Mempool) take(transactionId [32]byte) (*mempoolEntry, bool) {
+	entry, ok := mempool.byId[transactionId]
+	if ok {
+		mempool.remove(entry)
+	}
+
+	return entry, ok
+}
+
+// Get returns the pending Transaction with the ID
+func (mempool *Mempool) Get(transactionId [32]byte) (*Transaction, bool) {
+	entry, ok := mempool.byId[transactionId]
+	if !ok {
+		return nil, false
+	}
+
+	return entry.transaction, true
+}
+
+// Remove drops the Transaction with the ID from the Mempool
+func (mempool *Mempool) Remove(transactionId [32]byte) bool {
+	_, ok := mempool.take(transactionId)
+	return ok
+}
+
+// RemoveBlock drops the transactions included into the Block
+// and the pending transactions conflicting with them
+func (mempool *Mempool) RemoveBlock(block *Block) {
+	for _, transaction := range block.transactions {
+		mempool.Remove(transaction.Hash())
+
+		for _, input := range transaction.inputs {
+			if spender, ok := mempool.spends[*input]; ok {
+				mempool.Remove(spender)
+			}
+		}
+	}
+}
+
+// Expire drops the transactions pending for longer than the expiry
+// and returns them
+func (mempool *Mempool) Expire(now int64) []*Transaction {
+	expired := make([]*Transaction, 0)
+	for _, entry := range append([]*mempoolEntry{}, mempool.entries...) {
+		if now-entry.addedAt > mempool.expiry.Nanoseconds() {
+			mempool.remove(entry)
+			expired = append(expired, entry.transaction)
+		}
+	}
+
+	return expired
+}
+
+// Select returns up to limit transactions that may be included into
+// a Block at the height with the timestamp, highest fee per byte first
+func (mempool *Mempool) Select(height int, timestamp int64, limit int) []*Transaction {
+	ready := make([]*mempoolEntry, 0)
+	for _, entry := range mempool.entries {
+		if entry.transaction.IsFinal(height, timestamp) {
+			ready = append(ready, entry)
+		}
+	}
+
+	sort.SliceStable(ready, func(i, j int) bool {
+		return ready[i].feeRate() > ready[j].feeRate()
+	})
+
+	transactions := make([]*Transaction, 0)
+	for _, entry := range ready {
+		if len(transactions) == limit {
+			break
+		}
+		transactions = append(transactions, entry.transaction)
+	}
+
+	return transactions
+}
+
+// Query returns the page of pending transactions matching the query
+// and the number of all matching transactions
+func (mempool *Mempool) Query(query *MempoolQuery) ([]*Transaction, int) {
+	matches := make([]*mempoolEntry, 0)
+	for _, entry := range mempool.entries {
+		if query.Sender != "" && entry.transaction.senderAddress != query.Sender {
+			continue
+		}
+		if query.Recipient != "" && !entry.transaction.PaysTo(query.Recipient) {
+			continue
+		}
+		matches = append(matches, entry)
+	}
+
+	// Entries are ordered by arrival already
+	if query.SortBy == MEMPOOL_SORT_FEE {
+		sort.SliceStable(matches, func(i, j int) bool {
+			return matches[i].transaction.fee < matches[j].transaction.fee
+		})
+	}
+	if query.Descending {
+		for i, j := 0, len(matches)-1; i < j; i, j = i+1, j-1 {
+			matches[i], matches[j] = matches[j], matches[i]
+		}
+	}
+
+	total := len(matches)
+	if query.Offset >= total {
+		return []*Transaction{}, total
+	}
+	matches = matches[query.Offset:]
+	if query.Limit > 0 && query.Limit < len(matches) {
+		matches = matches[:query.Limit]
+	}
+
+	transactions := make([]*Transaction, 0, len(matches))
+	for _, entry := range matches {
+		transactions = append(transactions, entry.transaction)
+	}
+
+	return transactions, total
+}
+
+// PaysTo tells whether one of the outputs of the Transaction pays to the address
+func (transaction *Transaction) PaysTo(address string) bool {
+	for _, output := range transaction.Outputs() {
+		if output.address == address {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Spender returns the ID of the pending Transaction spending the OutPoint
+func (mempool *Mempool) Spender(outPoint OutPoint) ([32]byte, bool) {
+	spender, ok := mempool.spends[outPoint]
+	return spender, ok
+}
+
+// Spent returns what the pending transactions of the sender take from it
+func (mempool *Mempool) Spent(sender string) float32 {
+	var spent float32
+	for _, entry := range mempool.entries {
+		if entry.transaction.senderAddress == sender {
+			spent += entry.transaction.Cost()
+		}
+	}
+
+	return spent
+}
+
+// Transactions returns the pending transactions in the order they arrived
+func (mempool *Mempool) Transactions() []*Transaction {
+	transactions := make([]*Transaction, 0, len(mempool.entries))
+	for _, entry := range mempool.entries {
+		transactions = append(transactions, entry.transaction)
+	}
+
+	return transactions
+}
+
+// Len returns the number of pending transactions
+func (mempool *Mempool) Len() int {
+	return len(mempool.entries)
+}
+
+// Size returns the total size of pending transactions in bytes
+func (mempool *Mempool) Size() int {
+	return mempool.size
+}
@@ -0,0 +1,200 @@
+package block
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// pendingTransaction returns a Transaction of the sender paying the fee,
+// told apart from the others of the sender by the index
+func pendingTransaction(sender string, index int, fee float32) *Transaction {
+	transaction := NewTransaction(sender, fmt.Sprintf("recipient %03d", index), 1)
+	transaction.fee = fee
+
+	return transaction
+}
+
+// transactionSize returns the size the Mempool counts for the Transaction
+func transactionSize(t *testing.T, transaction *Transaction) int {
+	t.Helper()
+	marshal, err := json.Marshal(transaction)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return len(marshal)
+}
+
+func TestMempoolSelectByFee(t *testing.T) {
+	mempool := NewMempool(MEMPOOL_MAX_BYTES, MEMPOOL_MAX_TRANSACTIONS, MEMPOOL_MAX_PER_SENDER, time.Hour)
+	fees := []float32{0.1, 0.5, 0, 0.3}
+	for i, fee := range fees {
+		if err := mempool.Add(pendingTransaction("sender", i, fee), int64(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cases := []struct {
+		name  string
+		limit int
+		want  []float32
+	}{
+		{"all of them", len(fees), []float32{0.5, 0.3, 0.1, 0}},
+		{"up to the limit", 2, []float32{0.5, 0.3}},
+	}
+
+	for _, test := range cases {
+		t.Run(test.name, func(t *testing.T) {
+			selected := mempool.Select(0, 0, test.limit)
+			got := make([]float32, 0, len(selected))
+			for _, transaction := range selected {
+				got = append(got, transaction.fee)
+			}
+			if fmt.Sprint(got) != fmt.Sprint(test.want) {
+				t.Errorf("selected fees %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestMempoolLimits(t *testing.T) {
+	size := transactionSize(t, pendingTransaction("sender a", 0, 0.1))
+
+	cases := []struct {
+		name     string
+		maxBytes int
+		maxCount int
+		// pooled are added first, each by its own sender
+		pooled []float32
+		added  *Transaction
+		code   ErrorCode
+		// evicted lists the indexes of the pooled transactions evicted
+		evicted []int
+	}{
+		{
+			name:     "room left",
+			maxBytes: MEMPOOL_MAX_BYTES, maxCount: 3,
+			pooled: []float32{0.1, 0.2},
+			added:  pendingTransaction("sender z", 9, 0.1),
+		},
+		{
+			name:     "full by count evicts the cheapest",
+			maxBytes: MEMPOOL_MAX_BYTES, maxCount: 2,
+			pooled:  []float32{0.2, 0.1},
+			added:   pendingTransaction("sender z", 9, 0.3),
+			evicted: []int{1},
+		},
+		{
+			name:     "full by size evicts the cheapest",
+			maxBytes: 2*size + size/2, maxCount: MEMPOOL_MAX_TRANSACTIONS,
+			pooled:  []float32{0.1, 0.2},
+			added:   pendingTransaction("sender z", 9, 0.3),
+			evicted: []int{0},
+		},
+		{
+			name:     "full of better paying transactions",
+			maxBytes: MEMPOOL_MAX_BYTES, maxCount: 2,
+			pooled: []float32{0.2, 0.3},
+			added:  pendingTransaction("sender z", 9, 0.2),
+			code:   ERROR_MEMPOOL_FULL,
+		},
+		{
+			name:     "larger than the mempool",
+			maxBytes: size - 1, maxCount: MEMPOOL_MAX_TRANSACTIONS,
+			added: pendingTransaction("sender z", 9, 0.3),
+			code:  ERROR_MEMPOOL_FULL,
+		},
+		{
+			name:     "already pending",
+			maxBytes: MEMPOOL_MAX_BYTES, maxCount: MEMPOOL_MAX_TRANSACTIONS,
+			pooled: []float32{0.1},
+			added:  pendingTransaction("sender a", 0, 0.1),
+			code:   ERROR_ALREADY_KNOWN,
+		},
+	}
+
+	for _, test := range cases {
+		t.Run(test.name, func(t *testing.T) {
+			mempool := NewMempool(test.maxBytes, test.maxCount, MEMPOOL_MAX_PER_SENDER, time.Hour)
+			pooled := make([]*Transaction, 0, len(test.pooled))
+			for i, fee := range test.pooled {
+				transaction := pendingTransaction(fmt.Sprintf("sender %c", 'a'+i), 0, fee)
+				if err := mempool.Add(transaction, int64(i)); err != nil {
+					t.Fatal(err)
+				}
+				pooled = append(pooled, transaction)
+			}
+
+			if err := mempool.Add(test.added, int64(len(pooled))); errorCode(err) != test.code {
+				t.Fatalf("added with %v, want %q", err, test.code)
+			}
+
+			evicted := make(map[int]bool)
+			for _, index := range test.evicted {
+				evicted[index] = true
+			}
+			for i, transaction := range pooled {
+				if _, ok := mempool.Get(transaction.Hash()); ok == evicted[i] {
+					t.Errorf("pooled transaction %d is pending: %t", i, ok)
+				}
+			}
+			if mempool.Len() > test.maxCount || mempool.Size() > test.maxBytes {
+				t.Errorf("holds %d transactions of %d bytes", mempool.Len(), mempool.Size())
+			}
+		})
+	}
+}
+
+func TestMempoolPerSenderLimit(t *testing.T) {
+	mempool := NewMempool(MEMPOOL_MAX_BYTES, MEMPOOL_MAX_TRANSACTIONS, 2, time.Hour)
+	for i := 0; i < 2; i++ {
+		if err := mempool.Add(pendingTransaction("sender", i, 0.1), int64(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cases := []struct {
+		name        string
+		transaction *Transaction
+		code        ErrorCode
+	}{
+		{"same sender", pendingTransaction("sender", 2, 0.5), ERROR_TOO_MANY_PENDING},
+		{"another sender", pendingTransaction("other", 0, 0.1), ""},
+	}
+
+	for _, test := range cases {
+		t.Run(test.name, func(t *testing.T) {
+			if err := mempool.Add(test.transaction, 2); errorCode(err) != test.code {
+				t.Errorf("added with %v, want %q", err, test.code)
+			}
+		})
+	}
+
+	// A mined transaction makes room for the next one
+	mempool.Remove(pendingTransaction("sender", 0, 0.1).Hash())
+	if err := mempool.Add(pendingTransaction("sender", 2, 0.5), 3); err != nil {
+		t.Errorf("added after one was removed with %v", err)
+	}
+}
+
+func TestMempoolExpire(t *testing.T) {
+	mempool := NewMempool(MEMPOOL_MAX_BYTES, MEMPOOL_MAX_TRANSACTIONS, MEMPOOL_MAX_PER_SENDER, time.Hour)
+	old := pendingTransaction("sender", 0, 0.1)
+	fresh := pendingTransaction("sender", 1, 0.1)
+	if err := mempool.Add(old, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := mempool.Add(fresh, time.Minute.Nanoseconds()); err != nil {
+		t.Fatal(err)
+	}
+
+	expired := mempool.Expire(time.Hour.Nanoseconds() + 1)
+	if len(expired) != 1 || expired[0] != old {
+		t.Errorf("expired %d transactions, want only the old one", len(expired))
+	}
+	if _, ok := mempool.Get(fresh.Hash()); !ok {
+		t.Error("the fresh transaction expired too")
+	}
+}
@@ -0,0 +1,179 @@
+package block
+
+import (
+	"crypto-blockchain/utils"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+)
+
+// Multisig holds the M-of-N key set behind a multisig address and the
+// signatures collected from its members. Signatures are aligned with
+// publicKeys, a nil entry means that key did not sign
+type Multisig struct {
+	threshold  int
+	publicKeys []utils.Verifier
+	signatures [][]byte
+}
+
+type MultisigRequest struct {
+	Threshold *int                     `json:"threshold"`
+	Signers   []*MultisigSignerRequest `json:"signers"`
+}
+
+type MultisigSignerRequest struct {
+	KeyType   *string `json:"keyType"`
+	PublicKey *string `json:"publicKey"`
+	Signature *string `json:"signature"`
+}
+
+// NewMultisig generates and returns new Multisig
+func NewMultisig(threshold int, publicKeys []utils.Verifier, signatures [][]byte) *Multisig {
+	return &Multisig{
+		threshold:  threshold,
+		publicKeys: publicKeys,
+		signatures: signatures,
+	}
+}
+
+// Address derives the multisig address of the key set and threshold
+func (multisig *Multisig) Address() (string, error) {
+	return utils.MultisigAddress(multisig.threshold, multisig.publicKeys)
+}
+
+func (multisig *Multisig) MarshalJSON() ([]byte, error) {
+	type signer struct {
+		KeyType   utils.KeyType `json:"keyType"`
+		PublicKey string        `json:"publicKey"`
+		Signature string        `json:"signature,omitempty"`
+	}
+
+	signers := make([]signer, 0, len(multisig.publicKeys))
+	for i, publicKey := range multisig.publicKeys {
+		signers = append(signers, signer{
+			KeyType:   publicKey.KeyType(),
+			PublicKey: publicKey.String(),
+			Signature: hex.EncodeToString(multisig.signatures[i]),
+		})
+	}
+
+	return json.Marshal(struct {
+		Threshold int      `json:"threshold"`
+		Signers   []signer `json:"signers"`
+	}{
+		Threshold: multisig.threshold,
+		Signers:   signers,
+	})
+}
+
+// CreateMultisigTransaction adds a Transaction spent from a multisig address
+func (blockchain *Blockchain) CreateMultisigTransaction(
+	sender string,
+	recipient string,
+	value float32,
+	multisig *Multisig,
+) bool {
+	blockchain.mux.Lock()
+	defer blockchain.mux.Unlock()
+
+	isTransacted := blockchain.AddMultisigTransaction(sender, recipient, value, multisig)
+
+	// TODO: Add sync
+
+	return isTransacted
+}
+
+// AddMultisigTransaction appends new multisig Transaction of this network
+// to transaction pool, the signatures have to cover the chain ID of the Blockchain
+func (blockchain *Blockchain) AddMultisigTransaction(
+	sender string,
+	recipient string,
+	value float32,
+	multisig *Multisig,
+) bool {
+	transaction := NewTransaction(sender, recipient, value)
+	transaction.chainId = blockchain.chainId
+	transaction.multisig = multisig
+
+	if err := blockchain.addTransaction(transaction); err != nil {
+		log.Printf("ERROR Validating transaction: %v", err)
+		return false
+	}
+
+	return true
+}
+
+// VerifyMultisigSignatures checks that the key set derives the sender
+// address and that at least threshold of its keys signed the Transaction
+func (blockchain *Blockchain) VerifyMultisigSignatures(
+	multisig *Multisig,
+	transaction *Transaction,
+) bool {
+	address, err := multisig.Address()
+	if err != nil || address != transaction.senderAddress {
+		return false
+	}
+
+	valid := 0
+	for i, publicKey := range multisig.publicKeys {
+		signature := multisig.signatures[i]
+		if signature == nil {
+			continue
+		}
+
+		if !blockchain.VerifyTransactionSignature(publicKey, signature, transaction) {
+			return false
+		}
+		valid += 1
+	}
+
+	return valid >= multisig.threshold
+}
+
+// Validate checks that the threshold and every signer's key are not nil
+func (multisigRequest *MultisigRequest) Validate() bool {
+	if multisigRequest.Threshold == nil || len(multisigRequest.Signers) == 0 {
+		return false
+	}
+
+	for _, signer := range multisigRequest.Signers {
+		if signer == nil || signer.PublicKey == nil {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Multisig decodes the keys and signatures of the request
+func (multisigRequest *MultisigRequest) Multisig() (*Multisig, error) {
+	publicKeys := make([]utils.Verifier, 0, len(multisigRequest.Signers))
+	signatures := make([][]byte, 0, len(multisigRequest.Signers))
+
+	for i, signer := range multisigRequest.Signers {
+		keyType := utils.DEFAULT_KEY_TYPE
+		if signer.KeyType != nil {
+			var err error
+			if keyType, err = utils.ParseKeyType(*signer.KeyType); err != nil {
+				return nil, WrapError(ERROR_MALFORMED_KEY, err)
+			}
+		}
+
+		publicKey, err := utils.VerifierFromString(keyType, *signer.PublicKey)
+		if err != nil {
+			return nil, Errorf(ERROR_MALFORMED_KEY, "signer %d: %w", i, err)
+		}
+
+		var signature []byte
+		if signer.Signature != nil && *signer.Signature != "" {
+			if signature, err = hex.DecodeString(*signer.Signature); err != nil {
+				return nil, Errorf(ERROR_INVALID_SIGNATURE, "signer %d: %w", i, err)
+			}
+		}
+
+		publicKeys = append(publicKeys, publicKey)
+		signatures = append(signatures, signature)
+	}
+
+	return NewMultisig(*multisigRequest.Threshold, publicKeys, signatures), nil
+}
@@ -0,0 +1,72 @@
+package block
+
+import (
+	"crypto-blockchain/utils"
+	"testing"
+)
+
+// multisigTransfer returns the Transaction of the value from the multisig
+// address of the keys, signed by the keys at the indexes only
+func multisigTransfer(t *testing.T, blockchain *Blockchain, threshold int, keys []*testKey, signers []int) *Transaction {
+	t.Helper()
+	publicKeys := make([]utils.Verifier, 0, len(keys))
+	for _, key := range keys {
+		publicKeys = append(publicKeys, key.signer.Verifier())
+	}
+	address, err := utils.MultisigAddress(threshold, publicKeys)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	transaction := NewTransaction(address, "recipient", 0.25)
+	transaction.chainId = blockchain.chainId
+	hash := transaction.SigningHash()
+	signatures := make([][]byte, len(keys))
+	for _, signer := range signers {
+		if signatures[signer], err = keys[signer].signer.Sign(hash[:]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	transaction.multisig = NewMultisig(threshold, publicKeys, signatures)
+
+	return transaction
+}
+
+func TestMultisigTransactionId(t *testing.T) {
+	blockchain := newTestChain(t, testChainConfig(LEDGER_MODE_ACCOUNT))
+	keys := []*testKey{newTestKey(t), newTestKey(t), newTestKey(t)}
+	full := multisigTransfer(t, blockchain, 2, keys, []int{0, 1, 2})
+	fund(t, blockchain, full.senderAddress)
+	if err := blockchain.SubmitTransaction(full); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name       string
+		signers    []int
+		authorised bool
+		code       ErrorCode
+	}{
+		{"every member", []int{0, 1, 2}, true, ERROR_ALREADY_KNOWN},
+		{"first two", []int{0, 1}, true, ERROR_ALREADY_KNOWN},
+		{"last two", []int{1, 2}, true, ERROR_ALREADY_KNOWN},
+		{"below the threshold", []int{2}, false, ERROR_INVALID_SIGNATURE},
+	}
+
+	for _, test := range cases {
+		t.Run(test.name, func(t *testing.T) {
+			transaction := multisigTransfer(t, blockchain, 2, keys, test.signers)
+			if transaction.Hash() != full.Hash() {
+				t.Errorf("ID %x, want the ID %x of the copy signed by every member", transaction.Hash(), full.Hash())
+			}
+			if authorised := blockchain.VerifyMultisigSignatures(transaction.multisig, transaction); authorised != test.authorised {
+				t.Errorf("authorised %t, want %t", authorised, test.authorised)
+			}
+
+			// An authorised copy is the pending Transaction, not another one
+			if err := blockchain.SubmitTransaction(transaction); ErrorCodeOf(err) != test.code {
+				t.Errorf("submitted with %v, want %s", err, test.code)
+			}
+		})
+	}
+}
@@ -0,0 +1,208 @@
+package block
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+// OrphanPool keeps the blocks whose parent is not known yet,
+// keyed by the missing parent, until the parent arrives. Each source
+// may only fill part of it, so one node can't push out the others
+type OrphanPool struct {
+	byParent     map[[32]byte][]*orphanBlock
+	byHash       map[[32]byte]*orphanBlock
+	bySource     map[string]int
+	maxCount     int
+	maxPerSource int
+	expiry       time.Duration
+}
+
+type orphanBlock struct {
+	block   *Block
+	hash    [32]byte
+	source  string
+	addedAt int64
+}
+
+// BlockFetcher asks the node at the source for the Block with the hash
+type BlockFetcher func(source string, hash [32]byte) (*Block, error)
+
+const (
+	MAX_ORPHAN_BLOCKS      = 100
+	MAX_ORPHANS_PER_SOURCE = 20
+	ORPHAN_EXPIRY_SEC      = 600
+)
+
+// ErrOrphanBlock is returned for a Block kept until its parent arrives
+var ErrOrphanBlock = NewError(ERROR_ORPHAN_BLOCK, "parent of the block is unknown")
+
+// NewOrphanPool generates and returns new OrphanPool
+func NewOrphanPool(maxCount int, maxPerSource int, expiry time.Duration) *OrphanPool {
+	return &OrphanPool{
+		byParent:     make(map[[32]byte][]*orphanBlock),
+		byHash:       make(map[[32]byte]*orphanBlock),
+		bySource:     make(map[string]int),
+		maxCount:     maxCount,
+		maxPerSource: maxPerSource,
+		expiry:       expiry,
+	}
+}
+
+// Add keeps the Block received from the source. When the source already
+// keeps as many orphans as it may, its oldest one is evicted, and when
+// the pool is full, the oldest one of all. It fails when the Block is
+// already kept
+func (pool *OrphanPool) Add(block *Block, source string, now int64) bool {
+	hash := block.Hash()
+	if _, ok := pool.byHash[hash]; ok {
+		return false
+	}
+
+	if pool.bySource[source] >= pool.maxPerSource {
+		pool.remove(pool.oldest(func(orphan *orphanBlock) bool { return orphan.source == source }))
+	} else if len(pool.byHash) >= pool.maxCount {
+		pool.remove(pool.oldest(func(orphan *orphanBlock) bool { return true }))
+	}
+
+	orphan := &orphanBlock{block: block, hash: hash, source: source, addedAt: now}
+	pool.byHash[hash] = orphan
+	pool.byParent[block.previousHash] = append(pool.byParent[block.previousHash], orphan)
+	pool.bySource[source] += 1
+
+	return true
+}
+
+// oldest returns the matching orphan kept for the longest time
+func (pool *OrphanPool) oldest(matches func(orphan *orphanBlock) bool) *orphanBlock {
+	var oldest *orphanBlock
+	for _, orphan := range pool.byHash {
+		if !matches(orphan) {
+			continue
+		}
+		if oldest == nil || orphan.addedAt < oldest.addedAt {
+			oldest = orphan
+		}
+	}
+
+	return oldest
+}
+
+// Has tells whether the Block with the hash is kept
+func (pool *OrphanPool) Has(hash [32]byte) bool {
+	_, ok := pool.byHash[hash]
+	return ok
+}
+
+// Expire drops the orphans kept for longer than the expiry
+func (pool *OrphanPool) Expire(now int64) {
+	for _, orphan := range pool.byHash {
+		if now-orphan.addedAt > pool.expiry.Nanoseconds() {
+			pool.remove(orphan)
+		}
+	}
+}
+
+// Len returns the number of kept orphans
+func (pool *OrphanPool) Len() int {
+	return len(pool.byHash)
+}
+
+// take removes and returns the orphans waiting for the parent
+func (pool *OrphanPool) take(parentHash [32]byte) []*orphanBlock {
+	children := pool.byParent[parentHash]
+	for _, orphan := range children {
+		delete(pool.byHash, orphan.hash)
+		pool.release(orphan.source)
+	}
+	delete(pool.byParent, parentHash)
+
+	return children
+}
+
+func (pool *OrphanPool) remove(orphan *orphanBlock) {
+	delete(pool.byHash, orphan.hash)
+	pool.release(orphan.source)
+
+	parentHash := orphan.block.previousHash
+	siblings := pool.byParent[parentHash]
+	for i, sibling := range siblings {
+		if sibling == orphan {
+			siblings = append(siblings[:i], siblings[i+1:]...)
+			break
+		}
+	}
+	if len(siblings) == 0 {
+		delete(pool.byParent, parentHash)
+	} else {
+		pool.byParent[parentHash] = siblings
+	}
+}
+
+func (pool *OrphanPool) release(source string) {
+	if pool.bySource[source] -= 1; pool.bySource[source] <= 0 {
+		delete(pool.bySource, source)
+	}
+}
+
+// SetBlockFetcher sets how missing ancestors of orphans are requested
+func (blockchain *Blockchain) SetBlockFetcher(fetcher BlockFetcher) {
+	blockchain.mux.Lock()
+	defer blockchain.mux.Unlock()
+
+	blockchain.fetcher = fetcher
+}
+
+// addOrphan keeps the Block until its parent arrives and asks the
+// source for the parent, unless somebody already waits for it
+func (blockchain *Blockchain) addOrphan(block *Block, source string) error {
+	now := blockchain.now()
+	blockchain.orphans.Expire(now)
+
+	missing := block.previousHash
+	requested := len(blockchain.orphans.byParent[missing]) > 0
+	if !blockchain.orphans.Add(block, source, now) {
+		return Errorf(ERROR_ALREADY_KNOWN, "block %x is already known", block.Hash())
+	}
+
+	if !requested && blockchain.fetcher != nil && source != "" {
+		go blockchain.fetchAncestor(blockchain.fetcher, source, missing)
+	}
+
+	return fmt.Errorf("%w: parent %x is missing", ErrOrphanBlock, missing)
+}
+
+// fetchAncestor requests the missing Block from the source. When its
+// parent is missing too, adding it requests the next ancestor
+func (blockchain *Blockchain) fetchAncestor(fetcher BlockFetcher, source string, hash [32]byte) {
+	block, err := fetcher(source, hash)
+	if err != nil {
+		log.Printf("ERROR Fetching block %x from %s: %v", hash, source, err)
+		return
+	}
+	if block.Hash() != hash {
+		log.Printf("ERROR %s sent another block than %x", source, hash)
+		return
+	}
+
+	if err := blockchain.AddBlock(block, source); err != nil && !errors.Is(err, ErrOrphanBlock) {
+		log.Printf("ERROR Adding fetched block %x: %v", hash, err)
+	}
+}
+
+// connectOrphans adds the orphans waiting for the Block, and
+// the ones waiting for those in turn
+func (blockchain *Blockchain) connectOrphans(hash [32]byte) {
+	waiting := blockchain.orphans.take(hash)
+	for len(waiting) > 0 {
+		orphan := waiting[0]
+		waiting = waiting[1:]
+
+		if err := blockchain.addBlock(orphan.block, orphan.source); err != nil {
+			log.Printf("ERROR Connecting orphan %x: %v", orphan.hash, err)
+			continue
+		}
+		waiting = append(waiting, blockchain.orphans.take(orphan.hash)...)
+	}
+}
@@ -0,0 +1,192 @@
+package block
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+// orphanBlocks returns count blocks with unknown parents
+func orphanBlocks(count int) []*Block {
+	blocks := make([]*Block, 0, count)
+	for i := 0; i < count; i++ {
+		block := NewBlock(i, [32]byte{1, byte(i), byte(i >> 8)}, nil)
+		block.timestamp = TEST_CLOCK_START
+		blocks = append(blocks, block)
+	}
+
+	return blocks
+}
+
+func TestOrphanPoolLimits(t *testing.T) {
+	expiry := (ORPHAN_EXPIRY_SEC * time.Second).Nanoseconds()
+
+	cases := []struct {
+		name string
+		// sources lists the source of every orphan, added a second apart
+		sources []string
+		now     int64
+		kept    int
+		// evicted lists the indexes of the orphans dropped
+		evicted []int
+	}{
+		{
+			name:    "per source cap",
+			sources: repeatSources([]string{"a"}, MAX_ORPHANS_PER_SOURCE+1),
+			kept:    MAX_ORPHANS_PER_SOURCE,
+			evicted: []int{0},
+		},
+		{
+			name:    "per source cap leaves other sources alone",
+			sources: append([]string{"b"}, repeatSources([]string{"a"}, MAX_ORPHANS_PER_SOURCE+1)...),
+			kept:    MAX_ORPHANS_PER_SOURCE + 1,
+			evicted: []int{1},
+		},
+		{
+			name:    "total cap",
+			sources: repeatSources([]string{"a", "b", "c", "d", "e", "f"}, MAX_ORPHAN_BLOCKS+1),
+			kept:    MAX_ORPHAN_BLOCKS,
+			evicted: []int{0},
+		},
+		{
+			name:    "expiry",
+			sources: []string{"a", "b"},
+			now:     expiry + time.Second.Nanoseconds(),
+			kept:    1,
+			evicted: []int{0},
+		},
+		{
+			name:    "expiry keeps the younger ones",
+			sources: []string{"a", "b"},
+			now:     expiry,
+			kept:    2,
+		},
+	}
+
+	for _, test := range cases {
+		t.Run(test.name, func(t *testing.T) {
+			pool := NewOrphanPool(MAX_ORPHAN_BLOCKS, MAX_ORPHANS_PER_SOURCE, time.Second*ORPHAN_EXPIRY_SEC)
+			blocks := orphanBlocks(len(test.sources))
+			for i, source := range test.sources {
+				if !pool.Add(blocks[i], source, int64(i)*time.Second.Nanoseconds()) {
+					t.Fatalf("orphan %d was refused", i)
+				}
+			}
+			if test.now != 0 {
+				pool.Expire(test.now)
+			}
+
+			if pool.Len() != test.kept {
+				t.Errorf("kept %d orphans, want %d", pool.Len(), test.kept)
+			}
+			for _, index := range test.evicted {
+				if pool.Has(blocks[index].Hash()) {
+					t.Errorf("orphan %d is still kept", index)
+				}
+			}
+		})
+	}
+}
+
+// repeatSources returns count sources taking turns from the list
+func repeatSources(sources []string, count int) []string {
+	repeated := make([]string, 0, count)
+	for i := 0; i < count; i++ {
+		repeated = append(repeated, sources[i%len(sources)])
+	}
+
+	return repeated
+}
+
+func TestConnectOrphans(t *testing.T) {
+	cases := []struct {
+		name  string
+		order []int
+		// orphaned tells for every arrival whether the Block waits
+		orphaned []bool
+	}{
+		{"in order", []int{0, 1, 2}, []bool{false, false, false}},
+		{"parent last", []int{1, 2, 0}, []bool{true, true, false}},
+		{"reversed", []int{2, 1, 0}, []bool{true, true, false}},
+	}
+
+	for _, test := range cases {
+		t.Run(test.name, func(t *testing.T) {
+			blockchain := newTestChain(t, testChainConfig(LEDGER_MODE_ACCOUNT))
+			blocks := sideBlocks(t, blockchain, 0, 3)
+
+			for i, index := range test.order {
+				err := blockchain.AddBlock(blocks[index], "")
+				if orphaned := errors.Is(err, ErrOrphanBlock); orphaned != test.orphaned[i] || err != nil && !orphaned {
+					t.Fatalf("added block %d with %v, want orphaned %t", index, err, test.orphaned[i])
+				}
+			}
+
+			if blockchain.LastBlock() != blocks[2] || blockchain.orphans.Len() != 0 {
+				t.Errorf("the chain has %d blocks and %d orphans are left", len(blockchain.chain), blockchain.orphans.Len())
+			}
+		})
+	}
+}
+
+func TestOrphanAncestorsFetched(t *testing.T) {
+	cases := []struct {
+		name    string
+		source  string
+		fetches int
+	}{
+		{"from the source", "peer", 2},
+		{"without a source", "", 0},
+	}
+
+	for _, test := range cases {
+		t.Run(test.name, func(t *testing.T) {
+			blockchain := newTestChain(t, testChainConfig(LEDGER_MODE_ACCOUNT))
+			blocks := sideBlocks(t, blockchain, 0, 3)
+
+			var mux sync.Mutex
+			fetched := make([]string, 0)
+			blockchain.SetBlockFetcher(func(source string, hash [32]byte) (*Block, error) {
+				mux.Lock()
+				fetched = append(fetched, source)
+				mux.Unlock()
+
+				for _, block := range blocks {
+					if block.Hash() == hash {
+						return block, nil
+					}
+				}
+				return nil, fmt.Errorf("block %x is unknown", hash)
+			})
+
+			if err := blockchain.AddBlock(blocks[2], test.source); !errors.Is(err, ErrOrphanBlock) {
+				t.Fatalf("added with %v, want an orphan", err)
+			}
+			// Without a source nothing is fetched, so there is nothing to wait for
+			for deadline := time.Now().Add(5 * time.Second); test.fetches > 0; time.Sleep(time.Millisecond) {
+				if head, _ := blockchain.Head(); head == blocks[2] {
+					break
+				}
+				if time.Now().After(deadline) {
+					t.Fatal("the missing ancestors were never connected")
+				}
+			}
+
+			mux.Lock()
+			defer mux.Unlock()
+			if len(fetched) != test.fetches {
+				t.Errorf("fetched %d blocks, want %d", len(fetched), test.fetches)
+			}
+			for _, source := range fetched {
+				if source != test.source {
+					t.Errorf("fetched from %s, want %s", source, test.source)
+				}
+			}
+			if head, _ := blockchain.Head(); test.fetches == 0 && head == blocks[2] {
+				t.Error("connected the orphan without fetching its ancestors")
+			}
+		})
+	}
+}
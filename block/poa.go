@@ -0,0 +1,120 @@
+package block
+
+import (
+	"crypto-blockchain/utils"
+	"errors"
+	"fmt"
+)
+
+// ProofOfAuthorityEngine lets a fixed set of authority keys take turns
+// sealing blocks, the authority at index height % len(authorities)
+// signing the block at that height. Nobody else may seal a block
+type ProofOfAuthorityEngine struct {
+	signer      utils.Signer
+	authorities []utils.Verifier
+}
+
+// NewProofOfAuthorityEngine generates and returns new ProofOfAuthorityEngine.
+// The signer may be nil for nodes which only verify blocks
+func NewProofOfAuthorityEngine(signer utils.Signer, authorities []utils.Verifier) (*ProofOfAuthorityEngine, error) {
+	if len(authorities) == 0 {
+		return nil, errors.New("proof of authority needs at least one authority")
+	}
+
+	seen := make(map[string]bool)
+	for _, authority := range authorities {
+		address := utils.AddressFromPublicKey(authority)
+		if seen[address] {
+			return nil, fmt.Errorf("authority %s is listed twice", address)
+		}
+		seen[address] = true
+	}
+
+	return &ProofOfAuthorityEngine{signer, authorities}, nil
+}
+
+func (engine *ProofOfAuthorityEngine) Type() ConsensusType {
+	return CONSENSUS_POA
+}
+
+// Authorities returns the keys allowed to seal blocks, in turn order
+func (engine *ProofOfAuthorityEngine) Authorities() []utils.Verifier {
+	return engine.authorities
+}
+
+// InTurn returns the authority sealing the Block at the height
+func (engine *ProofOfAuthorityEngine) InTurn(height int) utils.Verifier {
+	return engine.authorities[height%len(engine.authorities)]
+}
+
+// Validators returns the authorities, each weighted the same
+func (engine *ProofOfAuthorityEngine) Validators(chain []*Block) []*Validator {
+	validators := make([]*Validator, len(engine.authorities))
+	for i, authority := range engine.authorities {
+		validators[i] = &Validator{
+			address:   utils.AddressFromPublicKey(authority),
+			publicKey: authority,
+			stake:     1,
+		}
+	}
+
+	return validators
+}
+
+// Prepare fails unless this node's key is the authority in turn
+func (engine *ProofOfAuthorityEngine) Prepare(chain []*Block, block *Block) error {
+	if engine.signer == nil {
+		return errors.New("node has no authority key")
+	}
+
+	inTurn := utils.AddressFromPublicKey(engine.InTurn(len(chain)))
+	if utils.AddressFromPublicKey(engine.signer.Verifier()) != inTurn {
+		return fmt.Errorf("block %d is sealed by %s", len(chain), inTurn)
+	}
+
+	block.sealer = engine.signer.Verifier()
+	return nil
+}
+
+// Seal signs the Block with the authority's key
+func (engine *ProofOfAuthorityEngine) Seal(chain []*Block, block *Block) error {
+	sealHash := block.SealHash()
+	signature, err := engine.signer.Sign(sealHash[:])
+	if err != nil {
+		return err
+	}
+
+	block.signature = signature
+	return nil
+}
+
+// VerifySeal checks that the authority in turn signed the Block
+func (engine *ProofOfAuthorityEngine) VerifySeal(chain []*Block, block *Block) error {
+	if block.sealer == nil || block.signature == nil {
+		return errors.New("block is not signed")
+	}
+
+	sealer := utils.AddressFromPublicKey(block.sealer)
+	inTurn := utils.AddressFromPublicKey(engine.InTurn(len(chain)))
+	if sealer != inTurn {
+		for _, authority := range engine.authorities {
+			if utils.AddressFromPublicKey(authority) == sealer {
+				return fmt.Errorf("authority %s sealed out of turn, %s is in turn", sealer, inTurn)
+			}
+		}
+
+		return fmt.Errorf("%s is not an authority", sealer)
+	}
+
+	sealHash := block.SealHash()
+	if !block.sealer.Verify(sealHash[:], block.signature) {
+		return errors.New("invalid block signature")
+	}
+
+	return nil
+}
+
+// ForkChoice prefers the longer chain, every block counting the same
+func (engine *ProofOfAuthorityEngine) ForkChoice(current []*Block, candidate []*Block) bool {
+	return len(candidate) > len(current)
+}
@@ -0,0 +1,234 @@
+package block
+
+import (
+	"crypto-blockchain/utils"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"sort"
+)
+
+// ProofOfStakeEngine lets validators take turns proposing blocks with a
+// chance proportional to their stake. Coins sent to STAKING_ADDRESS are
+// bonded to the sender for good, and the proposer signs its block.
+// Until anybody has staked, the bootstrap key proposes every block
+type ProofOfStakeEngine struct {
+	signer    utils.Signer
+	bootstrap utils.Verifier
+}
+
+// Validator is a key allowed to propose blocks, weighted by its stake
+type Validator struct {
+	address   string
+	publicKey utils.Verifier
+	stake     float32
+}
+
+const (
+	STAKING_ADDRESS = "STAKING"
+
+	// Stakes are compared in these units to avoid float rounding
+	STAKE_UNITS = 1e8
+
+	// Proposers are picked from a seed fixed an epoch ahead
+	POS_EPOCH_LENGTH = 32
+)
+
+// NewProofOfStakeEngine generates and returns new ProofOfStakeEngine.
+// The signer may be nil for nodes which only verify blocks
+func NewProofOfStakeEngine(signer utils.Signer, bootstrap utils.Verifier) *ProofOfStakeEngine {
+	return &ProofOfStakeEngine{signer, bootstrap}
+}
+
+func (validator *Validator) Address() string {
+	return validator.address
+}
+
+func (validator *Validator) Stake() float32 {
+	return validator.stake
+}
+
+func (validator *Validator) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Address   string        `json:"address"`
+		PublicKey string        `json:"publicKey"`
+		KeyType   utils.KeyType `json:"keyType"`
+		Stake     float32       `json:"stake"`
+	}{
+		Address:   validator.address,
+		PublicKey: validator.publicKey.String(),
+		KeyType:   validator.publicKey.KeyType(),
+		Stake:     validator.stake,
+	})
+}
+
+func (engine *ProofOfStakeEngine) Type() ConsensusType {
+	return CONSENSUS_POS
+}
+
+// Validators returns the validator set for the Block after the chain,
+// ordered by address. Only single-key senders can sign blocks, so
+// stake bonded by multisig or script spends is not counted
+func (engine *ProofOfStakeEngine) Validators(chain []*Block) []*Validator {
+	byAddress := make(map[string]*Validator)
+	for _, block := range chain {
+		for _, transaction := range block.transactions {
+			if transaction.senderPublicKey == nil {
+				continue
+			}
+
+			for _, output := range transaction.Outputs() {
+				if output.address != STAKING_ADDRESS {
+					continue
+				}
+
+				validator, ok := byAddress[transaction.senderAddress]
+				if !ok {
+					validator = &Validator{address: transaction.senderAddress, publicKey: transaction.senderPublicKey}
+					byAddress[transaction.senderAddress] = validator
+				}
+				validator.stake += output.value
+			}
+		}
+	}
+
+	if len(byAddress) == 0 {
+		return []*Validator{{
+			address:   utils.AddressFromPublicKey(engine.bootstrap),
+			publicKey: engine.bootstrap,
+			stake:     1,
+		}}
+	}
+
+	validators := make([]*Validator, 0, len(byAddress))
+	for _, validator := range byAddress {
+		validators = append(validators, validator)
+	}
+	sort.Slice(validators, func(i, j int) bool {
+		return validators[i].address < validators[j].address
+	})
+
+	return validators
+}
+
+// Proposer picks the validator proposing the Block after the chain.
+// The last proposer could grind a seed taken from its own Block, so the
+// pick is seeded by the height and the last Block two epochs back, and
+// weighted by the stakes bonded up to it. That fixes every pick of an
+// epoch before the previous epoch starts
+func (engine *ProofOfStakeEngine) Proposer(chain []*Block) *Validator {
+	seedBlock := seedHeight(len(chain))
+	validators := engine.Validators(chain[:seedBlock+1])
+
+	var total uint64
+	units := make([]uint64, len(validators))
+	for i, validator := range validators {
+		units[i] = uint64(math.Round(float64(validator.stake) * STAKE_UNITS))
+		total += units[i]
+	}
+	if total == 0 {
+		return validators[0]
+	}
+
+	seed := sha256.New()
+	seedHash := chain[seedBlock].Hash()
+	seed.Write(seedHash[:])
+	binary.Write(seed, binary.BigEndian, uint64(len(chain)))
+
+	pick := new(big.Int).SetBytes(seed.Sum(nil))
+	pick.Mod(pick, new(big.Int).SetUint64(total))
+
+	ticket := pick.Uint64()
+	for i, validator := range validators {
+		if ticket < units[i] {
+			return validator
+		}
+		ticket -= units[i]
+	}
+
+	return validators[len(validators)-1]
+}
+
+// seedHeight returns the height of the Block seeding the pick of the
+// proposer at the height, the last one of the epoch before the previous
+// one. The first two epochs are seeded by the genesis block
+func seedHeight(height int) int {
+	epochStart := height - height%POS_EPOCH_LENGTH
+	if epochStart < 2*POS_EPOCH_LENGTH {
+		return 0
+	}
+
+	return epochStart - POS_EPOCH_LENGTH - 1
+}
+
+// Prepare fails unless this node's key is the proposer of the Block
+func (engine *ProofOfStakeEngine) Prepare(chain []*Block, block *Block) error {
+	if engine.signer == nil {
+		return errors.New("node has no validator key")
+	}
+
+	proposer := engine.Proposer(chain)
+	if utils.AddressFromPublicKey(engine.signer.Verifier()) != proposer.address {
+		return fmt.Errorf("block %d is proposed by %s", len(chain), proposer.address)
+	}
+
+	block.sealer = engine.signer.Verifier()
+	return nil
+}
+
+// Seal signs the Block with the proposer's key
+func (engine *ProofOfStakeEngine) Seal(chain []*Block, block *Block) error {
+	sealHash := block.SealHash()
+	signature, err := engine.signer.Sign(sealHash[:])
+	if err != nil {
+		return err
+	}
+
+	block.signature = signature
+	return nil
+}
+
+// VerifySeal checks that the proposer of the height signed the Block
+func (engine *ProofOfStakeEngine) VerifySeal(chain []*Block, block *Block) error {
+	if block.sealer == nil || block.signature == nil {
+		return errors.New("block is not signed")
+	}
+
+	proposer := engine.Proposer(chain)
+	if utils.AddressFromPublicKey(block.sealer) != proposer.address {
+		return fmt.Errorf("block is sealed by %s instead of %s",
+			utils.AddressFromPublicKey(block.sealer), proposer.address)
+	}
+
+	sealHash := block.SealHash()
+	if !block.sealer.Verify(sealHash[:], block.signature) {
+		return errors.New("invalid block signature")
+	}
+
+	return nil
+}
+
+// ForkChoice prefers the longer chain, every block counting the same
+func (engine *ProofOfStakeEngine) ForkChoice(current []*Block, candidate []*Block) bool {
+	return len(candidate) > len(current)
+}
+
+// Validators returns the validator set of the next Block when
+// the ConsensusEngine has one
+func (blockchain *Blockchain) Validators() ([]*Validator, bool) {
+	blockchain.mux.Lock()
+	defer blockchain.mux.Unlock()
+
+	engine, ok := blockchain.engine.(interface {
+		Validators(chain []*Block) []*Validator
+	})
+	if !ok {
+		return nil, false
+	}
+
+	return engine.Validators(blockchain.chain), true
+}
@@ -0,0 +1,114 @@
+package block
+
+import (
+	"math"
+	"testing"
+)
+
+// stakedChain returns a chain of the length whose block at the height
+// bonds the stakes of the keys
+func stakedChain(t *testing.T, keys []*testKey, stakes []float32, height int, length int) []*Block {
+	t.Helper()
+	chain := make([]*Block, 0, length)
+	for len(chain) < length {
+		var transactions []*Transaction
+		if len(chain) == height {
+			for i, key := range keys {
+				transactions = append(transactions, key.sign(t, NewTransaction(key.address, STAKING_ADDRESS, stakes[i])))
+			}
+		}
+
+		var previousHash [32]byte
+		if len(chain) > 0 {
+			previousHash = chain[len(chain)-1].Hash()
+		}
+		block := NewBlock(0, previousHash, transactions)
+		block.timestamp = int64(TEST_CLOCK_START + len(chain))
+		chain = append(chain, block)
+	}
+
+	return chain
+}
+
+func TestProposerFollowsStake(t *testing.T) {
+	const picks = 4000
+
+	cases := []struct {
+		name   string
+		stakes []float32
+	}{
+		{"equal stakes", []float32{1, 1}},
+		{"three to one", []float32{1, 3}},
+		{"uneven", []float32{2, 1, 0.5, 0.5}},
+	}
+
+	for _, test := range cases {
+		t.Run(test.name, func(t *testing.T) {
+			keys := make([]*testKey, len(test.stakes))
+			var total float32
+			for i, stake := range test.stakes {
+				keys[i] = newTestKey(t)
+				total += stake
+			}
+			engine := NewProofOfStakeEngine(nil, newTestKey(t).signer.Verifier())
+			chain := stakedChain(t, keys, test.stakes, 0, picks)
+
+			picked := make(map[string]int)
+			for height := 1; height <= picks; height++ {
+				picked[engine.Proposer(chain[:height]).address]++
+			}
+			for i, key := range keys {
+				share := float64(picked[key.address]) / picks
+				if want := float64(test.stakes[i] / total); math.Abs(share-want) > 0.05 {
+					t.Errorf("validator %d proposed %.3f of the blocks, want %.3f", i, share, want)
+				}
+			}
+		})
+	}
+}
+
+func TestProposerSeed(t *testing.T) {
+	keys := []*testKey{newTestKey(t), newTestKey(t)}
+	bootstrap := newTestKey(t)
+	engine := NewProofOfStakeEngine(nil, bootstrap.signer.Verifier())
+	chain := stakedChain(t, keys, []float32{1, 1}, 1, 4*POS_EPOCH_LENGTH)
+
+	cases := []struct {
+		name string
+		// edit changes the last Block before the height
+		edit func(block *Block)
+	}{
+		{"another last block", func(block *Block) { block.nonce++ }},
+		{"another timestamp", func(block *Block) { block.timestamp++ }},
+		{
+			name: "stake bonded in the last block",
+			edit: func(block *Block) {
+				staker := newTestKey(t)
+				block.transactions = append(block.transactions, staker.sign(t, NewTransaction(staker.address, STAKING_ADDRESS, 1000)))
+			},
+		},
+	}
+
+	for _, test := range cases {
+		t.Run(test.name, func(t *testing.T) {
+			// Nobody proposes the genesis block, so the edits start above it
+			for height := 2; height < len(chain); height++ {
+				last := *chain[height-1]
+				test.edit(&last)
+				edited := append(append([]*Block{}, chain[:height-1]...), &last)
+
+				if proposer, want := engine.Proposer(edited), engine.Proposer(chain[:height]); proposer.address != want.address {
+					t.Fatalf("block %d is proposed by %s, want %s whatever the last block", height, proposer.address, want.address)
+				}
+			}
+		})
+	}
+
+	// The stake of the first block counts once the block seeds the pick
+	for height := 1; height < len(chain); height++ {
+		bootstrapped := engine.Proposer(chain[:height]).address == bootstrap.address
+		if want := seedHeight(height) == 0; bootstrapped != want {
+			t.Errorf("block %d is proposed by the bootstrap key: %t, want %t", height, bootstrapped, want)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package block
+
+type GenerateRequest struct {
+	Blocks  *int    `json:"blocks"`
+	Address *string `json:"address"`
+}
+
+const (
+	REGTEST_CHAIN_ID    = "regtest"
+	MAX_GENERATE_BLOCKS = 1000
+)
+
+// Validate checks that all fields are not nil
+func (generateRequest *GenerateRequest) Validate() bool {
+	return generateRequest.Blocks != nil && generateRequest.Address != nil
+}
+
+// Generate mines the blocks one after another right away, paying every
+// coinbase to the address. It stops at the first Block that can't be
+// mined and returns the ones mined before it. Only regtest chains,
+// which run on a MockClock, generate blocks
+func (blockchain *Blockchain) Generate(count int, address string) ([]*Block, error) {
+	if !blockchain.IsRegtest() {
+		return nil, NewError(ERROR_INVALID_REQUEST, "blocks are only generated in regtest mode")
+	}
+	if count < 1 || count > MAX_GENERATE_BLOCKS {
+		return nil, Errorf(ERROR_INVALID_REQUEST, "between 1 and %d blocks can be generated at once", MAX_GENERATE_BLOCKS)
+	}
+	if address == "" {
+		return nil, NewError(ERROR_INVALID_REQUEST, "address must not be empty")
+	}
+
+	blockchain.mux.Lock()
+	defer blockchain.mux.Unlock()
+
+	blocks := make([]*Block, 0, count)
+	for len(blocks) < count {
+		block, err := blockchain.mine(address)
+		if err != nil {
+			return blocks, Errorf(ERROR_MINING_FAILED, "block %d: %w", len(blockchain.chain), err)
+		}
+		blocks = append(blocks, block)
+	}
+
+	return blocks, nil
+}
+
+// IsRegtest tells whether the Blockchain runs on a MockClock
+func (blockchain *Blockchain) IsRegtest() bool {
+	_, ok := blockchain.clock.(*MockClock)
+	return ok
+}
@@ -0,0 +1,101 @@
+package block
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+)
+
+// IsCancellation tells whether the Transaction only cancels the pending
+// Transaction it replaces, paying nothing itself
+func (transaction *Transaction) IsCancellation() bool {
+	return transaction.replaces != nil &&
+		transaction.recipientAddress == "" &&
+		len(transaction.inputs) == 0 &&
+		len(transaction.outputs) == 0
+}
+
+func (transaction *Transaction) replacesStr() string {
+	if transaction.replaces == nil {
+		return ""
+	}
+
+	return hex.EncodeToString(transaction.replaces[:])
+}
+
+// Replaces returns the ID of the pending Transaction this one supersedes
+func (transaction *Transaction) Replaces() ([32]byte, bool) {
+	if transaction.replaces == nil {
+		return [32]byte{}, false
+	}
+
+	return *transaction.replaces, true
+}
+
+// replaceTransaction supersedes or cancels a pending Transaction of the
+// same sender. A replacement has to pay a higher fee than the original
+// and is verified as if the original had never been pending. When it
+// fails, the original stays in mempool
+func (blockchain *Blockchain) replaceTransaction(transaction *Transaction) error {
+	original, ok := blockchain.mempool.Get(*transaction.replaces)
+	if !ok {
+		return Errorf(ERROR_NOT_FOUND, "replaced transaction %x is not pending", *transaction.replaces)
+	}
+	if err := verifyReplacement(original, transaction); err != nil {
+		return fmt.Errorf("replacing transaction %x: %w", *transaction.replaces, err)
+	}
+	if !blockchain.verifyAuthorisation(transaction) {
+		return NewError(ERROR_INVALID_SIGNATURE, "transaction is not signed by the sender")
+	}
+
+	entry, _ := blockchain.mempool.take(*transaction.replaces)
+	if transaction.IsCancellation() {
+		return nil
+	}
+
+	if err := blockchain.verifyLedger(blockchain.tipState(), transaction); err != nil {
+		blockchain.mempool.insert(entry)
+		return WrapError(ERROR_INVALID_TRANSACTION, err)
+	}
+	if err := blockchain.mempool.Add(transaction, blockchain.now()); err != nil {
+		blockchain.mempool.insert(entry)
+		return err
+	}
+
+	blockchain.notifyTransaction(transaction)
+	return nil
+}
+
+// verifyReplacement checks that the replacement comes from the sender
+// of the original, signed by the same key
+func verifyReplacement(original *Transaction, replacement *Transaction) error {
+	if original.senderAddress != replacement.senderAddress {
+		return Errorf(ERROR_INVALID_SIGNATURE, "only %s may replace the transaction", original.senderAddress)
+	}
+
+	if original.senderPublicKey != nil {
+		if replacement.senderPublicKey == nil ||
+			!bytes.Equal(original.senderPublicKey.Bytes(), replacement.senderPublicKey.Bytes()) {
+			return NewError(ERROR_INVALID_SIGNATURE, "replacement must be signed by the key of the original")
+		}
+	}
+
+	if !replacement.IsCancellation() && replacement.fee <= original.fee {
+		return Errorf(ERROR_INSUFFICIENT_FEE, "replacement fee %.8f must exceed %.8f", replacement.fee, original.fee)
+	}
+
+	return nil
+}
+
+// decodeTransactionId decodes a hex-encoded transaction ID
+func decodeTransactionId(str string) (*[32]byte, error) {
+	decoded, err := hex.DecodeString(str)
+	if err != nil || len(decoded) != 32 {
+		return nil, fmt.Errorf("invalid transaction ID %q", str)
+	}
+
+	var transactionId [32]byte
+	copy(transactionId[:], decoded)
+
+	return &transactionId, nil
+}
@@ -0,0 +1,144 @@
+package block
+
+import (
+	"testing"
+)
+
+// utxoPayment returns the Transaction of the key spending the first output
+// of the funding transaction into the value to the recipient, paying the fee
+func utxoPayment(t *testing.T, blockchain *Blockchain, key *testKey, funding *Transaction, value float32, fee float32, replaces *[32]byte) *Transaction {
+	t.Helper()
+	return key.transfer(t, blockchain, "recipient", 0, func(transaction *Transaction) {
+		transaction.inputs = []*OutPoint{NewOutPoint(funding.Hash(), 0)}
+		transaction.outputs = []*TxOutput{NewTxOutput("recipient", value)}
+		transaction.fee = fee
+		transaction.replaces = replaces
+	})
+}
+
+// cancellation returns the Transaction of the key cancelling the pending one
+func cancellation(t *testing.T, blockchain *Blockchain, key *testKey, original *Transaction) *Transaction {
+	t.Helper()
+	replaced := original.Hash()
+	return key.transfer(t, blockchain, "", 0, func(transaction *Transaction) {
+		transaction.replaces = &replaced
+	})
+}
+
+func TestReplaceTransaction(t *testing.T) {
+	cases := []struct {
+		name string
+		// replacement returns the Transaction submitted after the original
+		replacement func(t *testing.T, blockchain *Blockchain, sender *testKey, funding *Transaction, original *Transaction) *Transaction
+		code        ErrorCode
+		// replaced tells whether the original is gone afterwards
+		replaced bool
+	}{
+		{
+			name: "higher fee",
+			replacement: func(t *testing.T, blockchain *Blockchain, sender *testKey, funding *Transaction, original *Transaction) *Transaction {
+				replaced := original.Hash()
+				return utxoPayment(t, blockchain, sender, funding, 0.5, 0.2, &replaced)
+			},
+			replaced: true,
+		},
+		{
+			name: "same fee",
+			replacement: func(t *testing.T, blockchain *Blockchain, sender *testKey, funding *Transaction, original *Transaction) *Transaction {
+				replaced := original.Hash()
+				return utxoPayment(t, blockchain, sender, funding, 0.4, 0.1, &replaced)
+			},
+			code: ERROR_INSUFFICIENT_FEE,
+		},
+		{
+			name: "missing original",
+			replacement: func(t *testing.T, blockchain *Blockchain, sender *testKey, funding *Transaction, original *Transaction) *Transaction {
+				return utxoPayment(t, blockchain, sender, funding, 0.5, 0.2, &[32]byte{1})
+			},
+			code: ERROR_NOT_FOUND,
+		},
+		{
+			name: "another sender",
+			replacement: func(t *testing.T, blockchain *Blockchain, sender *testKey, funding *Transaction, original *Transaction) *Transaction {
+				replaced := original.Hash()
+				return utxoPayment(t, blockchain, newTestKey(t), funding, 0.5, 0.2, &replaced)
+			},
+			code: ERROR_INVALID_SIGNATURE,
+		},
+		{
+			name: "replacement spending more than its inputs",
+			replacement: func(t *testing.T, blockchain *Blockchain, sender *testKey, funding *Transaction, original *Transaction) *Transaction {
+				replaced := original.Hash()
+				return utxoPayment(t, blockchain, sender, funding, 5, 0.2, &replaced)
+			},
+			code: ERROR_INSUFFICIENT_FUNDS,
+		},
+		{
+			name: "conflicting spend replacing nothing",
+			replacement: func(t *testing.T, blockchain *Blockchain, sender *testKey, funding *Transaction, original *Transaction) *Transaction {
+				return utxoPayment(t, blockchain, sender, funding, 0.5, 0.2, nil)
+			},
+			code: ERROR_DOUBLE_SPEND,
+		},
+		{
+			name: "cancellation",
+			replacement: func(t *testing.T, blockchain *Blockchain, sender *testKey, funding *Transaction, original *Transaction) *Transaction {
+				return cancellation(t, blockchain, sender, original)
+			},
+			replaced: true,
+		},
+	}
+
+	for _, test := range cases {
+		t.Run(test.name, func(t *testing.T) {
+			blockchain := newTestChain(t, testChainConfig(LEDGER_MODE_UTXO))
+			sender := newTestKey(t)
+			fund(t, blockchain, sender.address)
+			funding := blockchain.LastBlock().transactions[0]
+
+			original := utxoPayment(t, blockchain, sender, funding, 0.5, 0.1, nil)
+			if err := blockchain.SubmitTransaction(original); err != nil {
+				t.Fatal(err)
+			}
+
+			replacement := test.replacement(t, blockchain, sender, funding, original)
+			if err := blockchain.SubmitTransaction(replacement); errorCode(err) != test.code {
+				t.Fatalf("submitted with %v, want %q", err, test.code)
+			}
+
+			if _, _, pending := blockchain.FindTransaction(original.Hash()); pending == test.replaced {
+				t.Errorf("the original is pending: %t", pending)
+			}
+			_, _, pending := blockchain.FindTransaction(replacement.Hash())
+			if want := test.code == "" && !replacement.IsCancellation(); pending != want {
+				t.Errorf("the replacement is pending: %t, want %t", pending, want)
+			}
+		})
+	}
+}
+
+func TestCancellationFreesInputs(t *testing.T) {
+	blockchain := newTestChain(t, testChainConfig(LEDGER_MODE_UTXO))
+	sender := newTestKey(t)
+	fund(t, blockchain, sender.address)
+	funding := blockchain.LastBlock().transactions[0]
+
+	original := utxoPayment(t, blockchain, sender, funding, 0.5, 0.1, nil)
+	if err := blockchain.SubmitTransaction(original); err != nil {
+		t.Fatal(err)
+	}
+	if err := blockchain.SubmitTransaction(cancellation(t, blockchain, sender, original)); err != nil {
+		t.Fatal(err)
+	}
+
+	// The cancelled input is free again, even for a cheaper spend
+	respend := utxoPayment(t, blockchain, sender, funding, 0.9, 0, nil)
+	if err := blockchain.SubmitTransaction(respend); err != nil {
+		t.Fatalf("re-spending the input of the cancelled transaction failed with %v", err)
+	}
+
+	fund(t, blockchain, TEST_MINER)
+	if _, height, _ := blockchain.FindTransaction(respend.Hash()); height != len(blockchain.chain)-1 {
+		t.Errorf("the re-spend is at height %d, want it mined", height)
+	}
+}
@@ -0,0 +1,799 @@
+package block
+
+import (
+	"bytes"
+	"crypto-blockchain/utils"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/ripemd160"
+)
+
+// Script is a program for the small stack machine guarding UTXO spending.
+// Lock scripts live in outputs, unlock scripts in the inputs spending them.
+// The unlock script may only push data, then the lock script runs on the
+// resulting stack and the spending is valid when it leaves true on top
+type Script []byte
+
+type Opcode byte
+
+const (
+	OP_0         Opcode = 0x00
+	OP_PUSHDATA1 Opcode = 0x4c
+	OP_PUSHDATA2 Opcode = 0x4d
+	OP_1NEGATE   Opcode = 0x4f
+	OP_1         Opcode = 0x51
+	OP_16        Opcode = 0x60
+
+	OP_NOP    Opcode = 0x61
+	OP_IF     Opcode = 0x63
+	OP_NOTIF  Opcode = 0x64
+	OP_ELSE   Opcode = 0x67
+	OP_ENDIF  Opcode = 0x68
+	OP_VERIFY Opcode = 0x69
+	OP_RETURN Opcode = 0x6a
+
+	OP_DROP Opcode = 0x75
+	OP_DUP  Opcode = 0x76
+	OP_SWAP Opcode = 0x7c
+	OP_SIZE Opcode = 0x82
+
+	OP_EQUAL       Opcode = 0x87
+	OP_EQUALVERIFY Opcode = 0x88
+
+	OP_SHA256  Opcode = 0xa8
+	OP_HASH160 Opcode = 0xa9
+	OP_HASH256 Opcode = 0xaa
+
+	OP_CHECKSIG            Opcode = 0xac
+	OP_CHECKSIGVERIFY      Opcode = 0xad
+	OP_CHECKMULTISIG       Opcode = 0xae
+	OP_CHECKMULTISIGVERIFY Opcode = 0xaf
+
+	OP_CHECKLOCKTIMEVERIFY   Opcode = 0xb1
+	OP_CHECKLOCKHEIGHTVERIFY Opcode = 0xb2
+)
+
+const (
+	MAX_SCRIPT_SIZE         = 10000
+	MAX_SCRIPT_OPS          = 201
+	MAX_SCRIPT_STACK_SIZE   = 1000
+	MAX_SCRIPT_ELEMENT_SIZE = 520
+	MAX_SCRIPT_NUM_SIZE     = 8
+)
+
+var opcodeNames = map[Opcode]string{
+	OP_0:                     "OP_0",
+	OP_PUSHDATA1:             "OP_PUSHDATA1",
+	OP_PUSHDATA2:             "OP_PUSHDATA2",
+	OP_1NEGATE:               "OP_1NEGATE",
+	OP_NOP:                   "OP_NOP",
+	OP_IF:                    "OP_IF",
+	OP_NOTIF:                 "OP_NOTIF",
+	OP_ELSE:                  "OP_ELSE",
+	OP_ENDIF:                 "OP_ENDIF",
+	OP_VERIFY:                "OP_VERIFY",
+	OP_RETURN:                "OP_RETURN",
+	OP_DROP:                  "OP_DROP",
+	OP_DUP:                   "OP_DUP",
+	OP_SWAP:                  "OP_SWAP",
+	OP_SIZE:                  "OP_SIZE",
+	OP_EQUAL:                 "OP_EQUAL",
+	OP_EQUALVERIFY:           "OP_EQUALVERIFY",
+	OP_SHA256:                "OP_SHA256",
+	OP_HASH160:               "OP_HASH160",
+	OP_HASH256:               "OP_HASH256",
+	OP_CHECKSIG:              "OP_CHECKSIG",
+	OP_CHECKSIGVERIFY:        "OP_CHECKSIGVERIFY",
+	OP_CHECKMULTISIG:         "OP_CHECKMULTISIG",
+	OP_CHECKMULTISIGVERIFY:   "OP_CHECKMULTISIGVERIFY",
+	OP_CHECKLOCKTIMEVERIFY:   "OP_CHECKLOCKTIMEVERIFY",
+	OP_CHECKLOCKHEIGHTVERIFY: "OP_CHECKLOCKHEIGHTVERIFY",
+}
+
+// Public keys inside scripts are prefixed with their KeyType
+var scriptKeyTypes = map[byte]utils.KeyType{
+	0x01: utils.KEY_TYPE_P256,
+	0x02: utils.KEY_TYPE_SECP256K1,
+	0x03: utils.KEY_TYPE_ED25519,
+}
+
+// ScriptContext is what a Script can see of the spending Transaction
+type ScriptContext struct {
+	signingHash [32]byte
+	lockHeight  int
+	lockTime    int64
+}
+
+// scriptEngine executes one Script on a shared stack
+type scriptEngine struct {
+	context    *ScriptContext
+	stack      [][]byte
+	conditions []bool
+	ops        int
+}
+
+// ScriptBuilder assembles a Script op by op
+type ScriptBuilder struct {
+	script Script
+}
+
+// NewScriptContext returns the ScriptContext of the Transaction
+func NewScriptContext(transaction *Transaction) *ScriptContext {
+	return &ScriptContext{
+		signingHash: transaction.SigningHash(),
+		lockHeight:  transaction.lockHeight,
+		lockTime:    transaction.lockTime,
+	}
+}
+
+// NewScriptBuilder generates and returns empty ScriptBuilder
+func NewScriptBuilder() *ScriptBuilder {
+	return &ScriptBuilder{Script{}}
+}
+
+// AddOp appends an opcode
+func (builder *ScriptBuilder) AddOp(opcode Opcode) *ScriptBuilder {
+	builder.script = append(builder.script, byte(opcode))
+	return builder
+}
+
+// AddData appends the smallest push of the data
+func (builder *ScriptBuilder) AddData(data []byte) *ScriptBuilder {
+	switch length := len(data); {
+	case length == 0:
+		builder.script = append(builder.script, byte(OP_0))
+	case length < int(OP_PUSHDATA1):
+		builder.script = append(builder.script, byte(length))
+	case length <= 0xff:
+		builder.script = append(builder.script, byte(OP_PUSHDATA1), byte(length))
+	default:
+		builder.script = append(builder.script, byte(OP_PUSHDATA2), byte(length), byte(length>>8))
+	}
+
+	builder.script = append(builder.script, data...)
+	return builder
+}
+
+// AddInt appends a number, small ones as OP_1 to OP_16
+func (builder *ScriptBuilder) AddInt(number int64) *ScriptBuilder {
+	switch {
+	case number == 0:
+		return builder.AddOp(OP_0)
+	case number == -1:
+		return builder.AddOp(OP_1NEGATE)
+	case number >= 1 && number <= 16:
+		return builder.AddOp(OP_1 + Opcode(number-1))
+	default:
+		return builder.AddData(encodeScriptNum(number))
+	}
+}
+
+// AddPublicKey appends the public key prefixed with its KeyType
+func (builder *ScriptBuilder) AddPublicKey(publicKey utils.Verifier) *ScriptBuilder {
+	return builder.AddData(EncodeScriptPublicKey(publicKey))
+}
+
+func (builder *ScriptBuilder) Script() Script {
+	return builder.script
+}
+
+// EncodeScriptPublicKey prefixes the raw public key with its KeyType tag
+func EncodeScriptPublicKey(publicKey utils.Verifier) []byte {
+	for tag, keyType := range scriptKeyTypes {
+		if keyType == publicKey.KeyType() {
+			return append([]byte{tag}, publicKey.Bytes()...)
+		}
+	}
+
+	return nil
+}
+
+func decodeScriptPublicKey(data []byte) (utils.Verifier, error) {
+	if len(data) == 0 {
+		return nil, errors.New("empty public key")
+	}
+
+	keyType, ok := scriptKeyTypes[data[0]]
+	if !ok {
+		return nil, fmt.Errorf("unknown key type tag %#x", data[0])
+	}
+
+	return utils.VerifierFromBytes(keyType, data[1:])
+}
+
+// NewHashTimeLockScript locks an output for an atomic swap: the recipient
+// can spend it by revealing the SHA-256 preimage of the hash, and the
+// refund key can take it back once the lock time has passed
+func NewHashTimeLockScript(
+	hash [32]byte,
+	recipient utils.Verifier,
+	refund utils.Verifier,
+	lockTime int64,
+) Script {
+	return NewScriptBuilder().
+		AddOp(OP_IF).
+		AddOp(OP_SHA256).AddData(hash[:]).AddOp(OP_EQUALVERIFY).
+		AddPublicKey(recipient).AddOp(OP_CHECKSIG).
+		AddOp(OP_ELSE).
+		AddInt(lockTime).AddOp(OP_CHECKLOCKTIMEVERIFY).AddOp(OP_DROP).
+		AddPublicKey(refund).AddOp(OP_CHECKSIG).
+		AddOp(OP_ENDIF).
+		Script()
+}
+
+// NewHashLockClaimScript unlocks a hash-time-locked output with the preimage
+func NewHashLockClaimScript(signature []byte, preimage []byte) Script {
+	return NewScriptBuilder().AddData(signature).AddData(preimage).AddInt(1).Script()
+}
+
+// NewHashLockRefundScript unlocks a hash-time-locked output after the lock time
+func NewHashLockRefundScript(signature []byte) Script {
+	return NewScriptBuilder().AddData(signature).AddInt(0).Script()
+}
+
+// ScriptAddress derives the address of the outputs locked by the Script
+func ScriptAddress(script Script) string {
+	return utils.ScriptAddress(script)
+}
+
+// ParseScript assembles a Script from its text form: opcode names,
+// 0x-prefixed hex data and decimal numbers separated by spaces
+func ParseScript(str string) (Script, error) {
+	builder := NewScriptBuilder()
+
+	for _, token := range strings.Fields(str) {
+		if strings.HasPrefix(token, "0x") {
+			data, err := hex.DecodeString(token[2:])
+			if err != nil {
+				return nil, fmt.Errorf("invalid data %q", token)
+			}
+			builder.AddData(data)
+			continue
+		}
+
+		if number, err := strconv.ParseInt(token, 10, 64); err == nil {
+			builder.AddInt(number)
+			continue
+		}
+
+		opcode, ok := opcodeByName(token)
+		if !ok {
+			return nil, fmt.Errorf("unknown opcode %q", token)
+		}
+		builder.AddOp(opcode)
+	}
+
+	return builder.Script(), nil
+}
+
+func opcodeByName(name string) (Opcode, bool) {
+	if name == "OP_FALSE" {
+		return OP_0, true
+	}
+	if name == "OP_TRUE" {
+		return OP_1, true
+	}
+	if strings.HasPrefix(name, "OP_") {
+		if number, err := strconv.Atoi(name[3:]); err == nil && number >= 1 && number <= 16 {
+			return OP_1 + Opcode(number-1), true
+		}
+	}
+
+	for opcode, opcodeName := range opcodeNames {
+		if opcodeName == name {
+			return opcode, true
+		}
+	}
+
+	return 0, false
+}
+
+// String disassembles the Script into the form ParseScript reads
+func (script Script) String() string {
+	tokens := make([]string, 0)
+
+	for pc := 0; pc < len(script); {
+		opcode, data, next, err := script.next(pc)
+		if err != nil {
+			tokens = append(tokens, "[error]")
+			break
+		}
+		pc = next
+
+		switch {
+		case data != nil:
+			tokens = append(tokens, "0x"+hex.EncodeToString(data))
+		case opcode >= OP_1 && opcode <= OP_16:
+			tokens = append(tokens, fmt.Sprintf("OP_%d", opcode-OP_1+1))
+		case opcodeNames[opcode] != "":
+			tokens = append(tokens, opcodeNames[opcode])
+		default:
+			tokens = append(tokens, fmt.Sprintf("[%#x]", byte(opcode)))
+		}
+	}
+
+	return strings.Join(tokens, " ")
+}
+
+// next decodes the op at pc, returning the pushed data for push ops
+// and the position of the following op
+func (script Script) next(pc int) (Opcode, []byte, int, error) {
+	opcode := Opcode(script[pc])
+	pc++
+
+	var length int
+	switch {
+	case opcode > OP_0 && opcode < OP_PUSHDATA1:
+		length = int(opcode)
+	case opcode == OP_PUSHDATA1:
+		if pc+1 > len(script) {
+			return 0, nil, 0, errors.New("truncated OP_PUSHDATA1")
+		}
+		length = int(script[pc])
+		pc += 1
+	case opcode == OP_PUSHDATA2:
+		if pc+2 > len(script) {
+			return 0, nil, 0, errors.New("truncated OP_PUSHDATA2")
+		}
+		length = int(binary.LittleEndian.Uint16(script[pc:]))
+		pc += 2
+	default:
+		return opcode, nil, pc, nil
+	}
+
+	if pc+length > len(script) {
+		return 0, nil, 0, errors.New("push past the end of the script")
+	}
+
+	return opcode, script[pc : pc+length], pc + length, nil
+}
+
+// isPushOnly checks that the Script does nothing but push data
+func (script Script) isPushOnly() bool {
+	for pc := 0; pc < len(script); {
+		opcode, data, next, err := script.next(pc)
+		if err != nil {
+			return false
+		}
+		if data == nil && opcode != OP_0 && opcode != OP_1NEGATE && !(opcode >= OP_1 && opcode <= OP_16) {
+			return false
+		}
+		pc = next
+	}
+
+	return true
+}
+
+// ExecuteScript runs the unlock Script followed by the lock Script
+// and succeeds when the lock Script leaves true on top of the stack
+func ExecuteScript(unlockScript Script, lockScript Script, context *ScriptContext) error {
+	if len(unlockScript) > MAX_SCRIPT_SIZE || len(lockScript) > MAX_SCRIPT_SIZE {
+		return fmt.Errorf("script is larger than %d bytes", MAX_SCRIPT_SIZE)
+	}
+	if !unlockScript.isPushOnly() {
+		return errors.New("unlock script may only push data")
+	}
+
+	engine := &scriptEngine{context: context, stack: make([][]byte, 0)}
+	if err := engine.execute(unlockScript); err != nil {
+		return fmt.Errorf("unlock script: %w", err)
+	}
+
+	engine.ops = 0
+	if err := engine.execute(lockScript); err != nil {
+		return fmt.Errorf("lock script: %w", err)
+	}
+
+	if len(engine.stack) == 0 || !castToBool(engine.stack[len(engine.stack)-1]) {
+		return errors.New("script evaluated to false")
+	}
+
+	return nil
+}
+
+func (engine *scriptEngine) execute(script Script) error {
+	engine.conditions = engine.conditions[:0]
+
+	for pc := 0; pc < len(script); {
+		opcode, data, next, err := script.next(pc)
+		if err != nil {
+			return err
+		}
+		pc = next
+
+		if len(data) > MAX_SCRIPT_ELEMENT_SIZE {
+			return fmt.Errorf("push is larger than %d bytes", MAX_SCRIPT_ELEMENT_SIZE)
+		}
+
+		if opcode > OP_16 {
+			engine.ops += 1
+			if engine.ops > MAX_SCRIPT_OPS {
+				return fmt.Errorf("script has more than %d ops", MAX_SCRIPT_OPS)
+			}
+		}
+
+		executing := engine.executing()
+		if !executing && (opcode < OP_IF || opcode > OP_ENDIF) {
+			continue
+		}
+
+		if err := engine.step(opcode, data, executing); err != nil {
+			return fmt.Errorf("%s: %w", opcodeNames[opcode], err)
+		}
+
+		if len(engine.stack) > MAX_SCRIPT_STACK_SIZE {
+			return fmt.Errorf("stack has more than %d items", MAX_SCRIPT_STACK_SIZE)
+		}
+	}
+
+	if len(engine.conditions) > 0 {
+		return errors.New("unbalanced conditional")
+	}
+
+	return nil
+}
+
+// executing tells whether every enclosing OP_IF branch is taken
+func (engine *scriptEngine) executing() bool {
+	for _, condition := range engine.conditions {
+		if !condition {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (engine *scriptEngine) step(opcode Opcode, data []byte, executing bool) error {
+	switch {
+	case data != nil:
+		engine.push(data)
+		return nil
+	case opcode == OP_0:
+		engine.push([]byte{})
+		return nil
+	case opcode == OP_1NEGATE:
+		engine.push(encodeScriptNum(-1))
+		return nil
+	case opcode >= OP_1 && opcode <= OP_16:
+		engine.push(encodeScriptNum(int64(opcode - OP_1 + 1)))
+		return nil
+	}
+
+	switch opcode {
+	case OP_NOP:
+
+	case OP_IF, OP_NOTIF:
+		condition := false
+		if executing {
+			top, err := engine.pop()
+			if err != nil {
+				return err
+			}
+			condition = castToBool(top) == (opcode == OP_IF)
+		}
+		engine.conditions = append(engine.conditions, condition)
+
+	case OP_ELSE:
+		if len(engine.conditions) == 0 {
+			return errors.New("OP_ELSE without OP_IF")
+		}
+		last := len(engine.conditions) - 1
+		engine.conditions[last] = !engine.conditions[last]
+
+	case OP_ENDIF:
+		if len(engine.conditions) == 0 {
+			return errors.New("OP_ENDIF without OP_IF")
+		}
+		engine.conditions = engine.conditions[:len(engine.conditions)-1]
+
+	case OP_VERIFY:
+		return engine.verify()
+
+	case OP_RETURN:
+		return errors.New("output is unspendable")
+
+	case OP_DROP:
+		_, err := engine.pop()
+		return err
+
+	case OP_DUP:
+		top, err := engine.peek()
+		if err != nil {
+			return err
+		}
+		engine.push(top)
+
+	case OP_SWAP:
+		first, err := engine.pop()
+		if err != nil {
+			return err
+		}
+		second, err := engine.pop()
+		if err != nil {
+			return err
+		}
+		engine.push(first)
+		engine.push(second)
+
+	case OP_SIZE:
+		top, err := engine.peek()
+		if err != nil {
+			return err
+		}
+		engine.push(encodeScriptNum(int64(len(top))))
+
+	case OP_EQUAL, OP_EQUALVERIFY:
+		first, err := engine.pop()
+		if err != nil {
+			return err
+		}
+		second, err := engine.pop()
+		if err != nil {
+			return err
+		}
+		engine.pushBool(bytes.Equal(first, second))
+		if opcode == OP_EQUALVERIFY {
+			return engine.verify()
+		}
+
+	case OP_SHA256, OP_HASH160, OP_HASH256:
+		top, err := engine.pop()
+		if err != nil {
+			return err
+		}
+		engine.push(scriptHash(opcode, top))
+
+	case OP_CHECKSIG, OP_CHECKSIGVERIFY:
+		if err := engine.checkSig(); err != nil {
+			return err
+		}
+		if opcode == OP_CHECKSIGVERIFY {
+			return engine.verify()
+		}
+
+	case OP_CHECKMULTISIG, OP_CHECKMULTISIGVERIFY:
+		if err := engine.checkMultisig(); err != nil {
+			return err
+		}
+		if opcode == OP_CHECKMULTISIGVERIFY {
+			return engine.verify()
+		}
+
+	case OP_CHECKLOCKTIMEVERIFY, OP_CHECKLOCKHEIGHTVERIFY:
+		top, err := engine.peek()
+		if err != nil {
+			return err
+		}
+		lock, err := decodeScriptNum(top)
+		if err != nil {
+			return err
+		}
+		if lock < 0 {
+			return errors.New("negative lock")
+		}
+
+		if opcode == OP_CHECKLOCKTIMEVERIFY && engine.context.lockTime < lock {
+			return fmt.Errorf("transaction lock time %d is before %d", engine.context.lockTime, lock)
+		}
+		if opcode == OP_CHECKLOCKHEIGHTVERIFY && int64(engine.context.lockHeight) < lock {
+			return fmt.Errorf("transaction lock height %d is before %d", engine.context.lockHeight, lock)
+		}
+
+	default:
+		return fmt.Errorf("unknown opcode %#x", byte(opcode))
+	}
+
+	return nil
+}
+
+// checkSig pops a public key and a signature and pushes
+// whether the signature covers the spending Transaction
+func (engine *scriptEngine) checkSig() error {
+	publicKeyData, err := engine.pop()
+	if err != nil {
+		return err
+	}
+	signature, err := engine.pop()
+	if err != nil {
+		return err
+	}
+
+	publicKey, err := decodeScriptPublicKey(publicKeyData)
+	if err != nil {
+		return err
+	}
+
+	engine.pushBool(len(signature) > 0 && publicKey.Verify(engine.context.signingHash[:], signature))
+	return nil
+}
+
+// checkMultisig pops n, n public keys, m and m signatures and pushes
+// whether every signature matches one of the keys, in key order
+func (engine *scriptEngine) checkMultisig() error {
+	publicKeys, err := engine.popItems(utils.MAX_MULTISIG_KEYS)
+	if err != nil {
+		return err
+	}
+	signatures, err := engine.popItems(len(publicKeys))
+	if err != nil {
+		return err
+	}
+
+	engine.ops += len(publicKeys)
+	if engine.ops > MAX_SCRIPT_OPS {
+		return fmt.Errorf("script has more than %d ops", MAX_SCRIPT_OPS)
+	}
+
+	keyIndex := 0
+	for _, signature := range signatures {
+		matched := false
+		for ; keyIndex < len(publicKeys) && !matched; keyIndex++ {
+			publicKey, err := decodeScriptPublicKey(publicKeys[keyIndex])
+			if err != nil {
+				return err
+			}
+			matched = len(signature) > 0 && publicKey.Verify(engine.context.signingHash[:], signature)
+		}
+
+		if !matched {
+			engine.pushBool(false)
+			return nil
+		}
+	}
+
+	engine.pushBool(true)
+	return nil
+}
+
+// popItems pops a count followed by that many items, keeping their order
+func (engine *scriptEngine) popItems(limit int) ([][]byte, error) {
+	top, err := engine.pop()
+	if err != nil {
+		return nil, err
+	}
+	count, err := decodeScriptNum(top)
+	if err != nil {
+		return nil, err
+	}
+	if count < 0 || count > int64(limit) {
+		return nil, fmt.Errorf("count %d is out of range", count)
+	}
+
+	items := make([][]byte, count)
+	for i := int(count) - 1; i >= 0; i-- {
+		if items[i], err = engine.pop(); err != nil {
+			return nil, err
+		}
+	}
+
+	return items, nil
+}
+
+func (engine *scriptEngine) verify() error {
+	top, err := engine.pop()
+	if err != nil {
+		return err
+	}
+	if !castToBool(top) {
+		return errors.New("verification failed")
+	}
+
+	return nil
+}
+
+func (engine *scriptEngine) push(data []byte) {
+	engine.stack = append(engine.stack, data)
+}
+
+func (engine *scriptEngine) pushBool(value bool) {
+	if value {
+		engine.push([]byte{1})
+	} else {
+		engine.push([]byte{})
+	}
+}
+
+func (engine *scriptEngine) peek() ([]byte, error) {
+	if len(engine.stack) == 0 {
+		return nil, errors.New("stack is empty")
+	}
+
+	return engine.stack[len(engine.stack)-1], nil
+}
+
+func (engine *scriptEngine) pop() ([]byte, error) {
+	top, err := engine.peek()
+	if err != nil {
+		return nil, err
+	}
+	engine.stack = engine.stack[:len(engine.stack)-1]
+
+	return top, nil
+}
+
+func scriptHash(opcode Opcode, data []byte) []byte {
+	first := sha256.Sum256(data)
+
+	switch opcode {
+	case OP_HASH160:
+		ripemd160Hash := ripemd160.New()
+		ripemd160Hash.Write(first[:])
+		return ripemd160Hash.Sum(nil)
+	case OP_HASH256:
+		second := sha256.Sum256(first[:])
+		return second[:]
+	default:
+		return first[:]
+	}
+}
+
+// castToBool treats empty data, zeros and negative zero as false
+func castToBool(data []byte) bool {
+	for i, b := range data {
+		if b != 0 {
+			return !(i == len(data)-1 && b == 0x80)
+		}
+	}
+
+	return false
+}
+
+// encodeScriptNum encodes the number little-endian with a sign bit
+func encodeScriptNum(number int64) []byte {
+	if number == 0 {
+		return []byte{}
+	}
+
+	negative := number < 0
+	magnitude := uint64(number)
+	if negative {
+		magnitude = uint64(-number)
+	}
+
+	result := make([]byte, 0, MAX_SCRIPT_NUM_SIZE)
+	for magnitude > 0 {
+		result = append(result, byte(magnitude))
+		magnitude >>= 8
+	}
+
+	if result[len(result)-1]&0x80 != 0 {
+		extra := byte(0x00)
+		if negative {
+			extra = 0x80
+		}
+		result = append(result, extra)
+	} else if negative {
+		result[len(result)-1] |= 0x80
+	}
+
+	return result
+}
+
+func decodeScriptNum(data []byte) (int64, error) {
+	if len(data) > MAX_SCRIPT_NUM_SIZE {
+		return 0, fmt.Errorf("number is longer than %d bytes", MAX_SCRIPT_NUM_SIZE)
+	}
+	if len(data) == 0 {
+		return 0, nil
+	}
+
+	var result int64
+	for i, b := range data {
+		result |= int64(b) << (8 * i)
+	}
+
+	last := data[len(data)-1]
+	if last&0x80 != 0 {
+		result &= ^(int64(0x80) << (8 * (len(data) - 1)))
+		return -result, nil
+	}
+
+	return result, nil
+}
@@ -0,0 +1,257 @@
+package block
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/ripemd160"
+)
+
+const (
+	TEST_LOCK_TIME   = 1700000000
+	TEST_LOCK_HEIGHT = 10
+)
+
+type scriptCase struct {
+	name   string
+	unlock Script
+	lock   Script
+	// err is part of the error, empty when the Script succeeds
+	err string
+}
+
+// mustParseScript assembles the Script from its text form
+func mustParseScript(t *testing.T, str string) Script {
+	t.Helper()
+	script, err := ParseScript(str)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return script
+}
+
+// repeatScript returns the Script made of the op repeated count times
+func repeatScript(opcode Opcode, count int) Script {
+	return Script(bytes.Repeat([]byte{byte(opcode)}, count))
+}
+
+func testScriptContext() *ScriptContext {
+	return &ScriptContext{
+		signingHash: sha256.Sum256([]byte("spending transaction")),
+		lockHeight:  TEST_LOCK_HEIGHT,
+		lockTime:    TEST_LOCK_TIME,
+	}
+}
+
+func runScriptCases(t *testing.T, context *ScriptContext, cases []scriptCase) {
+	t.Helper()
+	for _, test := range cases {
+		t.Run(test.name, func(t *testing.T) {
+			err := ExecuteScript(test.unlock, test.lock, context)
+			if test.err == "" && err != nil {
+				t.Fatalf("failed with %v", err)
+			}
+			if test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)) {
+				t.Fatalf("failed with %v, want %q", err, test.err)
+			}
+		})
+	}
+}
+
+func TestScriptOpcodes(t *testing.T) {
+	abc := []byte("abc")
+	sha256Hash := sha256.Sum256(abc)
+	hash256 := sha256.Sum256(sha256Hash[:])
+	ripemd160Hash := ripemd160.New()
+	ripemd160Hash.Write(sha256Hash[:])
+	hash160 := ripemd160Hash.Sum(nil)
+	parse := func(str string) Script { return mustParseScript(t, str) }
+
+	runScriptCases(t, testScriptContext(), []scriptCase{
+		{name: "OP_0", lock: parse("OP_0"), err: "evaluated to false"},
+		{name: "OP_1", lock: parse("OP_1")},
+		{name: "OP_1NEGATE", lock: parse("OP_1NEGATE 0x81 OP_EQUAL")},
+		{name: "OP_16", lock: parse("OP_16 0x10 OP_EQUAL")},
+		{name: "direct push", lock: parse("0x" + strings.Repeat("ab", 75) + " OP_SIZE 75 OP_EQUAL")},
+		{name: "OP_PUSHDATA1", lock: parse("0x" + strings.Repeat("ab", 76) + " OP_SIZE 76 OP_EQUAL")},
+		{name: "OP_PUSHDATA2", lock: parse("0x" + strings.Repeat("ab", 300) + " OP_SIZE 300 OP_EQUAL")},
+		{name: "truncated push", lock: Script{0x05, 0x01}, err: "past the end"},
+		{name: "truncated OP_PUSHDATA1", lock: Script{byte(OP_PUSHDATA1)}, err: "truncated"},
+		{name: "OP_NOP", lock: parse("OP_1 OP_NOP")},
+		{name: "OP_VERIFY of true", lock: parse("OP_1 OP_VERIFY OP_1")},
+		{name: "OP_VERIFY of false", lock: parse("OP_0 OP_VERIFY OP_1"), err: "verification failed"},
+		{name: "OP_RETURN", lock: parse("OP_1 OP_RETURN"), err: "unspendable"},
+		{name: "OP_DROP", lock: parse("OP_1 OP_0 OP_DROP")},
+		{name: "OP_DROP of nothing", lock: parse("OP_DROP"), err: "stack is empty"},
+		{name: "OP_DUP", lock: parse("OP_5 OP_DUP OP_EQUAL")},
+		{name: "OP_SWAP", lock: parse("OP_1 OP_0 OP_SWAP")},
+		{name: "OP_SWAP of one item", lock: parse("OP_1 OP_SWAP"), err: "stack is empty"},
+		{name: "OP_SIZE", lock: parse("0x010203 OP_SIZE 3 OP_EQUALVERIFY OP_1")},
+		{name: "OP_EQUAL of different items", lock: parse("OP_1 OP_2 OP_EQUAL"), err: "evaluated to false"},
+		{name: "OP_EQUALVERIFY of different items", lock: parse("OP_1 OP_2 OP_EQUALVERIFY OP_1"), err: "verification failed"},
+		{name: "OP_SHA256", unlock: parse("0x616263"), lock: parse("OP_SHA256 0x" + hex.EncodeToString(sha256Hash[:]) + " OP_EQUAL")},
+		{name: "OP_HASH160", unlock: parse("0x616263"), lock: parse("OP_HASH160 0x" + hex.EncodeToString(hash160) + " OP_EQUAL")},
+		{name: "OP_HASH256", unlock: parse("0x616263"), lock: parse("OP_HASH256 0x" + hex.EncodeToString(hash256[:]) + " OP_EQUAL")},
+		{name: "OP_SHA256 of another preimage", unlock: parse("0x616264"), lock: parse("OP_SHA256 0x" + hex.EncodeToString(sha256Hash[:]) + " OP_EQUAL"), err: "evaluated to false"},
+		{name: "OP_CHECKLOCKTIMEVERIFY reached", lock: parse("1700000000 OP_CHECKLOCKTIMEVERIFY")},
+		{name: "OP_CHECKLOCKTIMEVERIFY not reached", lock: parse("1700000001 OP_CHECKLOCKTIMEVERIFY"), err: "lock time"},
+		{name: "OP_CHECKLOCKTIMEVERIFY negative", lock: parse("-1 OP_CHECKLOCKTIMEVERIFY"), err: "negative lock"},
+		{name: "OP_CHECKLOCKHEIGHTVERIFY reached", lock: parse("10 OP_CHECKLOCKHEIGHTVERIFY")},
+		{name: "OP_CHECKLOCKHEIGHTVERIFY not reached", lock: parse("11 OP_CHECKLOCKHEIGHTVERIFY"), err: "lock height"},
+		{name: "unknown opcode", lock: Script{0xba}, err: "unknown opcode"},
+		{name: "unlock script with ops", unlock: parse("OP_1 OP_DUP"), lock: parse("OP_EQUAL"), err: "only push data"},
+		{name: "empty stack at the end", lock: parse("OP_1 OP_DROP"), err: "evaluated to false"},
+	})
+}
+
+func TestScriptLimits(t *testing.T) {
+	number := "0x" + strings.Repeat("01", MAX_SCRIPT_NUM_SIZE)
+	// Pushes of 500 bytes dropped right away, then one filling up the rest
+	builder := NewScriptBuilder()
+	for MAX_SCRIPT_SIZE-len(builder.Script()) > MAX_SCRIPT_ELEMENT_SIZE+4 {
+		builder.AddData(make([]byte, 500)).AddOp(OP_DROP)
+	}
+	largest := builder.AddData(make([]byte, MAX_SCRIPT_SIZE-len(builder.Script())-4)).AddOp(OP_1).Script()
+	if len(largest) != MAX_SCRIPT_SIZE {
+		t.Fatalf("largest script has %d bytes", len(largest))
+	}
+
+	runScriptCases(t, testScriptContext(), []scriptCase{
+		{name: "largest script", lock: largest},
+		{name: "script too large", lock: append(repeatScript(OP_1, MAX_SCRIPT_SIZE), byte(OP_1)), err: "larger than"},
+		{name: "unlock script too large", unlock: repeatScript(OP_1, MAX_SCRIPT_SIZE+1), lock: mustParseScript(t, "OP_1"), err: "larger than"},
+		{name: "most ops", lock: append(repeatScript(OP_NOP, MAX_SCRIPT_OPS), byte(OP_1))},
+		{name: "too many ops", lock: append(repeatScript(OP_NOP, MAX_SCRIPT_OPS+1), byte(OP_1)), err: "more than 201 ops"},
+		{name: "ops of skipped branches count", lock: mustParseScript(t, "OP_0 OP_IF "+strings.Repeat("OP_NOP ", MAX_SCRIPT_OPS)+"OP_ENDIF OP_1"), err: "more than 201 ops"},
+		{name: "fullest stack", lock: repeatScript(OP_1, MAX_SCRIPT_STACK_SIZE)},
+		{name: "stack too full", lock: repeatScript(OP_1, MAX_SCRIPT_STACK_SIZE+1), err: "stack has more than"},
+		{name: "stack too full across scripts", unlock: repeatScript(OP_1, MAX_SCRIPT_STACK_SIZE), lock: mustParseScript(t, "OP_1"), err: "stack has more than"},
+		{name: "largest push", lock: NewScriptBuilder().AddData(make([]byte, MAX_SCRIPT_ELEMENT_SIZE)).AddOp(OP_SIZE).Script()},
+		{name: "push too large", lock: NewScriptBuilder().AddData(make([]byte, MAX_SCRIPT_ELEMENT_SIZE+1)).AddOp(OP_SIZE).Script(), err: "push is larger"},
+		{name: "longest number", lock: mustParseScript(t, number+" OP_CHECKLOCKHEIGHTVERIFY"), err: "lock height"},
+		{name: "number too long", lock: mustParseScript(t, number+"01 OP_CHECKLOCKHEIGHTVERIFY"), err: "longer than"},
+	})
+}
+
+func TestScriptConditionals(t *testing.T) {
+	parse := func(str string) Script { return mustParseScript(t, str) }
+
+	runScriptCases(t, testScriptContext(), []scriptCase{
+		{name: "IF taken", lock: parse("OP_1 OP_IF OP_1 OP_ELSE OP_0 OP_ENDIF")},
+		{name: "ELSE taken", lock: parse("OP_0 OP_IF OP_0 OP_ELSE OP_1 OP_ENDIF")},
+		{name: "IF without ELSE skipped", lock: parse("OP_1 OP_0 OP_IF OP_0 OP_ENDIF")},
+		{name: "NOTIF taken", lock: parse("OP_0 OP_NOTIF OP_1 OP_ELSE OP_0 OP_ENDIF")},
+		{name: "NOTIF skipped", lock: parse("OP_1 OP_NOTIF OP_1 OP_ELSE OP_0 OP_ENDIF"), err: "evaluated to false"},
+		{name: "nested ELSE", lock: parse("OP_1 OP_IF OP_0 OP_IF OP_0 OP_ELSE OP_1 OP_ENDIF OP_ELSE OP_0 OP_ENDIF")},
+		{name: "nested in a skipped branch", lock: parse("OP_1 OP_0 OP_IF OP_0 OP_IF OP_RETURN OP_ELSE OP_RETURN OP_ENDIF OP_ENDIF")},
+		{name: "ELSE toggles again", lock: parse("OP_0 OP_IF OP_1 OP_ELSE OP_0 OP_ELSE OP_1 OP_ENDIF"), err: "evaluated to false"},
+		{name: "IF of nothing", lock: parse("OP_IF OP_1 OP_ENDIF"), err: "stack is empty"},
+		{name: "IF without ENDIF", lock: parse("OP_1 OP_IF OP_1"), err: "unbalanced conditional"},
+		{name: "ENDIF without IF", lock: parse("OP_1 OP_ENDIF"), err: "OP_ENDIF without OP_IF"},
+		{name: "ELSE without IF", lock: parse("OP_1 OP_ELSE"), err: "OP_ELSE without OP_IF"},
+		{name: "ENDIF twice", lock: parse("OP_1 OP_IF OP_1 OP_ENDIF OP_ENDIF"), err: "OP_ENDIF without OP_IF"},
+	})
+}
+
+func TestScriptCheckSig(t *testing.T) {
+	context := testScriptContext()
+	keys := []*testKey{newTestKey(t), newTestKey(t), newTestKey(t), newTestKey(t)}
+	signatures := make([][]byte, len(keys))
+	for i, key := range keys {
+		signature, err := key.signer.Sign(context.signingHash[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		signatures[i] = signature
+	}
+	otherHash := sha256.Sum256([]byte("another transaction"))
+	otherSignature, err := keys[0].signer.Sign(otherHash[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkSig := NewScriptBuilder().AddPublicKey(keys[0].signer.Verifier()).AddOp(OP_CHECKSIG).Script()
+	// unlock pushes the signatures, multisig locks with the first three keys
+	unlock := func(signatures ...[]byte) Script {
+		builder := NewScriptBuilder()
+		for _, signature := range signatures {
+			builder.AddData(signature)
+		}
+		return builder.Script()
+	}
+	multisig := func(threshold int64, count int64) Script {
+		builder := NewScriptBuilder().AddInt(threshold)
+		for _, key := range keys[:3] {
+			builder.AddPublicKey(key.signer.Verifier())
+		}
+		return builder.AddInt(count).AddOp(OP_CHECKMULTISIG).Script()
+	}
+
+	runScriptCases(t, context, []scriptCase{
+		{name: "CHECKSIG", unlock: unlock(signatures[0]), lock: checkSig},
+		{name: "CHECKSIG of another key", unlock: unlock(signatures[1]), lock: checkSig, err: "evaluated to false"},
+		{name: "CHECKSIG of another transaction", unlock: unlock(otherSignature), lock: checkSig, err: "evaluated to false"},
+		{name: "CHECKSIG without signature", unlock: unlock([]byte{}), lock: checkSig, err: "evaluated to false"},
+		{name: "CHECKSIG of a malformed key", unlock: unlock(signatures[0]), lock: mustParseScript(t, "0x0900 OP_CHECKSIG"), err: "unknown key type"},
+		{name: "CHECKMULTISIG of the first two", unlock: unlock(signatures[0], signatures[1]), lock: multisig(2, 3)},
+		{name: "CHECKMULTISIG of the outer two", unlock: unlock(signatures[0], signatures[2]), lock: multisig(2, 3)},
+		{name: "CHECKMULTISIG out of key order", unlock: unlock(signatures[1], signatures[0]), lock: multisig(2, 3), err: "evaluated to false"},
+		{name: "CHECKMULTISIG of the same key twice", unlock: unlock(signatures[0], signatures[0]), lock: multisig(2, 3), err: "evaluated to false"},
+		{name: "CHECKMULTISIG of a key outside the set", unlock: unlock(signatures[0], signatures[3]), lock: multisig(2, 3), err: "evaluated to false"},
+		{name: "CHECKMULTISIG of another transaction", unlock: unlock(otherSignature, signatures[1]), lock: multisig(2, 3), err: "evaluated to false"},
+		{name: "CHECKMULTISIG below the threshold", unlock: unlock(signatures[0]), lock: multisig(2, 3), err: "stack is empty"},
+		{name: "CHECKMULTISIG of more signatures than keys", unlock: unlock(signatures[0], signatures[1], signatures[2], signatures[3]), lock: multisig(4, 3), err: "out of range"},
+		{name: "CHECKMULTISIG of too many keys", lock: mustParseScript(t, "17 OP_CHECKMULTISIG"), err: "out of range"},
+		{name: "CHECKMULTISIGVERIFY", unlock: unlock(signatures[1], signatures[2]), lock: append(multisig(2, 3)[:len(multisig(2, 3))-1], byte(OP_CHECKMULTISIGVERIFY), byte(OP_1))},
+	})
+}
+
+func TestHashTimeLockScript(t *testing.T) {
+	recipient, refund := newTestKey(t), newTestKey(t)
+	preimage := []byte("swap secret")
+	lock := NewHashTimeLockScript(sha256.Sum256(preimage), recipient.signer.Verifier(), refund.signer.Verifier(), TEST_LOCK_TIME)
+
+	cases := []struct {
+		name     string
+		signer   *testKey
+		claim    bool
+		preimage []byte
+		lockTime int64
+		err      string
+	}{
+		{name: "claim", signer: recipient, claim: true, preimage: preimage},
+		{name: "claim with another preimage", signer: recipient, claim: true, preimage: []byte("guess"), err: "verification failed"},
+		{name: "claim signed by the refund key", signer: refund, claim: true, preimage: preimage, err: "evaluated to false"},
+		{name: "refund after the lock time", signer: refund, lockTime: TEST_LOCK_TIME},
+		{name: "refund before the lock time", signer: refund, lockTime: TEST_LOCK_TIME - 1, err: "lock time"},
+		{name: "refund signed by the recipient", signer: recipient, lockTime: TEST_LOCK_TIME, err: "evaluated to false"},
+	}
+
+	for _, test := range cases {
+		t.Run(test.name, func(t *testing.T) {
+			context := testScriptContext()
+			context.lockTime = test.lockTime
+			signature, err := test.signer.signer.Sign(context.signingHash[:])
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			unlock := NewHashLockRefundScript(signature)
+			if test.claim {
+				unlock = NewHashLockClaimScript(signature, test.preimage)
+			}
+
+			err = ExecuteScript(unlock, lock, context)
+			if test.err == "" && err != nil {
+				t.Fatalf("failed with %v", err)
+			}
+			if test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)) {
+				t.Fatalf("failed with %v, want %q", err, test.err)
+			}
+		})
+	}
+}
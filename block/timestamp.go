@@ -0,0 +1,54 @@
+package block
+
+import (
+	"sort"
+	"time"
+)
+
+const (
+	MEDIAN_TIME_BLOCKS       = 11
+	MAX_BLOCK_TIME_DRIFT_SEC = 120
+)
+
+// medianTimePast returns the median timestamp of the last
+// MEDIAN_TIME_BLOCKS blocks of the chain
+func medianTimePast(chain []*Block) int64 {
+	start := len(chain) - MEDIAN_TIME_BLOCKS
+	if start < 0 {
+		start = 0
+	}
+
+	timestamps := make([]int64, 0, MEDIAN_TIME_BLOCKS)
+	for _, block := range chain[start:] {
+		timestamps = append(timestamps, block.timestamp)
+	}
+	sort.Slice(timestamps, func(i, j int) bool { return timestamps[i] < timestamps[j] })
+
+	return timestamps[len(timestamps)/2]
+}
+
+// validateTimestamp checks that the Block on top of the chain is later
+// than the median of the recent blocks, so a miner can't move time locks
+// backwards, and at most MAX_BLOCK_TIME_DRIFT_SEC ahead of the clock
+func (blockchain *Blockchain) validateTimestamp(chain []*Block, block *Block) error {
+	if median := medianTimePast(chain); block.timestamp <= median {
+		return Errorf(ERROR_INVALID_BLOCK, "timestamp %d is not later than the median %d of the recent blocks", block.timestamp, median)
+	}
+
+	limit := blockchain.now() + (MAX_BLOCK_TIME_DRIFT_SEC * time.Second).Nanoseconds()
+	if block.timestamp > limit {
+		return Errorf(ERROR_INVALID_BLOCK, "timestamp %d is more than %d seconds ahead of the clock", block.timestamp, MAX_BLOCK_TIME_DRIFT_SEC)
+	}
+
+	return nil
+}
+
+// nextTimestamp returns the timestamp of a Block mined on top of the
+// chain now. On a MockClock the time may not have moved since the last
+// Block, then the Block is one nanosecond past the median instead
+func nextTimestamp(chain []*Block, now int64) int64 {
+	if median := medianTimePast(chain); now <= median {
+		return median + 1
+	}
+	return now
+}
@@ -0,0 +1,160 @@
+package block
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMedianTimePast(t *testing.T) {
+	cases := []struct {
+		name       string
+		timestamps []int64
+		want       int64
+	}{
+		{"genesis alone", []int64{5}, 5},
+		{"unordered", []int64{1, 9, 4}, 4},
+		{"even count takes the upper middle", []int64{1, 2, 3, 4}, 3},
+		{"only the last blocks count", []int64{100, 100, 100, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11}, 6},
+	}
+
+	for _, test := range cases {
+		t.Run(test.name, func(t *testing.T) {
+			chain := make([]*Block, 0, len(test.timestamps))
+			for _, timestamp := range test.timestamps {
+				chain = append(chain, &Block{timestamp: timestamp})
+			}
+			if got := medianTimePast(chain); got != test.want {
+				t.Errorf("median %d, want %d", got, test.want)
+			}
+		})
+	}
+}
+
+func TestAddBlockChecksTimestamp(t *testing.T) {
+	blockchain := newTestChain(t, testChainConfig(LEDGER_MODE_ACCOUNT))
+	if _, err := blockchain.Generate(MEDIAN_TIME_BLOCKS, TEST_MINER); err != nil {
+		t.Fatal(err)
+	}
+	median := medianTimePast(blockchain.chain)
+	drift := (MAX_BLOCK_TIME_DRIFT_SEC * time.Second).Nanoseconds()
+
+	cases := []struct {
+		name      string
+		timestamp int64
+		accepted  bool
+	}{
+		{"at the median", median, false},
+		{"before the median", median - 1, false},
+		{"after the median", median + 1, true},
+		{"at the drift limit", blockchain.now() + drift, true},
+		{"past the drift limit", blockchain.now() + drift + 1, false},
+	}
+
+	for _, test := range cases {
+		t.Run(test.name, func(t *testing.T) {
+			block := nextBlock(t, blockchain, blockchain.chain, test.timestamp)
+			err := blockchain.AddBlock(block, "")
+			if test.accepted && err != nil {
+				t.Fatal(err)
+			}
+			if !test.accepted && ErrorCodeOf(err) != ERROR_INVALID_BLOCK {
+				t.Fatalf("added with %v, want %s", err, ERROR_INVALID_BLOCK)
+			}
+		})
+	}
+}
+
+func TestValidChainChecksTimestamp(t *testing.T) {
+	blockchain := newTestChain(t, testChainConfig(LEDGER_MODE_ACCOUNT))
+	if _, err := blockchain.Generate(3, TEST_MINER); err != nil {
+		t.Fatal(err)
+	}
+	if !blockchain.ValidChain(blockchain.chain) {
+		t.Fatal("the mined chain is invalid")
+	}
+
+	backdated := nextBlock(t, blockchain, blockchain.chain, blockchain.chain[1].timestamp)
+	chain := append(append([]*Block{}, blockchain.chain...), backdated)
+	if blockchain.ValidChain(chain) {
+		t.Error("a chain with a backdated block is valid")
+	}
+}
+
+func TestProofOfWorkCoversTimestamp(t *testing.T) {
+	engine := NewProofOfWorkEngine(3)
+	coinbase := NewTransaction(MINING_SENDER, TEST_MINER, 1)
+	block := NewBlock(0, [32]byte{1}, []*Transaction{coinbase})
+	block.timestamp = time.Unix(TEST_CLOCK_START, 0).UnixNano()
+	if err := engine.Seal(nil, block); err != nil {
+		t.Fatal(err)
+	}
+	if err := engine.VerifySeal(nil, block); err != nil {
+		t.Fatal(err)
+	}
+
+	block.timestamp += time.Hour.Nanoseconds()
+	if err := engine.VerifySeal(nil, block); err == nil {
+		t.Error("the seal still holds after the timestamp changed")
+	}
+}
+
+func TestLockedTransactions(t *testing.T) {
+	cases := []struct {
+		name string
+		lock func(blockchain *Blockchain, transaction *Transaction)
+		// unlock brings the next Block to where the lock is reached
+		unlock func(t *testing.T, blockchain *Blockchain)
+	}{
+		{
+			name: "height lock",
+			lock: func(blockchain *Blockchain, transaction *Transaction) {
+				transaction.lockHeight = len(blockchain.chain) + 3
+			},
+			unlock: func(t *testing.T, blockchain *Blockchain) {
+				if _, err := blockchain.Generate(2, TEST_MINER); err != nil {
+					t.Fatal(err)
+				}
+			},
+		},
+		{
+			name: "time lock",
+			lock: func(blockchain *Blockchain, transaction *Transaction) {
+				transaction.lockTime = time.Unix(0, blockchain.now()).Add(time.Hour).Unix()
+			},
+			unlock: func(t *testing.T, blockchain *Blockchain) {
+				blockchain.clock.(*MockClock).Advance(time.Hour)
+			},
+		},
+	}
+
+	for _, test := range cases {
+		t.Run(test.name, func(t *testing.T) {
+			blockchain := newTestChain(t, testChainConfig(LEDGER_MODE_ACCOUNT))
+			sender := newTestKey(t)
+			fund(t, blockchain, sender.address)
+
+			transaction := sender.transfer(t, blockchain, "recipient", 1, func(transaction *Transaction) {
+				test.lock(blockchain, transaction)
+			})
+			if err := blockchain.SubmitTransaction(transaction); err != nil {
+				t.Fatal(err)
+			}
+
+			// A Block including it early is invalid, and mining leaves it pending
+			early := nextBlock(t, blockchain, blockchain.chain, nextTimestamp(blockchain.chain, blockchain.now()), transaction)
+			if err := blockchain.AddBlock(early, ""); ErrorCodeOf(err) != ERROR_INVALID_BLOCK {
+				t.Errorf("added a block including it early with %v, want %s", err, ERROR_INVALID_BLOCK)
+			}
+			fund(t, blockchain, TEST_MINER)
+			if _, height, _ := blockchain.FindTransaction(transaction.Hash()); height != -1 {
+				t.Fatalf("mined at height %d before the lock", height)
+			}
+
+			test.unlock(t, blockchain)
+			fund(t, blockchain, TEST_MINER)
+			if _, height, _ := blockchain.FindTransaction(transaction.Hash()); height != len(blockchain.chain)-1 {
+				t.Errorf("found at height %d, want it mined into the last block %d", height, len(blockchain.chain)-1)
+			}
+		})
+	}
+}
@@ -0,0 +1,379 @@
+package block
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+)
+
+// BlockTree keeps every known Block, including the ones on forks
+// that are not part of the chain, linked to its parent
+type BlockTree struct {
+	nodes map[[32]byte]*treeNode
+	tips  map[[32]byte]*treeNode
+}
+
+type treeNode struct {
+	block  *Block
+	parent *treeNode
+	height int
+}
+
+// ReorgEvent describes a switch of Blockchain to another branch. Depth
+// blocks above the common ancestor were disconnected for the new ones
+type ReorgEvent struct {
+	depth          int
+	ancestorHeight int
+	ancestorHash   [32]byte
+	oldTip         [32]byte
+	newTip         [32]byte
+	disconnected   []*Block
+	connected      []*Block
+	timestamp      int64
+}
+
+// ReorgListener is told about every ReorgEvent. It is called while
+// Blockchain is locked, so it must not call back into it
+type ReorgListener func(event *ReorgEvent)
+
+const MAX_REORG_HISTORY = 100
+
+// NewBlockTree generates and returns new BlockTree
+func NewBlockTree() *BlockTree {
+	return &BlockTree{
+		nodes: make(map[[32]byte]*treeNode),
+		tips:  make(map[[32]byte]*treeNode),
+	}
+}
+
+// add links the Block to its parent. Only the first Block,
+// the genesis block, may come without a known parent
+func (tree *BlockTree) add(block *Block) (*treeNode, error) {
+	hash := block.Hash()
+	if node, ok := tree.nodes[hash]; ok {
+		return node, nil
+	}
+
+	node := &treeNode{block: block}
+	if len(tree.nodes) > 0 {
+		parent, ok := tree.nodes[block.previousHash]
+		if !ok {
+			return nil, fmt.Errorf("parent %x of block %x is unknown", block.previousHash, hash)
+		}
+		node.parent = parent
+		node.height = parent.height + 1
+		delete(tree.tips, block.previousHash)
+	}
+
+	tree.nodes[hash] = node
+	tree.tips[hash] = node
+	return node, nil
+}
+
+// Get returns the Block with the hash and its height
+func (tree *BlockTree) Get(hash [32]byte) (*Block, int, bool) {
+	node, ok := tree.nodes[hash]
+	if !ok {
+		return nil, 0, false
+	}
+
+	return node.block, node.height, true
+}
+
+// Tips returns the blocks nobody has built on yet,
+// the last Block of the chain and of every fork
+func (tree *BlockTree) Tips() []*Block {
+	tips := make([]*Block, 0, len(tree.tips))
+	for _, node := range tree.tips {
+		tips = append(tips, node.block)
+	}
+
+	return tips
+}
+
+// Len returns the number of known blocks
+func (tree *BlockTree) Len() int {
+	return len(tree.nodes)
+}
+
+func (event *ReorgEvent) Depth() int {
+	return event.depth
+}
+
+func (event *ReorgEvent) Disconnected() []*Block {
+	return event.disconnected
+}
+
+func (event *ReorgEvent) Connected() []*Block {
+	return event.connected
+}
+
+func (event *ReorgEvent) MarshalJSON() ([]byte, error) {
+	hashes := func(blocks []*Block) []string {
+		hashes := make([]string, 0, len(blocks))
+		for _, block := range blocks {
+			hashes = append(hashes, fmt.Sprintf("%x", block.Hash()))
+		}
+		return hashes
+	}
+
+	return json.Marshal(struct {
+		Depth          int      `json:"depth"`
+		AncestorHeight int      `json:"ancestorHeight"`
+		AncestorHash   string   `json:"ancestorHash"`
+		OldTip         string   `json:"oldTip"`
+		NewTip         string   `json:"newTip"`
+		Disconnected   []string `json:"disconnected"`
+		Connected      []string `json:"connected"`
+		Timestamp      int64    `json:"timestamp"`
+	}{
+		Depth:          event.depth,
+		AncestorHeight: event.ancestorHeight,
+		AncestorHash:   fmt.Sprintf("%x", event.ancestorHash),
+		OldTip:         fmt.Sprintf("%x", event.oldTip),
+		NewTip:         fmt.Sprintf("%x", event.newTip),
+		Disconnected:   hashes(event.disconnected),
+		Connected:      hashes(event.connected),
+		Timestamp:      event.timestamp,
+	})
+}
+
+// AddBlock takes a Block from the node at the source. It is kept in the
+// BlockTree when it is valid on top of its parent, and Blockchain switches
+// to its branch when the ConsensusEngine prefers it. A Block with an
+// unknown parent is kept in the OrphanPool, failing with ErrOrphanBlock,
+// while its ancestors are requested from the source
+func (blockchain *Blockchain) AddBlock(block *Block, source string) error {
+	blockchain.mux.Lock()
+	defer blockchain.mux.Unlock()
+
+	if err := blockchain.addBlock(block, source); err != nil {
+		return err
+	}
+	blockchain.connectOrphans(block.Hash())
+
+	return nil
+}
+
+func (blockchain *Blockchain) addBlock(block *Block, source string) error {
+	hash := block.Hash()
+	if _, _, ok := blockchain.tree.Get(hash); ok {
+		return Errorf(ERROR_ALREADY_KNOWN, "block %x is already known", hash)
+	}
+
+	parent, ok := blockchain.tree.nodes[block.previousHash]
+	if !ok {
+		return blockchain.addOrphan(block, source)
+	}
+	branch, err := blockchain.sideBranch(parent)
+	if err != nil {
+		return Errorf(ERROR_INVALID_BLOCK, "block %x is refused: %v", hash, err)
+	}
+	height := len(branch)
+
+	if blockchain.finality != nil {
+		finalized := blockchain.finality.finalized
+		if height <= finalized.height || branch[finalized.height].Hash() != finalized.hash {
+			return Errorf(ERROR_INVALID_BLOCK, "block %x conflicts with finalized block %d", hash, finalized.height)
+		}
+	}
+
+	if err := blockchain.validateTimestamp(branch, block); err != nil {
+		return Errorf(ERROR_INVALID_BLOCK, "block %x is invalid: %v", hash, err)
+	}
+	if err := blockchain.engine.VerifySeal(branch, block); err != nil {
+		return Errorf(ERROR_INVALID_BLOCK, "block %x has an invalid seal: %v", hash, err)
+	}
+	if err := blockchain.validateBlock(block, height); err != nil {
+		return Errorf(ERROR_INVALID_BLOCK, "block %x is invalid: %v", hash, err)
+	}
+
+	// Transactions are checked the way mempool checks them,
+	// against the ledger on top of the parent
+	state, err := blockchain.branchState(branch)
+	if err != nil {
+		return Errorf(ERROR_INVALID_BLOCK, "block %x is invalid: %v", hash, err)
+	}
+	if err := blockchain.verifyBlockTransactions(state, block); err != nil {
+		return Errorf(ERROR_INVALID_BLOCK, "block %x is invalid: %v", hash, err)
+	}
+
+	if _, err := blockchain.tree.add(block); err != nil {
+		return err
+	}
+
+	candidate := append(branch, block)
+	if !blockchain.forkChoice(candidate) {
+		log.Printf("Keeping block %x on a fork at height %d", hash, height)
+		blockchain.keepBranchState(state, block)
+		return nil
+	}
+
+	if err := blockchain.reorganize(candidate); err != nil {
+		return Errorf(ERROR_INVALID_BLOCK, "block %x is invalid: %v", hash, err)
+	}
+	blockchain.pruneBranchStates()
+	return nil
+}
+
+// reorganize switches the chain to the candidate branch. The blocks
+// above the common ancestor are disconnected, the new ones connected,
+// and the transactions only the old blocks had go back to mempool.
+// When a new Block can't be connected, the old blocks are restored
+func (blockchain *Blockchain) reorganize(candidate []*Block) error {
+	ancestor := len(blockchain.chain) - 1
+	if len(candidate)-1 < ancestor {
+		ancestor = len(candidate) - 1
+	}
+	for blockchain.chain[ancestor] != candidate[ancestor] {
+		ancestor--
+	}
+
+	// A finalized Block is never reverted, so nothing
+	// is disconnected when the ancestor is below one
+	if ancestor < len(blockchain.chain)-1 && blockchain.IsFinalized(ancestor+1) {
+		return fmt.Errorf("refusing to revert finalized block %d", ancestor+1)
+	}
+
+	oldTip := blockchain.LastBlock()
+	disconnected := make([]*Block, 0)
+	for len(blockchain.chain)-1 > ancestor {
+		disconnected = append(disconnected, blockchain.disconnectTip())
+	}
+
+	connected := candidate[len(blockchain.chain):]
+	included := make(map[[32]byte]bool)
+	for i, block := range connected {
+		if err := blockchain.appendBlock(block); err != nil {
+			blockchain.abortReorganize(connected[:i], disconnected)
+			return fmt.Errorf("connecting block %d: %w", ancestor+1+i, err)
+		}
+		for _, transaction := range block.transactions {
+			included[transaction.Hash()] = true
+		}
+	}
+
+	for i := len(disconnected) - 1; i >= 0; i-- {
+		for _, transaction := range disconnected[i].transactions {
+			if transaction.IsCoinbase() || included[transaction.Hash()] {
+				continue
+			}
+			if err := blockchain.addTransaction(transaction); err != nil {
+				log.Printf("ERROR Dropping transaction %x of orphaned block: %v", transaction.Hash(), err)
+			}
+		}
+	}
+
+	if len(disconnected) == 0 {
+		return nil
+	}
+
+	event := &ReorgEvent{
+		depth:          len(disconnected),
+		ancestorHeight: ancestor,
+		ancestorHash:   blockchain.chain[ancestor].Hash(),
+		oldTip:         oldTip.Hash(),
+		newTip:         blockchain.LastBlock().Hash(),
+		disconnected:   disconnected,
+		connected:      connected,
+		timestamp:      blockchain.now(),
+	}
+	log.Printf("Reorganized %d blocks above height %d", event.depth, ancestor)
+
+	blockchain.reorgs = append(blockchain.reorgs, event)
+	if len(blockchain.reorgs) > MAX_REORG_HISTORY {
+		blockchain.reorgs = blockchain.reorgs[1:]
+	}
+	for _, listener := range blockchain.reorgListeners {
+		listener(event)
+	}
+
+	return nil
+}
+
+// abortReorganize disconnects the blocks connected so far and connects
+// the disconnected ones again, which were in the chain before. The
+// transactions of the dropped blocks go back to mempool
+func (blockchain *Blockchain) abortReorganize(connected []*Block, disconnected []*Block) {
+	for range connected {
+		blockchain.disconnectTip()
+	}
+	for i := len(disconnected) - 1; i >= 0; i-- {
+		if err := blockchain.appendBlock(disconnected[i]); err != nil {
+			log.Printf("ERROR Restoring block %x: %v", disconnected[i].Hash(), err)
+			return
+		}
+	}
+
+	for _, block := range connected {
+		for _, transaction := range block.transactions {
+			if transaction.IsCoinbase() {
+				continue
+			}
+			if err := blockchain.addTransaction(transaction); err != nil {
+				log.Printf("ERROR Dropping transaction %x of refused block: %v", transaction.Hash(), err)
+			}
+		}
+	}
+}
+
+// OnReorg registers the ReorgListener
+func (blockchain *Blockchain) OnReorg(listener ReorgListener) {
+	blockchain.mux.Lock()
+	defer blockchain.mux.Unlock()
+
+	blockchain.reorgListeners = append(blockchain.reorgListeners, listener)
+}
+
+// Reorgs returns the latest MAX_REORG_HISTORY reorganisations, oldest first
+func (blockchain *Blockchain) Reorgs() []*ReorgEvent {
+	blockchain.mux.Lock()
+	defer blockchain.mux.Unlock()
+
+	return append([]*ReorgEvent{}, blockchain.reorgs...)
+}
+
+// GetBlock returns the known Block with the hash and its height,
+// whether it is part of the chain or of a fork
+func (blockchain *Blockchain) GetBlock(hash [32]byte) (*Block, int, bool) {
+	blockchain.mux.Lock()
+	defer blockchain.mux.Unlock()
+
+	return blockchain.tree.Get(hash)
+}
+
+// BlockByHeight returns the Block of the chain at the height
+func (blockchain *Blockchain) BlockByHeight(height int) (*Block, bool) {
+	blockchain.mux.Lock()
+	defer blockchain.mux.Unlock()
+
+	if height < 0 || height >= len(blockchain.chain) {
+		return nil, false
+	}
+
+	return blockchain.chain[height], true
+}
+
+// Head returns the last Block of the chain and its height
+func (blockchain *Blockchain) Head() (*Block, int) {
+	blockchain.mux.Lock()
+	defer blockchain.mux.Unlock()
+
+	return blockchain.LastBlock(), len(blockchain.chain) - 1
+}
+
+// InChain tells whether the Block is part of the chain rather than a fork
+func (blockchain *Blockchain) InChain(block *Block, height int) bool {
+	blockchain.mux.Lock()
+	defer blockchain.mux.Unlock()
+
+	return height < len(blockchain.chain) && blockchain.chain[height] == block
+}
+
+// Tips returns the last Block of the chain and of every fork
+func (blockchain *Blockchain) Tips() []*Block {
+	blockchain.mux.Lock()
+	defer blockchain.mux.Unlock()
+
+	return blockchain.tree.Tips()
+}
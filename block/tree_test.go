@@ -0,0 +1,272 @@
+package block
+
+import (
+	"crypto-blockchain/utils"
+	"testing"
+)
+
+// sideBlocks returns count blocks forking off the chain above the height,
+// the first one including the transactions. They are not added
+func sideBlocks(t *testing.T, blockchain *Blockchain, height int, count int, transactions ...*Transaction) []*Block {
+	t.Helper()
+	branch := append([]*Block{}, blockchain.chain[:height+1]...)
+	blocks := make([]*Block, 0, count)
+	for i := 0; i < count; i++ {
+		if i > 0 {
+			transactions = nil
+		}
+		block := nextBlock(t, blockchain, branch, nextTimestamp(branch, blockchain.now()), transactions...)
+		branch = append(branch, block)
+		blocks = append(blocks, block)
+	}
+
+	return blocks
+}
+
+// addBlocks adds the blocks to the Blockchain, failing the test on an error
+func addBlocks(t *testing.T, blockchain *Blockchain, blocks []*Block) {
+	t.Helper()
+	for _, block := range blocks {
+		if err := blockchain.AddBlock(block, ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestReorgReturnsTransactionsToMempool(t *testing.T) {
+	blockchain := newTestChain(t, testChainConfig(LEDGER_MODE_ACCOUNT))
+	sender := newTestKey(t)
+	fund(t, blockchain, sender.address)
+
+	orphaned := sender.transfer(t, blockchain, "recipient", 0.25)
+	kept := sender.transfer(t, blockchain, "other recipient", 0.25)
+	for _, transaction := range []*Transaction{orphaned, kept} {
+		if err := blockchain.SubmitTransaction(transaction); err != nil {
+			t.Fatal(err)
+		}
+	}
+	fund(t, blockchain, "main")
+
+	fork := sideBlocks(t, blockchain, 1, 2, kept)
+	addBlocks(t, blockchain, fork)
+	if blockchain.LastBlock() != fork[1] {
+		t.Fatal("the longer fork did not become the chain")
+	}
+
+	cases := []struct {
+		name        string
+		transaction *Transaction
+		height      int
+	}{
+		{"only in the old block", orphaned, -1},
+		{"in both branches", kept, 2},
+	}
+
+	for _, test := range cases {
+		t.Run(test.name, func(t *testing.T) {
+			if _, height, ok := blockchain.FindTransaction(test.transaction.Hash()); !ok || height != test.height {
+				t.Errorf("found %t at height %d, want height %d", ok, height, test.height)
+			}
+		})
+	}
+
+	reorgs := blockchain.Reorgs()
+	if len(reorgs) != 1 || reorgs[0].depth != 1 || reorgs[0].ancestorHeight != 1 {
+		t.Errorf("recorded reorgs %v, want one of depth 1 above height 1", reorgs)
+	}
+}
+
+func TestReorgRestoresUTXOs(t *testing.T) {
+	blockchain := newTestChain(t, testChainConfig(LEDGER_MODE_UTXO))
+	sender := newTestKey(t)
+	fund(t, blockchain, sender.address)
+	coinbase := blockchain.chain[1].transactions[0]
+
+	spend := utxoPayment(t, blockchain, sender, coinbase, 0.5, 0, nil)
+	if err := blockchain.SubmitTransaction(spend); err != nil {
+		t.Fatal(err)
+	}
+	fund(t, blockchain, "main")
+	mainCoinbase := blockchain.chain[2].transactions[0]
+
+	fork := sideBlocks(t, blockchain, 1, 2)
+	addBlocks(t, blockchain, fork)
+
+	cases := []struct {
+		name     string
+		outPoint OutPoint
+		unspent  bool
+	}{
+		{"spent by the old block", OutPoint{coinbase.Hash(), 0}, true},
+		{"created by the old block", OutPoint{spend.Hash(), 0}, false},
+		{"coinbase of the old block", OutPoint{mainCoinbase.Hash(), 0}, false},
+		{"coinbase of the new block", OutPoint{fork[1].transactions[0].Hash(), 0}, true},
+	}
+
+	for _, test := range cases {
+		t.Run(test.name, func(t *testing.T) {
+			if _, unspent := blockchain.utxoSet.Get(test.outPoint); unspent != test.unspent {
+				t.Errorf("unspent %t, want %t", unspent, test.unspent)
+			}
+		})
+	}
+
+	if _, height, ok := blockchain.FindTransaction(spend.Hash()); !ok || height != -1 {
+		t.Errorf("found the spend %t at height %d, want it pending", ok, height)
+	}
+}
+
+func TestReorgKeepsFinalizedBlocks(t *testing.T) {
+	config := testChainConfig(LEDGER_MODE_ACCOUNT)
+	validator := newTestKey(t)
+	finality, err := NewFinalityGadget(2, []utils.Verifier{validator.signer.Verifier()}, validator.signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.Finality = finality
+	blockchain := newTestChain(t, config)
+	if _, err := blockchain.Generate(4, "main"); err != nil {
+		t.Fatal(err)
+	}
+	if !blockchain.IsFinalized(2) {
+		t.Fatalf("finalized height %d, want at least 2", blockchain.finality.finalized.height)
+	}
+
+	fork := sideBlocks(t, blockchain, 1, 5)
+	tip := blockchain.LastBlock()
+
+	cases := []struct {
+		name string
+		// add takes the fork, failing when it is refused
+		add func() error
+	}{
+		{"added", func() error { return blockchain.AddBlock(fork[0], "") }},
+		{"reorganized", func() error { return blockchain.reorganize(append(blockchain.chain[:2:2], fork...)) }},
+	}
+
+	for _, test := range cases {
+		t.Run(test.name, func(t *testing.T) {
+			if err := test.add(); err == nil {
+				t.Error("a fork below the finalized block was taken")
+			}
+			if blockchain.LastBlock() != tip || len(blockchain.chain) != 5 {
+				t.Errorf("the chain changed to %d blocks", len(blockchain.chain))
+			}
+		})
+	}
+}
+
+func TestForkDepthLimit(t *testing.T) {
+	blockchain := newTestChain(t, testChainConfig(LEDGER_MODE_ACCOUNT))
+	if _, err := blockchain.Generate(MAX_FORK_DEPTH+2, "main"); err != nil {
+		t.Fatal(err)
+	}
+	tip := len(blockchain.chain) - 1
+	deepest := sideBlocks(t, blockchain, tip-MAX_FORK_DEPTH, 2)
+
+	cases := []struct {
+		name     string
+		block    func() *Block
+		accepted bool
+	}{
+		{"at the limit", func() *Block { return deepest[0] }, true},
+		{"below the limit", func() *Block { return sideBlocks(t, blockchain, tip-MAX_FORK_DEPTH-1, 1)[0] }, false},
+		{
+			name: "on a branch that fell below the limit",
+			block: func() *Block {
+				fund(t, blockchain, "main")
+				return deepest[1]
+			},
+			accepted: false,
+		},
+	}
+
+	for _, test := range cases {
+		t.Run(test.name, func(t *testing.T) {
+			err := blockchain.AddBlock(test.block(), "")
+			if test.accepted && err != nil {
+				t.Fatal(err)
+			}
+			if !test.accepted && ErrorCodeOf(err) != ERROR_INVALID_BLOCK {
+				t.Fatalf("added with %v, want %s", err, ERROR_INVALID_BLOCK)
+			}
+		})
+	}
+}
+
+func TestBranchStates(t *testing.T) {
+	blockchain := newTestChain(t, testChainConfig(LEDGER_MODE_UTXO))
+	if _, err := blockchain.Generate(MAX_BRANCH_STATES+2, "main"); err != nil {
+		t.Fatal(err)
+	}
+	tip := len(blockchain.chain) - 1
+
+	// One block forks off at every height, the lowest ones are forgotten
+	forks := make([]*Block, 0)
+	for height := 0; height < tip; height++ {
+		fork := sideBlocks(t, blockchain, height, 1)
+		addBlocks(t, blockchain, fork)
+		forks = append(forks, fork[0])
+	}
+	if len(blockchain.branchStates) != MAX_BRANCH_STATES {
+		t.Fatalf("kept %d branch states, want %d", len(blockchain.branchStates), MAX_BRANCH_STATES)
+	}
+	for i, fork := range forks {
+		if _, ok := blockchain.branchStates[fork.Hash()]; ok != (i >= len(forks)-MAX_BRANCH_STATES) {
+			t.Errorf("kept the state of the fork at height %d: %t", i+1, ok)
+		}
+	}
+
+	// Extending a fork moves its state up, and the reorg drops it
+	highest := forks[len(forks)-1]
+	extension := nextBlock(t, blockchain, append(append([]*Block{}, blockchain.chain[:tip]...), highest),
+		nextTimestamp(blockchain.chain, blockchain.now()))
+	addBlocks(t, blockchain, []*Block{extension})
+	if blockchain.LastBlock() != extension {
+		t.Fatal("the longer fork did not become the chain")
+	}
+	for _, hash := range [][32]byte{highest.Hash(), extension.Hash()} {
+		if _, ok := blockchain.branchStates[hash]; ok {
+			t.Errorf("kept the state of block %x, which is in the chain", hash)
+		}
+	}
+
+	coinbase := OutPoint{extension.transactions[0].Hash(), 0}
+	if _, ok := blockchain.utxoSet.Get(coinbase); !ok {
+		t.Error("the coinbase of the new tip is not unspent")
+	}
+}
+
+func TestReorgAbortsOnInvalidBlock(t *testing.T) {
+	blockchain := newTestChain(t, testChainConfig(LEDGER_MODE_UTXO))
+	if _, err := blockchain.Generate(2, "main"); err != nil {
+		t.Fatal(err)
+	}
+	tip := blockchain.LastBlock()
+	utxos := blockchain.utxoSet.clone()
+
+	missing := NewTransaction("nobody", "recipient", 0)
+	missing.inputs = []*OutPoint{NewOutPoint([32]byte{9}, 0)}
+	missing.outputs = []*TxOutput{NewTxOutput("recipient", 1)}
+	fork := sideBlocks(t, blockchain, 1, 1)
+	branch := append(append([]*Block{}, blockchain.chain[:2]...), fork[0])
+	invalid := nextBlock(t, blockchain, branch, nextTimestamp(branch, blockchain.now()), missing)
+
+	if err := blockchain.reorganize(append(branch, invalid)); err == nil {
+		t.Fatal("reorganized onto a block spending a missing output")
+	}
+	if blockchain.LastBlock() != tip || len(blockchain.chain) != 3 {
+		t.Fatalf("the chain has %d blocks and another tip after the abort", len(blockchain.chain))
+	}
+	if len(blockchain.utxoSet.utxos) != len(utxos.utxos) {
+		t.Errorf("%d outputs are unspent, want the %d from before", len(blockchain.utxoSet.utxos), len(utxos.utxos))
+	}
+	for outPoint := range utxos.utxos {
+		if _, ok := blockchain.utxoSet.Get(outPoint); !ok {
+			t.Errorf("output %s is gone after the abort", outPoint)
+		}
+	}
+	if len(blockchain.Reorgs()) != 0 {
+		t.Error("the aborted reorg was recorded")
+	}
+}
@@ -0,0 +1,422 @@
+package block
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// LedgerMode selects how balances are kept: by summing account-style
+// transfers, or by tracking unspent transaction outputs
+type LedgerMode string
+
+const (
+	LEDGER_MODE_ACCOUNT LedgerMode = "account"
+	LEDGER_MODE_UTXO    LedgerMode = "utxo"
+)
+
+// OutPoint references an output of an earlier Transaction
+type OutPoint struct {
+	transactionId [32]byte
+	index         int
+}
+
+// TxOutput pays value to an address. An output with a lock script
+// can only be spent by an input whose unlock script satisfies it
+type TxOutput struct {
+	address string
+	value   float32
+	script  Script
+}
+
+// UTXO is an unspent TxOutput together with the OutPoint spending it.
+// Coinbase outputs remember their height, they mature only later
+type UTXO struct {
+	outPoint       OutPoint
+	output         *TxOutput
+	coinbaseHeight int
+}
+
+// UTXOSet keeps every unspent output of the chain. Spent outputs of
+// each connected block are remembered, so the block can be disconnected
+type UTXOSet struct {
+	utxos     map[OutPoint]*TxOutput
+	coinbases map[OutPoint]int
+	spent     map[[32]byte][]*UTXO
+}
+
+type TxInputRequest struct {
+	TransactionId *string `json:"transactionId"`
+	Index         *int    `json:"index"`
+	UnlockScript  *string `json:"unlockScript"`
+}
+
+type TxOutputRequest struct {
+	Address *string  `json:"address"`
+	Value   *float32 `json:"value"`
+	Script  *string  `json:"script"`
+}
+
+// ParseLedgerMode converts a string into a LedgerMode,
+// an empty string stands for LEDGER_MODE_ACCOUNT
+func ParseLedgerMode(str string) (LedgerMode, error) {
+	switch ledgerMode := LedgerMode(str); ledgerMode {
+	case "":
+		return LEDGER_MODE_ACCOUNT, nil
+	case LEDGER_MODE_ACCOUNT, LEDGER_MODE_UTXO:
+		return ledgerMode, nil
+	default:
+		return "", fmt.Errorf("unsupported ledger mode %q", str)
+	}
+}
+
+// NewOutPoint generates and returns new OutPoint
+func NewOutPoint(transactionId [32]byte, index int) *OutPoint {
+	return &OutPoint{transactionId, index}
+}
+
+// NewTxOutput generates and returns new TxOutput
+func NewTxOutput(address string, value float32) *TxOutput {
+	return &TxOutput{address: address, value: value}
+}
+
+// NewScriptTxOutput generates and returns new TxOutput locked by the
+// Script, paying to the address derived from it
+func NewScriptTxOutput(script Script, value float32) *TxOutput {
+	return &TxOutput{address: ScriptAddress(script), value: value, script: script}
+}
+
+// NewUTXOSet generates and returns empty UTXOSet
+func NewUTXOSet() *UTXOSet {
+	return &UTXOSet{
+		utxos:     make(map[OutPoint]*TxOutput),
+		coinbases: make(map[OutPoint]int),
+		spent:     make(map[[32]byte][]*UTXO),
+	}
+}
+
+func (outPoint OutPoint) String() string {
+	return fmt.Sprintf("%x:%d", outPoint.transactionId, outPoint.index)
+}
+
+func (outPoint *OutPoint) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		TransactionId string `json:"transactionId"`
+		Index         int    `json:"index"`
+	}{
+		TransactionId: fmt.Sprintf("%x", outPoint.transactionId),
+		Index:         outPoint.index,
+	})
+}
+
+func (output *TxOutput) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Address string  `json:"address"`
+		Value   float32 `json:"value"`
+		Script  string  `json:"script,omitempty"`
+	}{
+		Address: output.address,
+		Value:   output.value,
+		Script:  hex.EncodeToString(output.script),
+	})
+}
+
+func (utxo *UTXO) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		TransactionId string  `json:"transactionId"`
+		Index         int     `json:"index"`
+		Address       string  `json:"address"`
+		Value         float32 `json:"value"`
+		Script        string  `json:"script,omitempty"`
+	}{
+		TransactionId: fmt.Sprintf("%x", utxo.outPoint.transactionId),
+		Index:         utxo.outPoint.index,
+		Address:       utxo.output.address,
+		Value:         utxo.output.value,
+		Script:        hex.EncodeToString(utxo.output.script),
+	})
+}
+
+// Outputs returns the outputs created by the Transaction. An account-style
+// transfer has a single implicit output paying value to the recipient
+func (transaction *Transaction) Outputs() []*TxOutput {
+	if len(transaction.outputs) > 0 {
+		return transaction.outputs
+	}
+	if transaction.recipientAddress == "" {
+		return nil
+	}
+
+	return []*TxOutput{NewTxOutput(transaction.recipientAddress, transaction.value)}
+}
+
+// Get returns the unspent output at the OutPoint, if there is one
+func (utxoSet *UTXOSet) Get(outPoint OutPoint) (*TxOutput, bool) {
+	output, ok := utxoSet.utxos[outPoint]
+	return output, ok
+}
+
+// CoinbaseHeight returns the height of the coinbase that created
+// the unspent output, if it was created by one
+func (utxoSet *UTXOSet) CoinbaseHeight(outPoint OutPoint) (int, bool) {
+	height, ok := utxoSet.coinbases[outPoint]
+	return height, ok
+}
+
+func (utxoSet *UTXOSet) utxo(outPoint OutPoint, output *TxOutput) *UTXO {
+	utxo := &UTXO{outPoint: outPoint, output: output, coinbaseHeight: -1}
+	if height, ok := utxoSet.coinbases[outPoint]; ok {
+		utxo.coinbaseHeight = height
+	}
+
+	return utxo
+}
+
+// FindByAddress returns all unspent outputs paying to the address,
+// ordered by transaction ID and index
+func (utxoSet *UTXOSet) FindByAddress(address string) []*UTXO {
+	utxos := make([]*UTXO, 0)
+	for outPoint, output := range utxoSet.utxos {
+		if output.address == address {
+			utxos = append(utxos, utxoSet.utxo(outPoint, output))
+		}
+	}
+
+	sort.Slice(utxos, func(i, j int) bool {
+		return utxos[i].outPoint.String() < utxos[j].outPoint.String()
+	})
+
+	return utxos
+}
+
+// connectBlock spends the inputs and adds the outputs of every
+// Transaction in the block at the height. A block spending an output
+// that is missing or spent already is refused and changes nothing
+func (utxoSet *UTXOSet) connectBlock(block *Block, height int) error {
+	spending := make(map[OutPoint]bool)
+	for _, transaction := range block.transactions {
+		for _, input := range transaction.inputs {
+			if _, ok := utxoSet.utxos[*input]; !ok || spending[*input] {
+				return fmt.Errorf("input %s is spent or does not exist", input)
+			}
+			spending[*input] = true
+		}
+	}
+
+	spent := make([]*UTXO, 0)
+	for _, transaction := range block.transactions {
+		for _, input := range transaction.inputs {
+			spent = append(spent, utxoSet.utxo(*input, utxoSet.utxos[*input]))
+			delete(utxoSet.utxos, *input)
+			delete(utxoSet.coinbases, *input)
+		}
+
+		transactionId := transaction.Hash()
+		for i, output := range transaction.Outputs() {
+			// A coinbase past the max supply pays nothing
+			if output.value == 0 {
+				continue
+			}
+
+			outPoint := OutPoint{transactionId, i}
+			utxoSet.utxos[outPoint] = output
+			if transaction.IsCoinbase() {
+				utxoSet.coinbases[outPoint] = height
+			}
+		}
+	}
+
+	utxoSet.spent[block.Hash()] = spent
+	return nil
+}
+
+// clone returns a copy of the UTXOSet that can be changed on its own
+func (utxoSet *UTXOSet) clone() *UTXOSet {
+	clone := NewUTXOSet()
+	for outPoint, output := range utxoSet.utxos {
+		clone.utxos[outPoint] = output
+	}
+	for outPoint, height := range utxoSet.coinbases {
+		clone.coinbases[outPoint] = height
+	}
+	for blockHash, spent := range utxoSet.spent {
+		clone.spent[blockHash] = spent
+	}
+
+	return clone
+}
+
+// disconnectBlock removes the outputs of the block and restores
+// the outputs it had spent
+func (utxoSet *UTXOSet) disconnectBlock(block *Block) {
+	for _, transaction := range block.transactions {
+		transactionId := transaction.Hash()
+		for i := range transaction.Outputs() {
+			delete(utxoSet.utxos, OutPoint{transactionId, i})
+			delete(utxoSet.coinbases, OutPoint{transactionId, i})
+		}
+	}
+
+	blockHash := block.Hash()
+	for _, utxo := range utxoSet.spent[blockHash] {
+		utxoSet.utxos[utxo.outPoint] = utxo.output
+		if utxo.coinbaseHeight >= 0 {
+			utxoSet.coinbases[utxo.outPoint] = utxo.coinbaseHeight
+		}
+	}
+	delete(utxoSet.spent, blockHash)
+}
+
+// verifyUTXOTransaction checks that every input is unspent in the
+// ledgerState and not already spent by a pending Transaction, that the
+// inputs cover the outputs, and that every input is either owned by the
+// sender or satisfies the lock script of the output it spends
+func (blockchain *Blockchain) verifyUTXOTransaction(state *ledgerState, transaction *Transaction) error {
+	if len(transaction.inputs) == 0 || len(transaction.outputs) == 0 {
+		return errors.New("UTXO transaction needs inputs and outputs")
+	}
+	if err := verifyOutputs(transaction.outputs); err != nil {
+		return err
+	}
+	if len(transaction.unlockScripts) > 0 && len(transaction.unlockScripts) != len(transaction.inputs) {
+		return errors.New("unlock scripts do not match inputs")
+	}
+
+	var inputsValue float32
+	var context *ScriptContext
+	seen := make(map[OutPoint]bool)
+	for i, input := range transaction.inputs {
+		if seen[*input] {
+			return fmt.Errorf("input %s is spent twice", input)
+		}
+		seen[*input] = true
+
+		if spender, ok := state.pending.Spender(*input); ok {
+			return Errorf(ERROR_DOUBLE_SPEND, "input %s is already spent by pending transaction %x", input, spender)
+		}
+
+		output, ok := state.utxoSet.Get(*input)
+		if !ok {
+			return fmt.Errorf("input %s is spent or does not exist", input)
+		}
+		if height, ok := state.utxoSet.CoinbaseHeight(*input); ok && !blockchain.isMature(state, height) {
+			return fmt.Errorf("input %s spends a coinbase of height %d before maturity", input, height)
+		}
+
+		if output.script != nil {
+			if context == nil {
+				context = NewScriptContext(transaction)
+			}
+			if err := ExecuteScript(transaction.unlockScript(i), output.script, context); err != nil {
+				return fmt.Errorf("input %s: %w", input, err)
+			}
+		} else if output.address != transaction.senderAddress {
+			return fmt.Errorf("input %s does not belong to %s", input, transaction.senderAddress)
+		}
+
+		inputsValue += output.value
+	}
+
+	if outputsValue := transaction.Cost(); outputsValue > inputsValue {
+		return Errorf(ERROR_INSUFFICIENT_FUNDS, "outputs %.8f and fee exceed inputs %.8f", outputsValue, inputsValue)
+	}
+
+	return nil
+}
+
+// isScriptSpend tells whether every input of the Transaction spends
+// a script-locked output, so the scripts alone authorise it
+func (blockchain *Blockchain) isScriptSpend(state *ledgerState, transaction *Transaction) bool {
+	if blockchain.ledgerMode != LEDGER_MODE_UTXO || len(transaction.inputs) == 0 {
+		return false
+	}
+
+	for _, input := range transaction.inputs {
+		output, ok := state.utxoSet.Get(*input)
+		if !ok || output.script == nil {
+			return false
+		}
+	}
+
+	return true
+}
+
+// unlockScript returns the unlock script of the input at index, if any
+func (transaction *Transaction) unlockScript(index int) Script {
+	if index >= len(transaction.unlockScripts) {
+		return nil
+	}
+
+	return transaction.unlockScripts[index]
+}
+
+// UTXOs returns the unspent outputs of the address
+func (blockchain *Blockchain) UTXOs(address string) []*UTXO {
+	blockchain.mux.Lock()
+	defer blockchain.mux.Unlock()
+
+	return blockchain.utxoSet.FindByAddress(address)
+}
+
+// LedgerMode returns how the Blockchain keeps balances
+func (blockchain *Blockchain) LedgerMode() LedgerMode {
+	return blockchain.ledgerMode
+}
+
+// Script decodes the unlock script of the request, nil when omitted
+func (inputRequest *TxInputRequest) Script() (Script, error) {
+	if inputRequest.UnlockScript == nil || *inputRequest.UnlockScript == "" {
+		return nil, nil
+	}
+
+	script, err := hex.DecodeString(*inputRequest.UnlockScript)
+	if err != nil {
+		return nil, fmt.Errorf("invalid unlock script %q", *inputRequest.UnlockScript)
+	}
+
+	return script, nil
+}
+
+// OutPoint decodes the referenced output of the request
+func (inputRequest *TxInputRequest) OutPoint() (*OutPoint, error) {
+	if inputRequest == nil || inputRequest.TransactionId == nil || inputRequest.Index == nil {
+		return nil, errors.New("input needs transactionId and index")
+	}
+
+	transactionId, err := decodeTransactionId(*inputRequest.TransactionId)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewOutPoint(*transactionId, *inputRequest.Index), nil
+}
+
+// TxOutput decodes the output of the request. The address of
+// a script output is derived from the script and may be omitted
+func (outputRequest *TxOutputRequest) TxOutput() (*TxOutput, error) {
+	if outputRequest == nil || outputRequest.Value == nil {
+		return nil, errors.New("output needs address and value")
+	}
+
+	if outputRequest.Script == nil || *outputRequest.Script == "" {
+		if outputRequest.Address == nil {
+			return nil, errors.New("output needs address and value")
+		}
+
+		return NewTxOutput(*outputRequest.Address, *outputRequest.Value), nil
+	}
+
+	script, err := hex.DecodeString(*outputRequest.Script)
+	if err != nil || len(script) > MAX_SCRIPT_SIZE {
+		return nil, fmt.Errorf("invalid script %q", *outputRequest.Script)
+	}
+
+	output := NewScriptTxOutput(script, *outputRequest.Value)
+	if outputRequest.Address != nil && *outputRequest.Address != output.address {
+		return nil, fmt.Errorf("address %q does not match the script", *outputRequest.Address)
+	}
+
+	return output, nil
+}
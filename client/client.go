@@ -0,0 +1,239 @@
+package client
+
+import (
+	"bytes"
+	"crypto-blockchain/block"
+	"crypto-blockchain/wallet"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Client talks to the blockchain server at the gateway URL through
+// the HTTP API described by api/blockchain.yaml
+type Client struct {
+	gateway    string
+	httpClient *http.Client
+}
+
+// Error is the ErrorResponse a blockchain server answered a request with
+type Error struct {
+	StatusCode int
+	Body       block.ErrorBody
+}
+
+type ChainResponse struct {
+	Chain []*block.Block `json:"chains"`
+}
+
+type TransactionsResponse struct {
+	Transactions []*block.Transaction `json:"transactions"`
+	Length       int                  `json:"length"`
+	Total        int                  `json:"total"`
+}
+
+type BlockResponse struct {
+	Block   *block.Block `json:"block"`
+	Height  int          `json:"height"`
+	InChain bool         `json:"inChain"`
+}
+
+type NetworkResponse struct {
+	ChainId     string `json:"chainId"`
+	GenesisHash string `json:"genesisHash"`
+}
+
+const CLIENT_TIMEOUT_SEC = 30
+
+// NewClient generates and returns new Client of the blockchain
+// server at the gateway, e.g. http://127.0.0.1:5655
+func NewClient(gateway string) *Client {
+	return &Client{
+		gateway:    gateway,
+		httpClient: &http.Client{Timeout: time.Second * CLIENT_TIMEOUT_SEC},
+	}
+}
+
+func (err *Error) Error() string {
+	return err.Body.Message
+}
+
+func (err *Error) Code() block.ErrorCode {
+	return err.Body.Code
+}
+
+func (client *Client) Gateway() string {
+	return client.gateway
+}
+
+// Chain returns the blocks of the chain, genesis block first
+func (client *Client) Chain() ([]*block.Block, error) {
+	var chainResponse ChainResponse
+	if err := client.get("/", nil, &chainResponse); err != nil {
+		return nil, err
+	}
+
+	return chainResponse.Chain, nil
+}
+
+// Transactions returns the page of pending transactions the MempoolQuery
+// selects, a nil query returns them all in the order they arrived
+func (client *Client) Transactions(query *block.MempoolQuery) (*TransactionsResponse, error) {
+	values := url.Values{}
+	if query != nil {
+		setIfNotEmpty(values, "sender", query.Sender)
+		setIfNotEmpty(values, "recipient", query.Recipient)
+		setIfNotEmpty(values, "sort", query.SortBy)
+		if query.Descending {
+			values.Set("order", "desc")
+		} else if query.SortBy != "" {
+			values.Set("order", "asc")
+		}
+		if query.Offset != 0 {
+			values.Set("offset", strconv.Itoa(query.Offset))
+		}
+		if query.Limit != 0 {
+			values.Set("limit", strconv.Itoa(query.Limit))
+		}
+	}
+
+	var transactionsResponse TransactionsResponse
+	if err := client.get("/transactions", values, &transactionsResponse); err != nil {
+		return nil, err
+	}
+
+	return &transactionsResponse, nil
+}
+
+// SubmitTransaction posts the signed transaction and returns its ID
+func (client *Client) SubmitTransaction(transactionRequest *block.TransactionRequest) (string, error) {
+	var submitted struct {
+		Id string `json:"id"`
+	}
+	if err := client.post("/transactions", transactionRequest, &submitted); err != nil {
+		return "", err
+	}
+
+	return submitted.Id, nil
+}
+
+// Mine asks the node to mine a block right away
+func (client *Client) Mine() error {
+	return client.get("/mine", nil, nil)
+}
+
+// Amount returns the balance of the address
+func (client *Client) Amount(address string) (float32, error) {
+	var amountResponse block.AmountResponse
+	if err := client.get("/amount", url.Values{"address": {address}}, &amountResponse); err != nil {
+		return 0, err
+	}
+
+	return amountResponse.Amount, nil
+}
+
+// UTXOs returns the unspent outputs of the address, for nodes keeping a UTXO ledger
+func (client *Client) UTXOs(address string) ([]*wallet.UTXO, error) {
+	var utxosResponse struct {
+		UTXOs []*wallet.UTXO `json:"utxos"`
+	}
+	if err := client.get("/utxos", url.Values{"address": {address}}, &utxosResponse); err != nil {
+		return nil, err
+	}
+
+	return utxosResponse.UTXOs, nil
+}
+
+// Block returns the known block with the hex-encoded hash
+func (client *Client) Block(hash string) (*BlockResponse, error) {
+	var blockResponse BlockResponse
+	if err := client.get("/blocks", url.Values{"hash": {hash}}, &blockResponse); err != nil {
+		return nil, err
+	}
+
+	return &blockResponse, nil
+}
+
+// Network returns the chain ID and the genesis hash of the node
+func (client *Client) Network() (*NetworkResponse, error) {
+	var networkResponse NetworkResponse
+	if err := client.get("/network", nil, &networkResponse); err != nil {
+		return nil, err
+	}
+
+	return &networkResponse, nil
+}
+
+func (client *Client) get(path string, values url.Values, result interface{}) error {
+	endpoint := client.gateway + path
+	if len(values) > 0 {
+		endpoint += "?" + values.Encode()
+	}
+
+	req, err := http.NewRequest(http.MethodGet, endpoint, nil)
+	if err != nil {
+		return err
+	}
+
+	return client.do(req, result)
+}
+
+func (client *Client) post(path string, body interface{}, result interface{}) error {
+	marshal, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, client.gateway+path, bytes.NewReader(marshal))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	return client.do(req, result)
+}
+
+// do sends the request and decodes the answer into result. Failures
+// are returned as Error, with the ErrorResponse of the node when it sent one
+func (client *Client) do(req *http.Request, result interface{}) error {
+	resp, err := client.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		var errorResponse block.ErrorResponse
+		if err := json.Unmarshal(body, &errorResponse); err != nil || errorResponse.Error.Code == "" {
+			errorResponse.Error = block.ErrorBody{
+				Code:    block.ERROR_GATEWAY,
+				Message: fmt.Sprintf("blockchain server answered %s", resp.Status),
+			}
+		}
+		return &Error{StatusCode: resp.StatusCode, Body: errorResponse.Error}
+	}
+
+	if result == nil {
+		return nil
+	}
+	if err := json.Unmarshal(body, result); err != nil {
+		return fmt.Errorf("decoding answer of %s: %w", req.URL.Path, err)
+	}
+
+	return nil
+}
+
+func setIfNotEmpty(values url.Values, key string, value string) {
+	if value != "" {
+		values.Set(key, value)
+	}
+}
@@ -0,0 +1,368 @@
+package client
+
+import (
+	"crypto-blockchain/block"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+// openAPI is the part of api/blockchain.yaml the client is checked against
+type openAPI struct {
+	Paths      map[string]map[string]*specOperation `yaml:"paths"`
+	Components struct {
+		Parameters map[string]*specParameter `yaml:"parameters"`
+		Responses  map[string]*specResponse  `yaml:"responses"`
+		Schemas    map[string]*specSchema    `yaml:"schemas"`
+	} `yaml:"components"`
+}
+
+type specOperation struct {
+	Parameters  []*specParameter         `yaml:"parameters"`
+	RequestBody *specResponse            `yaml:"requestBody"`
+	Responses   map[string]*specResponse `yaml:"responses"`
+}
+
+type specParameter struct {
+	Ref      string `yaml:"$ref"`
+	Name     string `yaml:"name"`
+	In       string `yaml:"in"`
+	Required bool   `yaml:"required"`
+}
+
+type specResponse struct {
+	Ref     string `yaml:"$ref"`
+	Content map[string]struct {
+		Schema *specSchema `yaml:"schema"`
+	} `yaml:"content"`
+}
+
+type specSchema struct {
+	Ref        string                 `yaml:"$ref"`
+	Properties map[string]*specSchema `yaml:"properties"`
+	Items      *specSchema            `yaml:"items"`
+	OneOf      []*specSchema          `yaml:"oneOf"`
+}
+
+// clientCase calls one method of Client. The fake node answers with the
+// answer, which must fit the documented response, and the method must
+// return the want. Result is the Go type the answer is decoded into
+type clientCase struct {
+	name   string
+	method string
+	path   string
+	call   func(client *Client) (interface{}, error)
+	answer string
+	want   interface{}
+	body   interface{}
+	result interface{}
+}
+
+func loadSpec(t *testing.T) *openAPI {
+	data, err := os.ReadFile("../api/blockchain.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var spec openAPI
+	if err := yaml.Unmarshal(data, &spec); err != nil {
+		t.Fatal(err)
+	}
+
+	return &spec
+}
+
+func (spec *openAPI) parameter(parameter *specParameter) *specParameter {
+	if parameter.Ref == "" {
+		return parameter
+	}
+	return spec.Components.Parameters[strings.TrimPrefix(parameter.Ref, "#/components/parameters/")]
+}
+
+func (spec *openAPI) response(response *specResponse) *specResponse {
+	if response.Ref == "" {
+		return response
+	}
+	return spec.Components.Responses[strings.TrimPrefix(response.Ref, "#/components/responses/")]
+}
+
+func (spec *openAPI) schema(schema *specSchema) *specSchema {
+	if schema == nil || schema.Ref == "" {
+		return schema
+	}
+	return spec.Components.Schemas[strings.TrimPrefix(schema.Ref, "#/components/schemas/")]
+}
+
+// properties returns the properties of the schema, of any of its
+// alternatives when it has some
+func (spec *openAPI) properties(schema *specSchema) map[string]*specSchema {
+	schema = spec.schema(schema)
+	properties := make(map[string]*specSchema)
+	for name, property := range schema.Properties {
+		properties[name] = property
+	}
+	for _, alternative := range schema.OneOf {
+		for name, property := range spec.properties(alternative) {
+			properties[name] = property
+		}
+	}
+
+	return properties
+}
+
+// checkType fails the test for every JSON field of the Go type that the
+// schema does not document. Types encoding themselves are left out
+func (spec *openAPI) checkType(t *testing.T, where string, goType reflect.Type, schema *specSchema) {
+	t.Helper()
+	for goType.Kind() == reflect.Ptr {
+		goType = goType.Elem()
+	}
+	schema = spec.schema(schema)
+	if schema == nil {
+		t.Errorf("%s: %s is not documented", where, goType)
+		return
+	}
+
+	switch goType.Kind() {
+	case reflect.Slice:
+		if schema.Items == nil {
+			t.Errorf("%s: %s is not documented as an array", where, goType)
+			return
+		}
+		spec.checkType(t, where+"[]", goType.Elem(), schema.Items)
+
+	case reflect.Struct:
+		if reflect.PtrTo(goType).Implements(reflect.TypeOf((*json.Marshaler)(nil)).Elem()) {
+			return
+		}
+		properties := spec.properties(schema)
+		for i := 0; i < goType.NumField(); i++ {
+			name := strings.Split(goType.Field(i).Tag.Get("json"), ",")[0]
+			if name == "" || name == "-" {
+				continue
+			}
+			property, ok := properties[name]
+			if !ok {
+				t.Errorf("%s: field %s of %s is not documented", where, name, goType)
+				continue
+			}
+			spec.checkType(t, where+"."+name, goType.Field(i).Type, property)
+		}
+	}
+}
+
+func TestClientMatchesSpec(t *testing.T) {
+	spec := loadSpec(t)
+
+	hash := strings.Repeat("ab", 32)
+	sender, value := "sender", float32(1)
+	cases := []clientCase{
+		{
+			name:   "Chain",
+			method: http.MethodGet,
+			path:   "/",
+			call:   func(client *Client) (interface{}, error) { return client.Chain() },
+			answer: `{"chains": []}`,
+			want:   []*block.Block{},
+			result: ChainResponse{},
+		},
+		{
+			name:   "Transactions",
+			method: http.MethodGet,
+			path:   "/transactions",
+			call: func(client *Client) (interface{}, error) {
+				response, err := client.Transactions(&block.MempoolQuery{
+					Sender:     "sender",
+					Recipient:  "recipient",
+					SortBy:     "fee",
+					Descending: true,
+					Offset:     1,
+					Limit:      2,
+				})
+				if err != nil {
+					return nil, err
+				}
+				return response.Total, nil
+			},
+			answer: `{"transactions": [], "length": 0, "total": 3}`,
+			want:   3,
+			result: TransactionsResponse{},
+		},
+		{
+			name:   "SubmitTransaction",
+			method: http.MethodPost,
+			path:   "/transactions",
+			call: func(client *Client) (interface{}, error) {
+				return client.SubmitTransaction(&block.TransactionRequest{SenderAddress: &sender, Value: &value})
+			},
+			answer: `{"id": "` + hash + `"}`,
+			want:   hash,
+			body:   block.TransactionRequest{},
+		},
+		{
+			name:   "Mine",
+			method: http.MethodGet,
+			path:   "/mine",
+			call:   func(client *Client) (interface{}, error) { return nil, client.Mine() },
+			answer: `{"message": "mined"}`,
+		},
+		{
+			name:   "Amount",
+			method: http.MethodGet,
+			path:   "/amount",
+			call:   func(client *Client) (interface{}, error) { return client.Amount("address") },
+			answer: `{"amount": 1.5}`,
+			want:   float32(1.5),
+			result: block.AmountResponse{},
+		},
+		{
+			name:   "UTXOs",
+			method: http.MethodGet,
+			path:   "/utxos",
+			call: func(client *Client) (interface{}, error) {
+				utxos, err := client.UTXOs("address")
+				if err != nil {
+					return nil, err
+				}
+				return utxos[0].Value, nil
+			},
+			answer: `{"utxos": [{"transactionId": "` + hash + `", "index": 0, "address": "address", "value": 2}], "length": 1}`,
+			want:   float32(2),
+		},
+		{
+			name:   "Block",
+			method: http.MethodGet,
+			path:   "/blocks",
+			call: func(client *Client) (interface{}, error) {
+				response, err := client.Block(hash)
+				if err != nil {
+					return nil, err
+				}
+				return response.Height, nil
+			},
+			answer: `{"height": 4, "inChain": true}`,
+			want:   4,
+			result: BlockResponse{},
+		},
+		{
+			name:   "Network",
+			method: http.MethodGet,
+			path:   "/network",
+			call: func(client *Client) (interface{}, error) {
+				response, err := client.Network()
+				if err != nil {
+					return nil, err
+				}
+				return response.ChainId, nil
+			},
+			answer: `{"chainId": "devnet", "genesisHash": "` + hash + `"}`,
+			want:   "devnet",
+			result: NetworkResponse{},
+		},
+	}
+
+	for _, test := range cases {
+		t.Run(test.name, func(t *testing.T) {
+			operation, ok := spec.Paths[test.path][strings.ToLower(test.method)]
+			if !ok {
+				t.Fatalf("%s %s is not documented", test.method, test.path)
+			}
+
+			// The node answers with the lowest success documented
+			var success *specResponse
+			status := 0
+			for code, response := range operation.Responses {
+				documented, err := strconv.Atoi(code)
+				if err == nil && documented/100 == 2 && (success == nil || documented < status) {
+					success = spec.response(response)
+					status = documented
+				}
+			}
+			if success == nil {
+				t.Fatalf("%s %s documents no success", test.method, test.path)
+			}
+			successSchema := success.Content["application/json"].Schema
+
+			var answered map[string]interface{}
+			if err := json.Unmarshal([]byte(test.answer), &answered); err != nil {
+				t.Fatal(err)
+			}
+			properties := spec.properties(successSchema)
+			for name := range answered {
+				if _, ok := properties[name]; !ok {
+					t.Errorf("answer field %s is not documented", name)
+				}
+			}
+			if test.result != nil {
+				spec.checkType(t, "response", reflect.TypeOf(test.result), successSchema)
+			}
+			if test.body != nil {
+				spec.checkType(t, "request", reflect.TypeOf(test.body), operation.RequestBody.Content["application/json"].Schema)
+			}
+
+			var req *http.Request
+			var body []byte
+			node := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, received *http.Request) {
+				req = received
+				body, _ = io.ReadAll(received.Body)
+				writer.Header().Set("Content-Type", "application/json")
+				writer.WriteHeader(status)
+				io.WriteString(writer, test.answer)
+			}))
+			defer node.Close()
+
+			got, err := test.call(NewClient(node.URL))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if test.want != nil && !reflect.DeepEqual(got, test.want) {
+				t.Errorf("returned %#v, want %#v", got, test.want)
+			}
+
+			if req.Method != test.method || req.URL.Path != test.path {
+				t.Errorf("requested %s %s, want %s %s", req.Method, req.URL.Path, test.method, test.path)
+			}
+
+			query := req.URL.Query()
+			declared := make(map[string]bool)
+			for _, parameter := range operation.Parameters {
+				parameter = spec.parameter(parameter)
+				if parameter.In != "query" {
+					continue
+				}
+				declared[parameter.Name] = true
+				if parameter.Required && !query.Has(parameter.Name) {
+					t.Errorf("required parameter %s is not sent", parameter.Name)
+				}
+			}
+			for name := range query {
+				if !declared[name] {
+					t.Errorf("parameter %s is not documented", name)
+				}
+			}
+
+			if operation.RequestBody != nil {
+				var sent map[string]interface{}
+				if err := json.Unmarshal(body, &sent); err != nil {
+					t.Fatalf("request body: %v", err)
+				}
+				properties := spec.properties(operation.RequestBody.Content["application/json"].Schema)
+				for name := range sent {
+					if _, ok := properties[name]; !ok {
+						t.Errorf("request field %s is not documented", name)
+					}
+				}
+			} else if len(body) > 0 {
+				t.Errorf("sent a body the operation does not take")
+			}
+		})
+	}
+}
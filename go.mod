@@ -6,3 +6,18 @@ require (
 	github.com/btcsuite/btcutil v1.0.2
 	golang.org/x/crypto v0.0.0-20220525230936-793ad666bf5e
 )
+
+require (
+	github.com/decred/dcrd/dcrec/secp256k1/v4 v4.0.1
+	google.golang.org/genproto/googleapis/rpc v0.0.0-20230525234030-28d5490b6b19
+	google.golang.org/grpc v1.57.2
+	google.golang.org/protobuf v1.31.0
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+require (
+	github.com/golang/protobuf v1.5.3 // indirect
+	golang.org/x/net v0.9.0 // indirect
+	golang.org/x/sys v0.7.0 // indirect
+	golang.org/x/text v0.9.0 // indirect
+)
@@ -14,6 +14,7 @@ func main() {
 	w := wallet.NewWallet()
 	fmt.Println(w.Address())
 
-	t := wallet.NewTransaction(w.PrivateKey(), w.PublicKey(), w.Address(), "B", 1.0)
-	fmt.Printf("signature %s\n", t.GenerateSignature())
+	t := wallet.NewTransaction(w.Signer(), w.Address(), "B", 1.0)
+	signature, _ := t.GenerateSignature()
+	fmt.Printf("signature %x\n", signature)
 }
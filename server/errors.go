@@ -0,0 +1,39 @@
+package main
+
+import (
+	"crypto-blockchain/block"
+	"encoding/json"
+	"net/http"
+)
+
+// writeError answers with the ErrorResponse of the error. Errors
+// without an ErrorCode of their own are reported with the code
+func writeError(writer http.ResponseWriter, code block.ErrorCode, err error) {
+	err = block.WrapError(code, err)
+	marshal, _ := json.Marshal(block.NewErrorResponse(err))
+
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(block.ErrorCodeOf(err).StatusCode())
+	writer.Write(marshal)
+}
+
+// writeErrorMessage answers with an ErrorResponse of the code and message
+func writeErrorMessage(writer http.ResponseWriter, code block.ErrorCode, message string) {
+	writeError(writer, code, block.NewError(code, message))
+}
+
+func writeMethodNotAllowed(writer http.ResponseWriter) {
+	writeErrorMessage(writer, block.ERROR_METHOD_NOT_ALLOWED, "405 - Method not allowed")
+}
+
+// writeMessage answers with a JSON message for requests without a result
+func writeMessage(writer http.ResponseWriter, message string) {
+	marshal, _ := json.Marshal(struct {
+		Message string `json:"message"`
+	}{
+		Message: message,
+	})
+
+	writer.Header().Set("Content-Type", "application/json")
+	writer.Write(marshal)
+}
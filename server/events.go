@@ -0,0 +1,302 @@
+package main
+
+import (
+	"crypto-blockchain/block"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// EventHub fans the events of Blockchain out to the subscribers
+// of the event stream
+type EventHub struct {
+	mux         sync.Mutex
+	sequence    uint64
+	subscribers map[*subscriber]bool
+}
+
+// subscriber receives the events of the types it asked for. With
+// addresses, transaction events are limited to the ones involving them
+type subscriber struct {
+	events    chan *event
+	types     map[string]bool
+	addresses map[string]bool
+}
+
+type event struct {
+	id        uint64
+	eventType string
+	data      []byte
+}
+
+const (
+	EVENT_BLOCK       = "block"
+	EVENT_TRANSACTION = "transaction"
+	EVENT_REORG       = "reorg"
+	EVENT_ADDRESS     = "address"
+
+	ADDRESS_STATUS_PENDING  = "pending"
+	ADDRESS_STATUS_INCLUDED = "included"
+
+	EVENT_BUFFER_SIZE    = 256
+	EVENT_KEEP_ALIVE_SEC = 15
+)
+
+var eventTypes = []string{EVENT_BLOCK, EVENT_TRANSACTION, EVENT_REORG, EVENT_ADDRESS}
+
+// NewEventHub generates and returns new EventHub
+func NewEventHub() *EventHub {
+	return &EventHub{subscribers: make(map[*subscriber]bool)}
+}
+
+// Listen registers the EventHub as listener of the Blockchain
+func (hub *EventHub) Listen(blockchain *block.Blockchain) {
+	blockchain.OnBlock(hub.publishBlock)
+	blockchain.OnTransaction(hub.publishTransaction)
+	blockchain.OnReorg(hub.publishReorg)
+}
+
+func (hub *EventHub) subscribe(types []string, addresses []string) (*subscriber, error) {
+	subscriber := &subscriber{
+		events:    make(chan *event, EVENT_BUFFER_SIZE),
+		types:     make(map[string]bool),
+		addresses: make(map[string]bool),
+	}
+
+	for _, eventType := range types {
+		if !isEventType(eventType) {
+			return nil, block.Errorf(block.ERROR_INVALID_REQUEST, "unsupported event type %q", eventType)
+		}
+		subscriber.types[eventType] = true
+	}
+	if subscriber.types[EVENT_ADDRESS] && len(addresses) == 0 {
+		return nil, block.NewError(block.ERROR_INVALID_REQUEST, "address events need at least one address")
+	}
+
+	// Without types, everything the filters allow is streamed
+	if len(types) == 0 {
+		for _, eventType := range eventTypes {
+			subscriber.types[eventType] = true
+		}
+	}
+	for _, address := range addresses {
+		subscriber.addresses[address] = true
+	}
+
+	hub.mux.Lock()
+	defer hub.mux.Unlock()
+
+	hub.subscribers[subscriber] = true
+
+	return subscriber, nil
+}
+
+func (hub *EventHub) unsubscribe(subscriber *subscriber) {
+	hub.mux.Lock()
+	defer hub.mux.Unlock()
+
+	hub.drop(subscriber)
+}
+
+// drop closes the events of the subscriber once, whether it
+// went away or could not keep up
+func (hub *EventHub) drop(subscriber *subscriber) {
+	if hub.subscribers[subscriber] {
+		delete(hub.subscribers, subscriber)
+		close(subscriber.events)
+	}
+}
+
+// publish sends the event to the subscribers matching it. Publishing runs
+// while Blockchain is locked, so a subscriber whose buffer is full is
+// dropped instead of waited for
+func (hub *EventHub) publish(eventType string, value interface{}, matches func(*subscriber) bool) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return
+	}
+
+	hub.mux.Lock()
+	defer hub.mux.Unlock()
+
+	var published *event
+	for subscriber := range hub.subscribers {
+		if !subscriber.types[eventType] || (matches != nil && !matches(subscriber)) {
+			continue
+		}
+
+		if published == nil {
+			hub.sequence++
+			published = &event{id: hub.sequence, eventType: eventType, data: data}
+		}
+		select {
+		case subscriber.events <- published:
+		default:
+			hub.drop(subscriber)
+		}
+	}
+}
+
+// idle tells whether no one subscribed to the events
+func (hub *EventHub) idle() bool {
+	hub.mux.Lock()
+	defer hub.mux.Unlock()
+
+	return len(hub.subscribers) == 0
+}
+
+func (hub *EventHub) publishBlock(published *block.Block, height int) {
+	// Marshalling the Block and its transactions is wasted without subscribers
+	if hub.idle() {
+		return
+	}
+
+	hub.publish(EVENT_BLOCK, struct {
+		Hash   string       `json:"hash"`
+		Height int          `json:"height"`
+		Block  *block.Block `json:"block"`
+	}{
+		Hash:   fmt.Sprintf("%x", published.Hash()),
+		Height: height,
+		Block:  published,
+	}, nil)
+
+	for _, transaction := range published.Transactions() {
+		hub.publishAddressActivity(transaction, ADDRESS_STATUS_INCLUDED, &height)
+	}
+}
+
+func (hub *EventHub) publishTransaction(transaction *block.Transaction) {
+	hub.publish(EVENT_TRANSACTION, struct {
+		Id          string             `json:"id"`
+		Transaction *block.Transaction `json:"transaction"`
+	}{
+		Id:          fmt.Sprintf("%x", transaction.Hash()),
+		Transaction: transaction,
+	}, func(subscriber *subscriber) bool {
+		return subscriber.watches(transaction)
+	})
+
+	hub.publishAddressActivity(transaction, ADDRESS_STATUS_PENDING, nil)
+}
+
+func (hub *EventHub) publishReorg(reorg *block.ReorgEvent) {
+	hub.publish(EVENT_REORG, reorg, nil)
+}
+
+// publishAddressActivity tells each subscriber watching an address
+// of the Transaction that it is pending or included at the height
+func (hub *EventHub) publishAddressActivity(transaction *block.Transaction, status string, height *int) {
+	hub.mux.Lock()
+	addresses := make(map[string]bool)
+	for subscriber := range hub.subscribers {
+		if subscriber.types[EVENT_ADDRESS] {
+			for address := range subscriber.addresses {
+				addresses[address] = true
+			}
+		}
+	}
+	hub.mux.Unlock()
+
+	for address := range addresses {
+		if !transaction.Involves(address) {
+			continue
+		}
+
+		watched := address
+		hub.publish(EVENT_ADDRESS, struct {
+			Address     string             `json:"address"`
+			Status      string             `json:"status"`
+			Height      *int               `json:"height"`
+			Id          string             `json:"id"`
+			Transaction *block.Transaction `json:"transaction"`
+		}{
+			Address:     watched,
+			Status:      status,
+			Height:      height,
+			Id:          fmt.Sprintf("%x", transaction.Hash()),
+			Transaction: transaction,
+		}, func(subscriber *subscriber) bool {
+			return subscriber.addresses[watched]
+		})
+	}
+}
+
+// watches tells whether the Transaction involves an address of the
+// subscriber, a subscriber without addresses watches every Transaction
+func (subscriber *subscriber) watches(transaction *block.Transaction) bool {
+	if len(subscriber.addresses) == 0 {
+		return true
+	}
+	for address := range subscriber.addresses {
+		if transaction.Involves(address) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func isEventType(eventType string) bool {
+	for _, known := range eventTypes {
+		if eventType == known {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Events streams the events of Blockchain as Server-Sent Events.
+// types and address take comma-separated lists to filter them
+func (server *Server) Events(writer http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet:
+		flusher, ok := writer.(http.Flusher)
+		if !ok {
+			writeErrorMessage(writer, block.ERROR_INTERNAL, "streaming is not supported")
+			return
+		}
+
+		// The hub only listens once the Blockchain exists
+		server.GetBlockchain()
+
+		values := req.URL.Query()
+		subscriber, err := server.events.subscribe(splitList(values.Get("types")), splitList(values.Get("address")))
+		if err != nil {
+			writeError(writer, block.ERROR_INVALID_REQUEST, err)
+			return
+		}
+		defer server.events.unsubscribe(subscriber)
+
+		writer.Header().Set("Content-Type", "text/event-stream")
+		writer.Header().Set("Cache-Control", "no-cache")
+		writer.Header().Set("Connection", "keep-alive")
+		writer.WriteHeader(http.StatusOK)
+		flusher.Flush()
+
+		keepAlive := time.NewTicker(time.Second * EVENT_KEEP_ALIVE_SEC)
+		defer keepAlive.Stop()
+
+		for {
+			select {
+			case event, ok := <-subscriber.events:
+				if !ok {
+					// Dropped for falling behind, the client reconnects
+					return
+				}
+				fmt.Fprintf(writer, "id: %d\nevent: %s\ndata: %s\n\n", event.id, event.eventType, event.data)
+			case <-keepAlive.C:
+				fmt.Fprint(writer, ": keep-alive\n\n")
+			case <-req.Context().Done():
+				return
+			}
+			flusher.Flush()
+		}
+
+	default:
+		writeMethodNotAllowed(writer)
+	}
+}
@@ -0,0 +1,282 @@
+package main
+
+import (
+	"bufio"
+	"crypto-blockchain/block"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// queued returns the types of the events waiting for the subscriber
+func queued(subscriber *subscriber) []string {
+	types := make([]string, 0)
+	for {
+		select {
+		case event, ok := <-subscriber.events:
+			if !ok {
+				return types
+			}
+			types = append(types, event.eventType)
+		default:
+			return types
+		}
+	}
+}
+
+func TestEventFilters(t *testing.T) {
+	cases := []struct {
+		name      string
+		types     []string
+		addresses []string
+		// publish runs on a hub listening to a fresh regtest chain
+		publish func(t *testing.T, hub *EventHub, blockchain *block.Blockchain)
+		want    []string
+	}{
+		{
+			name: "everything",
+			publish: func(t *testing.T, hub *EventHub, blockchain *block.Blockchain) {
+				hub.publishTransaction(block.NewTransaction("alice", "bob", 1))
+			},
+			want: []string{EVENT_TRANSACTION},
+		},
+		{
+			name:  "other types only",
+			types: []string{EVENT_BLOCK},
+			publish: func(t *testing.T, hub *EventHub, blockchain *block.Blockchain) {
+				hub.publishTransaction(block.NewTransaction("alice", "bob", 1))
+			},
+			want: []string{},
+		},
+		{
+			name:      "transaction of a watched sender",
+			types:     []string{EVENT_TRANSACTION},
+			addresses: []string{"alice"},
+			publish: func(t *testing.T, hub *EventHub, blockchain *block.Blockchain) {
+				hub.publishTransaction(block.NewTransaction("alice", "bob", 1))
+			},
+			want: []string{EVENT_TRANSACTION},
+		},
+		{
+			name:      "transaction of other addresses",
+			types:     []string{EVENT_TRANSACTION},
+			addresses: []string{"carol"},
+			publish: func(t *testing.T, hub *EventHub, blockchain *block.Blockchain) {
+				hub.publishTransaction(block.NewTransaction("alice", "bob", 1))
+			},
+			want: []string{},
+		},
+		{
+			name:      "pending payment to a watched address",
+			addresses: []string{"bob"},
+			publish: func(t *testing.T, hub *EventHub, blockchain *block.Blockchain) {
+				hub.publishTransaction(block.NewTransaction("alice", "bob", 1))
+			},
+			want: []string{EVENT_TRANSACTION, EVENT_ADDRESS},
+		},
+		{
+			name:      "block paying a watched address",
+			types:     []string{EVENT_ADDRESS},
+			addresses: []string{"bob"},
+			publish: func(t *testing.T, hub *EventHub, blockchain *block.Blockchain) {
+				if _, err := blockchain.Generate(1, "bob"); err != nil {
+					t.Fatal(err)
+				}
+			},
+			want: []string{EVENT_ADDRESS},
+		},
+		{
+			name:      "block paying another address",
+			types:     []string{EVENT_BLOCK, EVENT_ADDRESS},
+			addresses: []string{"bob"},
+			publish: func(t *testing.T, hub *EventHub, blockchain *block.Blockchain) {
+				if _, err := blockchain.Generate(1, "carol"); err != nil {
+					t.Fatal(err)
+				}
+			},
+			want: []string{EVENT_BLOCK},
+		},
+	}
+
+	for _, test := range cases {
+		t.Run(test.name, func(t *testing.T) {
+			blockchain := newRegtestChain()
+			hub := NewEventHub()
+			hub.Listen(blockchain)
+			subscriber, err := hub.subscribe(test.types, test.addresses)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			test.publish(t, hub, blockchain)
+			if got := queued(subscriber); fmt.Sprint(got) != fmt.Sprint(test.want) {
+				t.Errorf("received %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestEventSubscribe(t *testing.T) {
+	cases := []struct {
+		name      string
+		types     []string
+		addresses []string
+		code      block.ErrorCode
+	}{
+		{"no filters", nil, nil, ""},
+		{"known types", []string{EVENT_BLOCK, EVENT_REORG}, nil, ""},
+		{"unknown type", []string{"mempool"}, nil, block.ERROR_INVALID_REQUEST},
+		{"address events without addresses", []string{EVENT_ADDRESS}, nil, block.ERROR_INVALID_REQUEST},
+		{"address events", []string{EVENT_ADDRESS}, []string{"alice"}, ""},
+	}
+
+	for _, test := range cases {
+		t.Run(test.name, func(t *testing.T) {
+			hub := NewEventHub()
+			_, err := hub.subscribe(test.types, test.addresses)
+			code := block.ErrorCode("")
+			if err != nil {
+				code = block.ErrorCodeOf(err)
+			}
+			if code != test.code {
+				t.Errorf("subscribed with %v, want %q", err, test.code)
+			}
+		})
+	}
+}
+
+func TestEventReorg(t *testing.T) {
+	blockchain := newRegtestChain()
+	hub := NewEventHub()
+	hub.Listen(blockchain)
+	subscriber, err := hub.subscribe([]string{EVENT_REORG}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A longer chain mined elsewhere from the same genesis takes over
+	if _, err := blockchain.Generate(1, "alice"); err != nil {
+		t.Fatal(err)
+	}
+	fork, err := newRegtestChain().Generate(2, "bob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, forked := range fork {
+		if err := blockchain.AddBlock(forked, ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var event *event
+	select {
+	case event = <-subscriber.events:
+	default:
+		t.Fatal("no reorg event was published")
+	}
+	var reorg struct {
+		Depth     int      `json:"depth"`
+		NewTip    string   `json:"newTip"`
+		Connected []string `json:"connected"`
+	}
+	if err := json.Unmarshal(event.data, &reorg); err != nil {
+		t.Fatal(err)
+	}
+	newTip := fmt.Sprintf("%x", fork[1].Hash())
+	if event.eventType != EVENT_REORG || reorg.Depth != 1 || reorg.NewTip != newTip || len(reorg.Connected) != 2 {
+		t.Errorf("published %s of depth %d to %s connecting %d blocks, want a reorg of depth 1 to %s connecting 2",
+			event.eventType, reorg.Depth, reorg.NewTip, len(reorg.Connected), newTip)
+	}
+}
+
+func TestEventSlowSubscriberDropped(t *testing.T) {
+	hub := NewEventHub()
+	slow, err := hub.subscribe(nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fast, err := hub.subscribe(nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Only the fast subscriber reads, the slow one overflows its buffer
+	for i := 0; i <= EVENT_BUFFER_SIZE; i++ {
+		hub.publishTransaction(block.NewTransaction("alice", fmt.Sprintf("bob %d", i), 1))
+		<-fast.events
+	}
+
+	received := 0
+	for range slow.events {
+		received++
+	}
+	if received != EVENT_BUFFER_SIZE {
+		t.Errorf("the slow subscriber received %d events before it was dropped, want %d", received, EVENT_BUFFER_SIZE)
+	}
+
+	hub.mux.Lock()
+	defer hub.mux.Unlock()
+	if hub.subscribers[slow] || !hub.subscribers[fast] {
+		t.Errorf("subscribed slow %t and fast %t, want only the fast one", hub.subscribers[slow], hub.subscribers[fast])
+	}
+}
+
+func TestEventsStream(t *testing.T) {
+	server := newRPCServer(t)
+	httpServer := httptest.NewServer(http.HandlerFunc(server.Events))
+	defer httpServer.Close()
+
+	cases := []struct {
+		name   string
+		query  string
+		status int
+	}{
+		{"unknown type", "?types=mempool", http.StatusBadRequest},
+		{"blocks", "?types=block", http.StatusOK},
+	}
+
+	for _, test := range cases {
+		t.Run(test.name, func(t *testing.T) {
+			response, err := http.Get(httpServer.URL + test.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer response.Body.Close()
+			if response.StatusCode != test.status {
+				t.Fatalf("answered %d, want %d", response.StatusCode, test.status)
+			}
+			if test.status != http.StatusOK {
+				return
+			}
+
+			// Blocks mined before the stream reaches the hub are not sent
+			for deadline := time.Now().Add(5 * time.Second); server.events.idle(); time.Sleep(time.Millisecond) {
+				if time.Now().After(deadline) {
+					t.Fatal("the stream never subscribed")
+				}
+			}
+			mined, err := server.GetBlockchain().Generate(1, "alice")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			reader := bufio.NewReader(response.Body)
+			lines := make([]string, 0, 3)
+			for len(lines) < 3 {
+				line, err := reader.ReadString('\n')
+				if err != nil {
+					t.Fatal(err)
+				}
+				lines = append(lines, strings.TrimSuffix(line, "\n"))
+			}
+			hash := fmt.Sprintf(`"hash":"%x"`, mined[0].Hash())
+			if lines[0] != "id: 1" || lines[1] != "event: block" || !strings.Contains(lines[2], hash) {
+				t.Errorf("streamed %q, want block %x", lines, mined[0].Hash())
+			}
+		})
+	}
+}
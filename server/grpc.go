@@ -0,0 +1,369 @@
+package main
+
+import (
+	"context"
+	"crypto-blockchain/block"
+	"crypto-blockchain/nodepb"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// nodeService serves the Blockchain of the Server through the
+// Node service of proto/node.proto
+type nodeService struct {
+	nodepb.UnimplementedNodeServer
+	server *Server
+}
+
+const GRPC_ERROR_DOMAIN = "crypto-blockchain"
+
+var grpcCodes = map[block.ErrorCode]codes.Code{
+	block.ERROR_INVALID_REQUEST:     codes.InvalidArgument,
+	block.ERROR_MALFORMED_KEY:       codes.InvalidArgument,
+	block.ERROR_INVALID_SIGNATURE:   codes.InvalidArgument,
+	block.ERROR_INSUFFICIENT_FUNDS:  codes.FailedPrecondition,
+	block.ERROR_INSUFFICIENT_FEE:    codes.FailedPrecondition,
+	block.ERROR_INVALID_TRANSACTION: codes.InvalidArgument,
+	block.ERROR_WRONG_CHAIN:         codes.InvalidArgument,
+	block.ERROR_ALREADY_KNOWN:       codes.AlreadyExists,
+	block.ERROR_DOUBLE_SPEND:        codes.AlreadyExists,
+	block.ERROR_TOO_MANY_PENDING:    codes.ResourceExhausted,
+	block.ERROR_MEMPOOL_FULL:        codes.ResourceExhausted,
+	block.ERROR_INVALID_BLOCK:       codes.InvalidArgument,
+	block.ERROR_NOT_FOUND:           codes.NotFound,
+	block.ERROR_GATEWAY:             codes.Unavailable,
+	block.ERROR_INTERNAL:            codes.Internal,
+}
+
+// SetGRPCPort makes Run serve the Node service on the port as well
+func (server *Server) SetGRPCPort(port uint16) {
+	server.grpcPort = port
+}
+
+// NewGRPCServer generates and returns new grpc.Server serving the Node service
+func (server *Server) NewGRPCServer() *grpc.Server {
+	grpcServer := grpc.NewServer()
+	nodepb.RegisterNodeServer(grpcServer, &nodeService{server: server})
+
+	return grpcServer
+}
+
+// serveGRPC serves the Node service next to the HTTP routes
+func (server *Server) serveGRPC() {
+	listener, err := net.Listen("tcp", "0.0.0.0:"+strconv.Itoa(int(server.grpcPort)))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	log.Printf("Serving gRPC on %s", listener.Addr())
+	log.Fatal(server.NewGRPCServer().Serve(listener))
+}
+
+func (service *nodeService) GetChainInfo(ctx context.Context, req *nodepb.GetChainInfoRequest) (*nodepb.ChainInfo, error) {
+	blockchain := service.server.GetBlockchain()
+	head, height := blockchain.Head()
+	_, pending := blockchain.QueryTransactionPool(&block.MempoolQuery{SortBy: block.MEMPOOL_SORT_TIME, Limit: 1})
+
+	return &nodepb.ChainInfo{
+		ChainId:     blockchain.ChainId(),
+		GenesisHash: fmt.Sprintf("%x", blockchain.GenesisHash()),
+		Height:      int32(height),
+		BestHash:    fmt.Sprintf("%x", head.Hash()),
+		Ledger:      string(blockchain.LedgerMode()),
+		Consensus:   string(service.server.config.Engine.Type()),
+		Pending:     int32(pending),
+	}, nil
+}
+
+func (service *nodeService) GetBlock(ctx context.Context, req *nodepb.GetBlockRequest) (*nodepb.BlockInfo, error) {
+	blockchain := service.server.GetBlockchain()
+
+	var found *block.Block
+	var height int
+	switch selector := req.Block.(type) {
+	case *nodepb.GetBlockRequest_Height:
+		height = int(selector.Height)
+		var ok bool
+		if found, ok = blockchain.BlockByHeight(height); !ok {
+			return nil, grpcError(block.Errorf(block.ERROR_NOT_FOUND, "no block at height %d", height))
+		}
+	case *nodepb.GetBlockRequest_Hash:
+		hash, err := hex.DecodeString(selector.Hash)
+		if err != nil || len(hash) != 32 {
+			return nil, grpcError(block.NewError(block.ERROR_INVALID_REQUEST, "invalid block hash"))
+		}
+		var ok bool
+		if found, height, ok = blockchain.GetBlock(*(*[32]byte)(hash)); !ok {
+			return nil, grpcError(block.Errorf(block.ERROR_NOT_FOUND, "block %s is unknown", selector.Hash))
+		}
+	default:
+		return nil, grpcError(block.NewError(block.ERROR_INVALID_REQUEST, "height or hash is required"))
+	}
+
+	pbBlock := &nodepb.Block{}
+	if err := toMessage(found, pbBlock); err != nil {
+		return nil, grpcError(err)
+	}
+
+	return &nodepb.BlockInfo{
+		Hash:   fmt.Sprintf("%x", found.Hash()),
+		Height: int32(height),
+		Block:  pbBlock,
+	}, nil
+}
+
+func (service *nodeService) GetTransaction(ctx context.Context, req *nodepb.GetTransactionRequest) (*nodepb.TransactionInfo, error) {
+	id, err := hex.DecodeString(req.Id)
+	if err != nil || len(id) != 32 {
+		return nil, grpcError(block.Errorf(block.ERROR_INVALID_REQUEST, "invalid transaction ID %q", req.Id))
+	}
+
+	blockchain := service.server.GetBlockchain()
+	transaction, height, ok := blockchain.FindTransaction(*(*[32]byte)(id))
+	if !ok {
+		return nil, grpcError(block.Errorf(block.ERROR_NOT_FOUND, "transaction %s is unknown", req.Id))
+	}
+
+	pbTransaction := &nodepb.Transaction{}
+	if err := toMessage(transaction, pbTransaction); err != nil {
+		return nil, grpcError(err)
+	}
+
+	// Pending transactions have no block and no confirmations yet
+	confirmations := 0
+	if height >= 0 {
+		_, head := blockchain.Head()
+		confirmations = head - height + 1
+	}
+
+	return &nodepb.TransactionInfo{
+		Id:            req.Id,
+		Transaction:   pbTransaction,
+		Pending:       height < 0,
+		Height:        int32(height),
+		Confirmations: int32(confirmations),
+	}, nil
+}
+
+func (service *nodeService) GetBalance(ctx context.Context, req *nodepb.GetBalanceRequest) (*nodepb.Balance, error) {
+	if req.Address == "" {
+		return nil, grpcError(block.NewError(block.ERROR_INVALID_REQUEST, "address is required"))
+	}
+
+	amount, available := service.server.GetBlockchain().Balance(req.Address)
+	return &nodepb.Balance{
+		Address:   req.Address,
+		Amount:    amount,
+		Available: available,
+	}, nil
+}
+
+func (service *nodeService) ListPendingTransactions(ctx context.Context, req *nodepb.ListPendingTransactionsRequest) (*nodepb.ListPendingTransactionsResponse, error) {
+	if req.Offset < 0 || req.Limit < 0 || req.Limit > MAX_PAGE_LIMIT {
+		return nil, grpcError(block.Errorf(block.ERROR_INVALID_REQUEST, "offset must not be negative, limit between 0 and %d", MAX_PAGE_LIMIT))
+	}
+
+	transactions, total := service.server.GetBlockchain().QueryTransactionPool(&block.MempoolQuery{
+		Sender:    req.Sender,
+		Recipient: req.Recipient,
+		SortBy:    block.MEMPOOL_SORT_TIME,
+		Offset:    int(req.Offset),
+		Limit:     int(req.Limit),
+	})
+
+	response := &nodepb.ListPendingTransactionsResponse{Total: int32(total)}
+	for _, transaction := range transactions {
+		pbTransaction := &nodepb.Transaction{}
+		if err := toMessage(transaction, pbTransaction); err != nil {
+			return nil, grpcError(err)
+		}
+		response.Transactions = append(response.Transactions, pbTransaction)
+	}
+
+	return response, nil
+}
+
+func (service *nodeService) SubmitTransaction(ctx context.Context, req *nodepb.TransactionRequest) (*nodepb.SubmitTransactionResponse, error) {
+	transactionRequest := transactionRequestFromProto(req)
+	if !transactionRequest.Validate() {
+		return nil, grpcError(block.NewError(block.ERROR_INVALID_REQUEST, "transaction request is missing required fields"))
+	}
+
+	transaction, err := transactionRequest.Transaction()
+	if err != nil {
+		return nil, grpcError(block.WrapError(block.ERROR_INVALID_REQUEST, err))
+	}
+	if err := service.server.GetBlockchain().SubmitTransaction(transaction); err != nil {
+		return nil, grpcError(err)
+	}
+
+	return &nodepb.SubmitTransactionResponse{Id: fmt.Sprintf("%x", transaction.Hash())}, nil
+}
+
+func (service *nodeService) SubscribeBlocks(req *nodepb.SubscribeBlocksRequest, stream nodepb.Node_SubscribeBlocksServer) error {
+	return service.stream(stream.Context(), []string{EVENT_BLOCK}, nil, func(data []byte) error {
+		blockInfo := &nodepb.BlockInfo{}
+		if err := unmarshalMessage(data, blockInfo); err != nil {
+			return err
+		}
+		return stream.Send(blockInfo)
+	})
+}
+
+func (service *nodeService) SubscribeTransactions(req *nodepb.SubscribeTransactionsRequest, stream nodepb.Node_SubscribeTransactionsServer) error {
+	return service.stream(stream.Context(), []string{EVENT_TRANSACTION}, req.Addresses, func(data []byte) error {
+		transactionInfo := &nodepb.TransactionInfo{}
+		if err := unmarshalMessage(data, transactionInfo); err != nil {
+			return err
+		}
+		transactionInfo.Pending = true
+		transactionInfo.Height = -1
+		return stream.Send(transactionInfo)
+	})
+}
+
+// stream subscribes to the events of the EventHub and sends each of them
+// until the client goes away. A client falling behind is cut off, like
+// subscribers of /events
+func (service *nodeService) stream(ctx context.Context, types []string, addresses []string, send func(data []byte) error) error {
+	// The hub only listens once the Blockchain exists
+	service.server.GetBlockchain()
+
+	subscriber, err := service.server.events.subscribe(types, addresses)
+	if err != nil {
+		return grpcError(err)
+	}
+	defer service.server.events.unsubscribe(subscriber)
+
+	for {
+		select {
+		case event, ok := <-subscriber.events:
+			if !ok {
+				return status.Error(codes.ResourceExhausted, "subscriber fell behind the events")
+			}
+			if err := send(event.data); err != nil {
+				return err
+			}
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// transactionRequestFromProto converts the request into the
+// TransactionRequest POST /transactions takes, leaving empty fields nil
+func transactionRequestFromProto(req *nodepb.TransactionRequest) *block.TransactionRequest {
+	transactionRequest := &block.TransactionRequest{
+		SenderAddress:    stringOrNil(req.SenderAddress),
+		RecipientAddress: stringOrNil(req.RecipientAddress),
+		SenderPublicKey:  stringOrNil(req.SenderPublicKey),
+		Signature:        stringOrNil(req.Signature),
+		KeyType:          stringOrNil(req.KeyType),
+		Replaces:         stringOrNil(req.Replaces),
+		ChainId:          stringOrNil(req.ChainId),
+	}
+	if req.RecipientAddress != "" {
+		value := req.Value
+		transactionRequest.Value = &value
+	}
+	if req.Fee != 0 {
+		fee := req.Fee
+		transactionRequest.Fee = &fee
+	}
+	if req.LockHeight != 0 {
+		lockHeight := int(req.LockHeight)
+		transactionRequest.LockHeight = &lockHeight
+	}
+	if req.LockTime != 0 {
+		lockTime := req.LockTime
+		transactionRequest.LockTime = &lockTime
+	}
+
+	if req.Multisig != nil {
+		threshold := int(req.Multisig.Threshold)
+		transactionRequest.Multisig = &block.MultisigRequest{Threshold: &threshold}
+		for _, signer := range req.Multisig.Signers {
+			transactionRequest.Multisig.Signers = append(transactionRequest.Multisig.Signers, &block.MultisigSignerRequest{
+				KeyType:   stringOrNil(signer.KeyType),
+				PublicKey: stringOrNil(signer.PublicKey),
+				Signature: stringOrNil(signer.Signature),
+			})
+		}
+	}
+	for _, input := range req.Inputs {
+		index := int(input.Index)
+		transactionRequest.Inputs = append(transactionRequest.Inputs, &block.TxInputRequest{
+			TransactionId: stringOrNil(input.TransactionId),
+			Index:         &index,
+			UnlockScript:  stringOrNil(input.UnlockScript),
+		})
+	}
+	for _, output := range req.Outputs {
+		value := output.Value
+		transactionRequest.Outputs = append(transactionRequest.Outputs, &block.TxOutputRequest{
+			Address: stringOrNil(output.Address),
+			Value:   &value,
+			Script:  stringOrNil(output.Script),
+		})
+	}
+
+	return transactionRequest
+}
+
+func stringOrNil(str string) *string {
+	if str == "" {
+		return nil
+	}
+
+	return &str
+}
+
+// toMessage fills the message from the JSON encoding of the value,
+// which uses the same field names as the messages
+func toMessage(value interface{}, message proto.Message) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return block.WrapError(block.ERROR_INTERNAL, err)
+	}
+
+	return unmarshalMessage(data, message)
+}
+
+// unmarshalMessage fills the message from JSON, such as the data of an event
+func unmarshalMessage(data []byte, message proto.Message) error {
+	options := protojson.UnmarshalOptions{DiscardUnknown: true}
+	if err := options.Unmarshal(data, message); err != nil {
+		return block.WrapError(block.ERROR_INTERNAL, err)
+	}
+
+	return nil
+}
+
+// grpcError turns an error of the block package into a status with
+// the matching code, keeping its ErrorCode as the reason of an ErrorInfo
+func grpcError(err error) error {
+	code := block.ErrorCodeOf(err)
+	grpcCode, ok := grpcCodes[code]
+	if !ok {
+		grpcCode = codes.FailedPrecondition
+	}
+
+	coded := status.New(grpcCode, err.Error())
+	detailed, detailErr := coded.WithDetails(&errdetails.ErrorInfo{Reason: string(code), Domain: GRPC_ERROR_DOMAIN})
+	if detailErr != nil {
+		return coded.Err()
+	}
+
+	return detailed.Err()
+}
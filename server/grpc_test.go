@@ -0,0 +1,204 @@
+package main
+
+import (
+	"context"
+	"crypto-blockchain/block"
+	"crypto-blockchain/nodepb"
+	"crypto-blockchain/wallet"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+const BUFCONN_SIZE = 1024 * 1024
+
+// newTestNode serves the Node service of a fresh regtest Server over an
+// in-memory connection. Blocks need no proof of work and coinbases can
+// be spent right away
+func newTestNode(t *testing.T) (*Server, nodepb.NodeClient) {
+	delete(cache, "blockchain")
+
+	config := block.DefaultChainConfig()
+	config.Engine = block.NewProofOfWorkEngine(0)
+	config.CoinbaseMaturity = 0
+	config.Clock = block.NewMockClock(time.Now().UnixNano())
+	server := NewServer(5000, config, wallet.NewWallet())
+
+	listener := bufconn.Listen(BUFCONN_SIZE)
+	grpcServer := server.NewGRPCServer()
+	go grpcServer.Serve(listener)
+
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, address string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		conn.Close()
+		grpcServer.Stop()
+		delete(cache, "blockchain")
+	})
+
+	return server, nodepb.NewNodeClient(conn)
+}
+
+// signedRequest returns the TransactionRequest of the value sent
+// from the Wallet to the recipient on the chain
+func signedRequest(t *testing.T, sender *wallet.Wallet, recipient string, value float32, chainId string) *nodepb.TransactionRequest {
+	transaction := wallet.NewTransaction(sender.Signer(), sender.Address(), recipient, value)
+	transaction.SetChainId(chainId)
+	signature, err := transaction.GenerateSignature()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &nodepb.TransactionRequest{
+		SenderAddress:    sender.Address(),
+		RecipientAddress: recipient,
+		SenderPublicKey:  sender.PublicKeyStr(),
+		Value:            value,
+		Signature:        hex.EncodeToString(signature),
+		KeyType:          string(sender.KeyType()),
+		ChainId:          chainId,
+	}
+}
+
+func TestGRPCGetChainInfo(t *testing.T) {
+	server, client := newTestNode(t)
+	blockchain := server.GetBlockchain()
+
+	info, err := client.GetChainInfo(context.Background(), &nodepb.GetChainInfoRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	genesisHash := fmt.Sprintf("%x", blockchain.GenesisHash())
+	if info.ChainId != blockchain.ChainId() || info.GenesisHash != genesisHash {
+		t.Errorf("chain %s with genesis %s, want %s with %s", info.ChainId, info.GenesisHash, blockchain.ChainId(), genesisHash)
+	}
+	if info.Height != 0 || info.BestHash != genesisHash || info.Pending != 0 {
+		t.Errorf("height %d, best %s and %d pending, want the genesis block alone", info.Height, info.BestHash, info.Pending)
+	}
+	if info.Ledger != string(block.LEDGER_MODE_ACCOUNT) {
+		t.Errorf("ledger %s, want %s", info.Ledger, block.LEDGER_MODE_ACCOUNT)
+	}
+}
+
+func TestGRPCSubmitTransaction(t *testing.T) {
+	server, client := newTestNode(t)
+	blockchain := server.GetBlockchain()
+
+	sender := wallet.NewWallet()
+	recipient := wallet.NewWallet().Address()
+	if _, err := blockchain.Generate(1, sender.Address()); err != nil {
+		t.Fatal(err)
+	}
+	balance, _ := blockchain.Balance(sender.Address())
+
+	cases := []struct {
+		name    string
+		request *nodepb.TransactionRequest
+		code    codes.Code
+		reason  block.ErrorCode
+	}{
+		{
+			name:    "funded",
+			request: signedRequest(t, sender, recipient, balance/2, blockchain.ChainId()),
+			code:    codes.OK,
+		},
+		{
+			name:    "more than the balance",
+			request: signedRequest(t, sender, recipient, balance*2, blockchain.ChainId()),
+			code:    codes.FailedPrecondition,
+			reason:  block.ERROR_INSUFFICIENT_FUNDS,
+		},
+		{
+			name:    "other chain",
+			request: signedRequest(t, sender, recipient, balance/4, "otherchain"),
+			code:    codes.InvalidArgument,
+			reason:  block.ERROR_WRONG_CHAIN,
+		},
+	}
+
+	for _, test := range cases {
+		t.Run(test.name, func(t *testing.T) {
+			submitted, err := client.SubmitTransaction(context.Background(), test.request)
+			if test.code == codes.OK {
+				if err != nil {
+					t.Fatal(err)
+				}
+				pending, err := client.GetTransaction(context.Background(), &nodepb.GetTransactionRequest{Id: submitted.Id})
+				if err != nil || !pending.Pending {
+					t.Errorf("transaction %s is not pending: %v", submitted.Id, err)
+				}
+				return
+			}
+
+			failure, ok := status.FromError(err)
+			if !ok || failure.Code() != test.code {
+				t.Fatalf("failed with %v, want code %s", err, test.code)
+			}
+			for _, detail := range failure.Details() {
+				if info, ok := detail.(*errdetails.ErrorInfo); ok {
+					if info.Reason != string(test.reason) || info.Domain != GRPC_ERROR_DOMAIN {
+						t.Errorf("reason %s of %s, want %s of %s", info.Reason, info.Domain, test.reason, GRPC_ERROR_DOMAIN)
+					}
+					return
+				}
+			}
+			t.Errorf("%v carries no ErrorInfo", err)
+		})
+	}
+}
+
+func TestGRPCSubscribeBlocks(t *testing.T) {
+	server, client := newTestNode(t)
+	blockchain := server.GetBlockchain()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	stream, err := client.SubscribeBlocks(ctx, &nodepb.SubscribeBlocksRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Blocks mined before the subscription reaches the hub are not sent
+	for subscribed := false; !subscribed; time.Sleep(10 * time.Millisecond) {
+		server.events.mux.Lock()
+		subscribed = len(server.events.subscribers) > 0
+		server.events.mux.Unlock()
+		if ctx.Err() != nil {
+			t.Fatal("the stream never subscribed")
+		}
+	}
+
+	mined, err := blockchain.Generate(1, wallet.NewWallet().Address())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	blockInfo, err := stream.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hash := fmt.Sprintf("%x", mined[0].Hash()); blockInfo.Hash != hash || blockInfo.Height != 1 {
+		t.Errorf("received block %s at %d, want %s at 1", blockInfo.Hash, blockInfo.Height, hash)
+	}
+	if len(blockInfo.Block.GetTransactions()) != 1 {
+		t.Errorf("received %d transactions, want the coinbase", len(blockInfo.Block.GetTransactions()))
+	}
+}
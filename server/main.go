@@ -1,8 +1,13 @@
 package main
 
 import (
+	"crypto-blockchain/block"
+	"crypto-blockchain/utils"
+	"crypto-blockchain/wallet"
 	"flag"
 	"log"
+	"strings"
+	"time"
 )
 
 func init() {
@@ -11,8 +16,122 @@ func init() {
 
 func main() {
 	port := flag.Uint("port", 5655, "TCP Port Number For Blockchain Server")
+	genesisPath := flag.String("genesis", "", "Genesis File Of The Network, Replaces The Network Flags Below")
+	chainId := flag.String("chain-id", "", "ID Of The Network, Defaults To devnet Or To regtest With -regtest")
+	regtest := flag.Bool("regtest", false, "Regtest Mode: Regtest Addresses, No Mining Difficulty, A Mock Clock And /regtest Endpoints")
+	ledger := flag.String("ledger", string(block.LEDGER_MODE_ACCOUNT), "Ledger Mode: account or utxo")
+	reward := flag.Float64("reward", block.MINING_REWARD, "Initial Block Subsidy")
+	halvingInterval := flag.Int("halving-interval", block.HALVING_INTERVAL, "Blocks Between Subsidy Halvings, 0 To Never Halve")
+	maxSupply := flag.Float64("max-supply", block.MAX_SUPPLY, "Max Coins Ever Issued, 0 For No Limit")
+	consensus := flag.String("consensus", string(block.CONSENSUS_POW), "Consensus Engine: pow, pos or poa")
+	authorities := flag.String("authorities", "", "Comma-Separated [keyType:]publicKey List Of PoA Authorities, Defaults To The Miner")
+	finalityInterval := flag.Int("finality-interval", 0, "Blocks Between Finality Checkpoints, 0 To Disable Finality")
+	finalityValidators := flag.String("finality-validators", "", "Comma-Separated [keyType:]publicKey List Of Finality Validators, Defaults To The Authorities")
+	maturity := flag.Int("coinbase-maturity", block.COINBASE_MATURITY, "Blocks Before Coinbase Outputs Can Be Spent")
+	minerKey := flag.String("miner-key", "", "Hex Private Key Of The Miner, Random If Empty")
+	minerKeyType := flag.String("miner-key-type", string(utils.DEFAULT_KEY_TYPE), "Miner Key Type: p256, secp256k1 or ed25519")
+	grpcPort := flag.Uint("grpc-port", 0, "TCP Port Number For The gRPC API, 0 To Disable It")
+	peers := flag.String("peers", "", "Comma-Separated host:port List Of Peers Missing Blocks Are Fetched From")
+	webhooksPath := flag.String("webhooks", "webhooks.json", "File Keeping The Registered Webhooks")
 	flag.Parse()
 
-	app := NewServer(uint16(*port))
+	// Addresses are derived with the regtest version bytes from here on
+	if *regtest {
+		utils.UseNetwork(utils.REGTEST_NETWORK)
+	}
+	if *chainId == "" {
+		*chainId = block.DEFAULT_CHAIN_ID
+		if *regtest {
+			*chainId = block.REGTEST_CHAIN_ID
+		}
+	}
+
+	var genesis *block.Genesis
+	var err error
+	if *genesisPath != "" {
+		genesis, err = block.LoadGenesis(*genesisPath)
+	} else {
+		reward32, maxSupply32 := float32(*reward), float32(*maxSupply)
+		genesisRequest := &block.GenesisRequest{
+			ChainId: chainId,
+			Ledger:  ledger,
+			Consensus: &block.GenesisConsensusRequest{
+				Type:               consensus,
+				Authorities:        splitList(*authorities),
+				FinalityInterval:   finalityInterval,
+				FinalityValidators: splitList(*finalityValidators),
+			},
+			Emission: &block.GenesisEmissionRequest{
+				Reward:          &reward32,
+				HalvingInterval: halvingInterval,
+				MaxSupply:       &maxSupply32,
+			},
+			CoinbaseMaturity: maturity,
+		}
+		if *regtest {
+			difficulty := 0
+			genesisRequest.Difficulty = &difficulty
+		}
+		genesis, err = genesisRequest.Genesis()
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	minersWallet, err := minersWalletFromFlags(*minerKeyType, *minerKey)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Engines signing blocks seal them with the miner's key
+	config, err := genesis.ChainConfig(minersWallet.Signer())
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *regtest {
+		config.Clock = block.NewMockClock(time.Now().UnixNano())
+	}
+	log.Printf("chain_id %s", genesis.ChainId())
+
+	webhooks, err := LoadWebhookRegistry(*webhooksPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	app := NewServer(uint16(*port), config, minersWallet)
+	app.SetPeers(splitList(*peers))
+	app.SetWebhooks(webhooks)
+	app.SetGRPCPort(uint16(*grpcPort))
 	app.Run()
 }
+
+// minersWalletFromFlags restores the miner's wallet from its private key,
+// so the node can seal blocks as a known authority, or creates a new one
+func minersWalletFromFlags(keyTypeStr string, privateKey string) (*wallet.Wallet, error) {
+	keyType, err := utils.ParseKeyType(keyTypeStr)
+	if err != nil {
+		return nil, err
+	}
+	if privateKey == "" {
+		return wallet.NewWalletWithKeyType(keyType)
+	}
+
+	signer, err := utils.SignerFromString(keyType, privateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return wallet.NewWalletFromSigner(signer), nil
+}
+
+// splitList splits a comma-separated flag, skipping empty entries
+func splitList(str string) []string {
+	entries := make([]string, 0)
+	for _, entry := range strings.Split(str, ",") {
+		if entry = strings.TrimSpace(entry); entry != "" {
+			entries = append(entries, entry)
+		}
+	}
+
+	return entries
+}
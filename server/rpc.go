@@ -0,0 +1,387 @@
+package main
+
+import (
+	"bytes"
+	"crypto-blockchain/block"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// rpcRequest is a JSON-RPC 2.0 call. A call without an ID is a
+// notification, which is executed but never answered
+type rpcRequest struct {
+	JsonRpc string          `json:"jsonrpc"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params"`
+	Id      json.RawMessage `json:"id"`
+}
+
+type rpcResponse struct {
+	JsonRpc string          `json:"jsonrpc"`
+	Result  interface{}     `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+	Id      json.RawMessage `json:"id"`
+}
+
+type rpcError struct {
+	Code    int         `json:"code"`
+	Message string      `json:"message"`
+	Data    interface{} `json:"data,omitempty"`
+}
+
+// rpcMethod takes its parameters by name, or by position
+// in the order of params
+type rpcMethod struct {
+	params []string
+	handle func(server *Server, params map[string]json.RawMessage) (interface{}, error)
+}
+
+const (
+	JSON_RPC_VERSION = "2.0"
+
+	RPC_PARSE_ERROR      = -32700
+	RPC_INVALID_REQUEST  = -32600
+	RPC_METHOD_NOT_FOUND = -32601
+	RPC_INVALID_PARAMS   = -32602
+	RPC_INTERNAL_ERROR   = -32603
+	RPC_SERVER_ERROR     = -32000
+
+	MAX_RPC_BATCH = 100
+)
+
+var rpcMethods = map[string]*rpcMethod{
+	"getBlockByHeight": {[]string{"height"}, rpcGetBlockByHeight},
+	"getTransaction":   {[]string{"id"}, rpcGetTransaction},
+	"sendTransaction":  {[]string{"transaction"}, rpcSendTransaction},
+	"getBalance":       {[]string{"address"}, rpcGetBalance},
+	"getMempool":       {[]string{"sender", "recipient", "offset", "limit"}, rpcGetMempool},
+	"getChainInfo":     {[]string{}, rpcGetChainInfo},
+}
+
+// RPC serves JSON-RPC 2.0 calls, one at a time or in batches
+func (server *Server) RPC(writer http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodPost:
+		body, err := io.ReadAll(req.Body)
+		if err != nil {
+			writeRPC(writer, newRPCErrorResponse(nil, RPC_PARSE_ERROR, err.Error()))
+			return
+		}
+
+		body = bytes.TrimSpace(body)
+		if len(body) == 0 || body[0] != '[' {
+			if response := server.callRPC(body); response != nil {
+				writeRPC(writer, response)
+			} else {
+				writer.WriteHeader(http.StatusNoContent)
+			}
+			return
+		}
+
+		var batch []json.RawMessage
+		if err := json.Unmarshal(body, &batch); err != nil {
+			writeRPC(writer, newRPCErrorResponse(nil, RPC_PARSE_ERROR, err.Error()))
+			return
+		}
+		if len(batch) == 0 || len(batch) > MAX_RPC_BATCH {
+			message := fmt.Sprintf("batch must hold between 1 and %d calls", MAX_RPC_BATCH)
+			writeRPC(writer, newRPCErrorResponse(nil, RPC_INVALID_REQUEST, message))
+			return
+		}
+
+		responses := make([]*rpcResponse, 0, len(batch))
+		for _, call := range batch {
+			if response := server.callRPC(call); response != nil {
+				responses = append(responses, response)
+			}
+		}
+
+		// A batch of notifications only is not answered
+		if len(responses) == 0 {
+			writer.WriteHeader(http.StatusNoContent)
+			return
+		}
+		writeRPC(writer, responses)
+
+	default:
+		writeMethodNotAllowed(writer)
+	}
+}
+
+// callRPC executes a single call and returns its response,
+// nil for notifications
+func (server *Server) callRPC(data []byte) *rpcResponse {
+	if !json.Valid(data) {
+		return newRPCErrorResponse(nil, RPC_PARSE_ERROR, "invalid JSON")
+	}
+
+	var request rpcRequest
+	if err := json.Unmarshal(data, &request); err != nil {
+		return newRPCErrorResponse(nil, RPC_INVALID_REQUEST, err.Error())
+	}
+	if request.JsonRpc != JSON_RPC_VERSION || request.Method == "" {
+		return newRPCErrorResponse(request.Id, RPC_INVALID_REQUEST, "not a JSON-RPC 2.0 request")
+	}
+
+	method, ok := rpcMethods[request.Method]
+	if !ok {
+		return rpcResult(request, nil, newRPCError(RPC_METHOD_NOT_FOUND, fmt.Sprintf("method %q not found", request.Method)))
+	}
+
+	params, err := method.namedParams(request.Params)
+	if err != nil {
+		return rpcResult(request, nil, newRPCError(RPC_INVALID_PARAMS, err.Error()))
+	}
+
+	result, err := method.handle(server, params)
+	if err != nil {
+		return rpcResult(request, nil, rpcErrorFrom(err))
+	}
+
+	return rpcResult(request, result, nil)
+}
+
+// namedParams maps positional parameters to the names of the method
+func (method *rpcMethod) namedParams(raw json.RawMessage) (map[string]json.RawMessage, error) {
+	params := make(map[string]json.RawMessage)
+	raw = bytes.TrimSpace(raw)
+	if len(raw) == 0 || bytes.Equal(raw, []byte("null")) {
+		return params, nil
+	}
+
+	if raw[0] == '[' {
+		var positional []json.RawMessage
+		if err := json.Unmarshal(raw, &positional); err != nil {
+			return nil, err
+		}
+		if len(positional) > len(method.params) {
+			return nil, fmt.Errorf("expected at most %d parameters", len(method.params))
+		}
+		for i, param := range positional {
+			params[method.params[i]] = param
+		}
+		return params, nil
+	}
+
+	if err := json.Unmarshal(raw, &params); err != nil {
+		return nil, err
+	}
+	return params, nil
+}
+
+// rpcParam decodes the parameter into value. Missing parameters
+// fail when required and leave value untouched otherwise
+func rpcParam(params map[string]json.RawMessage, name string, value interface{}, required bool) error {
+	raw, ok := params[name]
+	if !ok || bytes.Equal(raw, []byte("null")) {
+		if required {
+			return block.Errorf(block.ERROR_INVALID_REQUEST, "parameter %s is required", name)
+		}
+		return nil
+	}
+
+	if err := json.Unmarshal(raw, value); err != nil {
+		return block.Errorf(block.ERROR_INVALID_REQUEST, "parameter %s: %w", name, err)
+	}
+	return nil
+}
+
+func rpcResult(request rpcRequest, result interface{}, rpcErr *rpcError) *rpcResponse {
+	if request.Id == nil {
+		return nil
+	}
+
+	return &rpcResponse{JsonRpc: JSON_RPC_VERSION, Result: result, Error: rpcErr, Id: request.Id}
+}
+
+func newRPCError(code int, message string) *rpcError {
+	return &rpcError{Code: code, Message: message}
+}
+
+func newRPCErrorResponse(id json.RawMessage, code int, message string) *rpcResponse {
+	if id == nil {
+		id = json.RawMessage("null")
+	}
+
+	return &rpcResponse{JsonRpc: JSON_RPC_VERSION, Error: newRPCError(code, message), Id: id}
+}
+
+// rpcErrorFrom turns an error of the block package into an RPC error,
+// keeping its ErrorCode as data
+func rpcErrorFrom(err error) *rpcError {
+	code := block.ErrorCodeOf(err)
+
+	rpcCode := RPC_SERVER_ERROR
+	switch code {
+	case block.ERROR_INVALID_REQUEST, block.ERROR_MALFORMED_KEY:
+		rpcCode = RPC_INVALID_PARAMS
+	case block.ERROR_INTERNAL:
+		rpcCode = RPC_INTERNAL_ERROR
+	}
+
+	return &rpcError{Code: rpcCode, Message: err.Error(), Data: block.NewErrorResponse(err).Error}
+}
+
+func writeRPC(writer http.ResponseWriter, response interface{}) {
+	marshal, _ := json.Marshal(response)
+
+	writer.Header().Add("Content-Type", "application/json")
+	io.WriteString(writer, string(marshal[:]))
+}
+
+func rpcGetBlockByHeight(server *Server, params map[string]json.RawMessage) (interface{}, error) {
+	var height int
+	if err := rpcParam(params, "height", &height, true); err != nil {
+		return nil, err
+	}
+
+	found, ok := server.GetBlockchain().BlockByHeight(height)
+	if !ok {
+		return nil, block.Errorf(block.ERROR_NOT_FOUND, "no block at height %d", height)
+	}
+
+	return struct {
+		Block  *block.Block `json:"block"`
+		Hash   string       `json:"hash"`
+		Height int          `json:"height"`
+	}{
+		Block:  found,
+		Hash:   fmt.Sprintf("%x", found.Hash()),
+		Height: height,
+	}, nil
+}
+
+func rpcGetTransaction(server *Server, params map[string]json.RawMessage) (interface{}, error) {
+	var idStr string
+	if err := rpcParam(params, "id", &idStr, true); err != nil {
+		return nil, err
+	}
+	id, err := hex.DecodeString(idStr)
+	if err != nil || len(id) != 32 {
+		return nil, block.Errorf(block.ERROR_INVALID_REQUEST, "invalid transaction ID %q", idStr)
+	}
+
+	blockchain := server.GetBlockchain()
+	transaction, height, ok := blockchain.FindTransaction(*(*[32]byte)(id))
+	if !ok {
+		return nil, block.Errorf(block.ERROR_NOT_FOUND, "transaction %s is unknown", idStr)
+	}
+
+	// Pending transactions have no block and no confirmations yet
+	var blockHeight *int
+	confirmations := 0
+	if height >= 0 {
+		_, head := blockchain.Head()
+		blockHeight = &height
+		confirmations = head - height + 1
+	}
+
+	return struct {
+		Transaction   *block.Transaction `json:"transaction"`
+		Pending       bool               `json:"pending"`
+		Height        *int               `json:"height"`
+		Confirmations int                `json:"confirmations"`
+	}{
+		Transaction:   transaction,
+		Pending:       height < 0,
+		Height:        blockHeight,
+		Confirmations: confirmations,
+	}, nil
+}
+
+func rpcSendTransaction(server *Server, params map[string]json.RawMessage) (interface{}, error) {
+	var transactionRequest block.TransactionRequest
+	if err := rpcParam(params, "transaction", &transactionRequest, true); err != nil {
+		return nil, err
+	}
+	if !transactionRequest.Validate() {
+		return nil, block.NewError(block.ERROR_INVALID_REQUEST, "transaction request is missing required fields")
+	}
+
+	transaction, err := transactionRequest.Transaction()
+	if err != nil {
+		return nil, block.WrapError(block.ERROR_INVALID_REQUEST, err)
+	}
+	if err := server.GetBlockchain().SubmitTransaction(transaction); err != nil {
+		return nil, err
+	}
+
+	return struct {
+		Id string `json:"id"`
+	}{
+		Id: fmt.Sprintf("%x", transaction.Hash()),
+	}, nil
+}
+
+func rpcGetBalance(server *Server, params map[string]json.RawMessage) (interface{}, error) {
+	var address string
+	if err := rpcParam(params, "address", &address, true); err != nil {
+		return nil, err
+	}
+
+	amount, available := server.GetBlockchain().Balance(address)
+	return struct {
+		Address   string  `json:"address"`
+		Amount    float32 `json:"amount"`
+		Available float32 `json:"available"`
+	}{
+		Address:   address,
+		Amount:    amount,
+		Available: available,
+	}, nil
+}
+
+func rpcGetMempool(server *Server, params map[string]json.RawMessage) (interface{}, error) {
+	query := &block.MempoolQuery{SortBy: block.MEMPOOL_SORT_TIME}
+	for name, value := range map[string]interface{}{
+		"sender":    &query.Sender,
+		"recipient": &query.Recipient,
+		"offset":    &query.Offset,
+		"limit":     &query.Limit,
+	} {
+		if err := rpcParam(params, name, value, false); err != nil {
+			return nil, err
+		}
+	}
+	if query.Offset < 0 || query.Limit < 0 || query.Limit > MAX_PAGE_LIMIT {
+		return nil, block.Errorf(block.ERROR_INVALID_REQUEST, "offset must not be negative, limit between 0 and %d", MAX_PAGE_LIMIT)
+	}
+
+	transactions, total := server.GetBlockchain().QueryTransactionPool(query)
+	return struct {
+		Transactions []*block.Transaction `json:"transactions"`
+		Length       int                  `json:"length"`
+		Total        int                  `json:"total"`
+	}{
+		Transactions: transactions,
+		Length:       len(transactions),
+		Total:        total,
+	}, nil
+}
+
+func rpcGetChainInfo(server *Server, params map[string]json.RawMessage) (interface{}, error) {
+	blockchain := server.GetBlockchain()
+	head, height := blockchain.Head()
+	_, pending := blockchain.QueryTransactionPool(&block.MempoolQuery{SortBy: block.MEMPOOL_SORT_TIME, Limit: 1})
+
+	return struct {
+		ChainId     string              `json:"chainId"`
+		GenesisHash string              `json:"genesisHash"`
+		Height      int                 `json:"height"`
+		BestHash    string              `json:"bestHash"`
+		Ledger      block.LedgerMode    `json:"ledger"`
+		Consensus   block.ConsensusType `json:"consensus"`
+		Pending     int                 `json:"pending"`
+	}{
+		ChainId:     blockchain.ChainId(),
+		GenesisHash: fmt.Sprintf("%x", blockchain.GenesisHash()),
+		Height:      height,
+		BestHash:    fmt.Sprintf("%x", head.Hash()),
+		Ledger:      blockchain.LedgerMode(),
+		Consensus:   server.config.Engine.Type(),
+		Pending:     pending,
+	}, nil
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"crypto-blockchain/block"
+	"crypto-blockchain/wallet"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// rpcAnswer is the ID and error code expected of a response,
+// a code of 0 meaning a result
+type rpcAnswer struct {
+	id   string
+	code int
+}
+
+// newRPCServer returns a Server on a regtest chain at TEST_CLOCK_START
+func newRPCServer(t *testing.T) *Server {
+	t.Helper()
+	delete(cache, "blockchain")
+	t.Cleanup(func() { delete(cache, "blockchain") })
+
+	config := block.DefaultChainConfig()
+	config.Engine = block.NewProofOfWorkEngine(0)
+	config.Clock = block.NewMockClock(time.Unix(TEST_CLOCK_START, 0).UnixNano())
+	return NewServer(5000, config, wallet.NewWallet())
+}
+
+func TestRPC(t *testing.T) {
+	const (
+		chainInfo    = `{"jsonrpc":"2.0","method":"getChainInfo","id":1}`
+		notification = `{"jsonrpc":"2.0","method":"getChainInfo"}`
+		unknown      = `{"jsonrpc":"2.0","method":"getNothing","id":2}`
+	)
+
+	cases := []struct {
+		name   string
+		body   string
+		status int
+		// batch tells whether the answers come as an array
+		batch   bool
+		answers []rpcAnswer
+	}{
+		{"single call", chainInfo, http.StatusOK, false, []rpcAnswer{{"1", 0}}},
+		{"string id", `{"jsonrpc":"2.0","method":"getChainInfo","id":"a"}`, http.StatusOK, false, []rpcAnswer{{`"a"`, 0}}},
+		{"notification", notification, http.StatusNoContent, false, nil},
+		{"failed notification", `{"jsonrpc":"2.0","method":"getNothing"}`, http.StatusNoContent, false, nil},
+		{"parse error", `{"jsonrpc":`, http.StatusOK, false, []rpcAnswer{{"null", RPC_PARSE_ERROR}}},
+		{"not JSON-RPC 2.0", `{"method":"getChainInfo","id":1}`, http.StatusOK, false, []rpcAnswer{{"1", RPC_INVALID_REQUEST}}},
+		{"method not found", unknown, http.StatusOK, false, []rpcAnswer{{"2", RPC_METHOD_NOT_FOUND}}},
+		{"too many params", `{"jsonrpc":"2.0","method":"getBalance","params":["a","b"],"id":3}`,
+			http.StatusOK, false, []rpcAnswer{{"3", RPC_INVALID_PARAMS}}},
+		{"missing param", `{"jsonrpc":"2.0","method":"getBalance","params":{},"id":4}`,
+			http.StatusOK, false, []rpcAnswer{{"4", RPC_INVALID_PARAMS}}},
+		{"mistyped param", `{"jsonrpc":"2.0","method":"getBlockByHeight","params":["zero"],"id":5}`,
+			http.StatusOK, false, []rpcAnswer{{"5", RPC_INVALID_PARAMS}}},
+		{"positional params", `{"jsonrpc":"2.0","method":"getBlockByHeight","params":[0],"id":6}`,
+			http.StatusOK, false, []rpcAnswer{{"6", 0}}},
+		{"empty batch", `[]`, http.StatusOK, false, []rpcAnswer{{"null", RPC_INVALID_REQUEST}}},
+		{"batch parse error", `[` + chainInfo, http.StatusOK, false, []rpcAnswer{{"null", RPC_PARSE_ERROR}}},
+		{"oversized batch", `[` + strings.Repeat(chainInfo+`,`, MAX_RPC_BATCH) + chainInfo + `]`,
+			http.StatusOK, false, []rpcAnswer{{"null", RPC_INVALID_REQUEST}}},
+		{"batch", `[` + chainInfo + `,` + notification + `,` + unknown + `]`,
+			http.StatusOK, true, []rpcAnswer{{"1", 0}, {"2", RPC_METHOD_NOT_FOUND}}},
+		{"batch with an invalid call", `[1,` + chainInfo + `]`,
+			http.StatusOK, true, []rpcAnswer{{"null", RPC_INVALID_REQUEST}, {"1", 0}}},
+		{"batch of notifications", `[` + notification + `,` + notification + `]`, http.StatusNoContent, false, nil},
+	}
+
+	for _, test := range cases {
+		t.Run(test.name, func(t *testing.T) {
+			server := newRPCServer(t)
+			req := httptest.NewRequest(http.MethodPost, "/rpc", strings.NewReader(test.body))
+			recorder := httptest.NewRecorder()
+			server.RPC(recorder, req)
+
+			if recorder.Code != test.status {
+				t.Fatalf("answered %d, want %d", recorder.Code, test.status)
+			}
+			if test.status == http.StatusNoContent {
+				if recorder.Body.Len() != 0 {
+					t.Errorf("answered a notification with %s", recorder.Body)
+				}
+				return
+			}
+
+			var responses []*rpcResponse
+			var err error
+			if test.batch {
+				err = json.Unmarshal(recorder.Body.Bytes(), &responses)
+			} else {
+				responses = []*rpcResponse{{}}
+				err = json.Unmarshal(recorder.Body.Bytes(), responses[0])
+			}
+			if err != nil {
+				t.Fatalf("answered %s: %v", recorder.Body, err)
+			}
+			if len(responses) != len(test.answers) {
+				t.Fatalf("answered %d responses, want %d", len(responses), len(test.answers))
+			}
+
+			for i, response := range responses {
+				code := 0
+				if response.Error != nil {
+					code = response.Error.Code
+				}
+				answer := test.answers[i]
+				if string(response.Id) != answer.id || code != answer.code || response.JsonRpc != JSON_RPC_VERSION {
+					t.Errorf("response %d has id %s and code %d, want %s and %d", i, response.Id, code, answer.id, answer.code)
+				}
+				if code == 0 && response.Result == nil {
+					t.Errorf("response %d has no result", i)
+				}
+			}
+		})
+	}
+}
+
+func TestRPCMethodNotAllowed(t *testing.T) {
+	server := newRPCServer(t)
+	recorder := httptest.NewRecorder()
+	server.RPC(recorder, httptest.NewRequest(http.MethodGet, "/rpc", nil))
+
+	if recorder.Code != http.StatusMethodNotAllowed {
+		t.Errorf("answered %d, want %d", recorder.Code, http.StatusMethodNotAllowed)
+	}
+}
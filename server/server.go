@@ -2,23 +2,72 @@ package main
 
 import (
 	"crypto-blockchain/block"
-	"crypto-blockchain/utils"
 	"crypto-blockchain/wallet"
+	"encoding/hex"
 	"encoding/json"
+	"fmt"
 	"io"
 	"log"
 	"net/http"
 	"strconv"
+	"sync"
+	"time"
 )
 
 var cache map[string]*block.Blockchain = make(map[string]*block.Blockchain)
 
+const (
+	MAX_PAGE_LIMIT    = 1000
+	FETCH_TIMEOUT_SEC = 10
+	CHAIN_ID_HEADER   = "X-Chain-Id"
+)
+
 type Server struct {
-	port uint16
+	port         uint16
+	config       *block.ChainConfig
+	minersWallet *wallet.Wallet
+	peersMux     sync.Mutex
+	peers        map[string]bool
+	events       *EventHub
+	webhooks     *WebhookRegistry
+	grpcPort     uint16
+}
+
+// NewServer generates and returns new Server. The miner's wallet
+// receives the coinbase and seals blocks for engines that sign them
+func NewServer(port uint16, config *block.ChainConfig, minersWallet *wallet.Wallet) *Server {
+	return &Server{
+		port:         port,
+		config:       config,
+		minersWallet: minersWallet,
+		peers:        make(map[string]bool),
+		events:       NewEventHub(),
+	}
+}
+
+// SetPeers sets the nodes, given as host:port, that blocks may be
+// relayed from with a source and that missing ancestors are fetched from
+func (server *Server) SetPeers(peers []string) {
+	server.peersMux.Lock()
+	defer server.peersMux.Unlock()
+
+	for _, peer := range peers {
+		server.peers[peer] = false
+	}
 }
 
-func NewServer(port uint16) *Server {
-	return &Server{port}
+// isPeer tells whether the source is one of the peers
+func (server *Server) isPeer(source string) bool {
+	server.peersMux.Lock()
+	defer server.peersMux.Unlock()
+
+	_, ok := server.peers[source]
+	return ok
+}
+
+// SetWebhooks makes the Server notify the webhooks of the registry
+func (server *Server) SetWebhooks(registry *WebhookRegistry) {
+	server.webhooks = registry
 }
 
 func (server *Server) Port() uint16 {
@@ -29,8 +78,13 @@ func (server *Server) GetBlockchain() *block.Blockchain {
 	blockchain, ok := cache["blockchain"]
 
 	if !ok {
-		minersWallet := wallet.NewWallet()
-		blockchain = block.NewBlockChain(minersWallet.Address(), server.Port())
+		minersWallet := server.minersWallet
+		blockchain = block.NewBlockChainWithConfig(minersWallet.Address(), server.Port(), server.config)
+		blockchain.SetBlockFetcher(server.fetchBlock)
+		server.events.Listen(blockchain)
+		if server.webhooks != nil {
+			server.webhooks.Listen(blockchain)
+		}
 		cache["blockchain"] = blockchain
 
 		log.Printf("private_key %v", minersWallet.PrivateKeyStr())
@@ -51,23 +105,30 @@ func (server *Server) GetChain(writer http.ResponseWriter, req *http.Request) {
 
 		io.WriteString(writer, string(marshal[:]))
 	default:
-		writer.WriteHeader(http.StatusMethodNotAllowed)
-		writer.Write([]byte("405 - Method not allowed"))
+		writeMethodNotAllowed(writer)
 	}
 }
 
 func (server *Server) Transactions(writer http.ResponseWriter, req *http.Request) {
 	switch req.Method {
 	case http.MethodGet:
+		query, err := mempoolQueryFromRequest(req)
+		if err != nil {
+			writeError(writer, block.ERROR_INVALID_REQUEST, err)
+			return
+		}
+
 		writer.Header().Add("Content-Type", "application/json")
 		blockchain := server.GetBlockchain()
-		transactions := blockchain.TransactionPool()
+		transactions, total := blockchain.QueryTransactionPool(query)
 		marshal, _ := json.Marshal(struct {
 			Transactions []*block.Transaction `json:"transactions"`
 			Length       int                  `json:"length"`
+			Total        int                  `json:"total"`
 		}{
 			Transactions: transactions,
 			Length:       len(transactions),
+			Total:        total,
 		})
 		io.WriteString(writer, string(marshal[:]))
 
@@ -77,39 +138,38 @@ func (server *Server) Transactions(writer http.ResponseWriter, req *http.Request
 
 		err := decoder.Decode(&transactionRequest)
 		if err != nil {
-			writer.WriteHeader(http.StatusBadRequest)
-			writer.Write([]byte(err.Error()))
+			writeError(writer, block.ERROR_INVALID_REQUEST, err)
 			return
 		}
 		if !transactionRequest.Validate() {
-			writer.WriteHeader(http.StatusBadRequest)
-			writer.Write([]byte("An error occurred while validating your transaction"))
+			writeErrorMessage(writer, block.ERROR_INVALID_REQUEST, "transaction request is missing required fields")
+			return
 		}
 
-		publicKey := utils.PublicKeyFromString(*transactionRequest.SenderPublicKey)
-		signature := utils.SignatureFromString(*transactionRequest.Signature)
+		transaction, err := transactionRequest.Transaction()
+		if err != nil {
+			writeError(writer, block.ERROR_INVALID_REQUEST, err)
+			return
+		}
 
 		blockchain := server.GetBlockchain()
-		isCreated := blockchain.CreateTransaction(*transactionRequest.SenderAddress,
-			*transactionRequest.RecipientAddress,
-			*transactionRequest.Value,
-			publicKey,
-			signature)
-
-		writer.Header().Add("Content-Type", "application/json")
-
-		var marshal []byte
-		if !isCreated {
-			writer.WriteHeader(http.StatusBadRequest)
-			writer.Write([]byte("An error occurred while creating your transaction"))
-		} else {
-			writer.WriteHeader(http.StatusCreated)
+		if err := blockchain.SubmitTransaction(transaction); err != nil {
+			writeError(writer, block.ERROR_INVALID_TRANSACTION, err)
+			return
 		}
 
-		io.WriteString(writer, string(marshal))
+		marshal, _ := json.Marshal(struct {
+			Id string `json:"id"`
+		}{
+			Id: fmt.Sprintf("%x", transaction.Hash()),
+		})
+
+		writer.Header().Add("Content-Type", "application/json")
+		writer.WriteHeader(http.StatusCreated)
+		io.WriteString(writer, string(marshal[:]))
 
 	default:
-		writer.WriteHeader(http.StatusMethodNotAllowed)
+		writeMethodNotAllowed(writer)
 	}
 }
 
@@ -117,20 +177,14 @@ func (server *Server) Mine(writer http.ResponseWriter, req *http.Request) {
 	switch req.Method {
 	case http.MethodGet:
 		blockchain := server.GetBlockchain()
-		isMined := blockchain.Mining()
-
-		var marshal []byte
-		if !isMined {
-			writer.WriteHeader(http.StatusBadRequest)
-			marshal = []byte("Block wasn't mined")
-		} else {
-			marshal = []byte("Block was mined")
+		if !blockchain.Mining() {
+			writeErrorMessage(writer, block.ERROR_MINING_FAILED, "Block wasn't mined")
+			return
 		}
 
-		writer.Header().Add("Content-Type", "apllication/json")
-		io.WriteString(writer, string(marshal))
+		writeMessage(writer, "Block was mined")
 	default:
-		writer.WriteHeader(http.StatusMethodNotAllowed)
+		writeMethodNotAllowed(writer)
 	}
 }
 
@@ -140,11 +194,9 @@ func (server *Server) StartMine(writer http.ResponseWriter, req *http.Request) {
 		blockchain := server.GetBlockchain()
 		blockchain.StartMining()
 
-		marshal := []byte("Mining was ended successfully")
-		writer.Header().Add("Content-Type", "apllication/json")
-		io.WriteString(writer, string(marshal))
+		writeMessage(writer, "Mining was ended successfully")
 	default:
-		writer.WriteHeader(http.StatusMethodNotAllowed)
+		writeMethodNotAllowed(writer)
 	}
 }
 
@@ -153,26 +205,533 @@ func (server *Server) Amount(writer http.ResponseWriter, req *http.Request) {
 	case http.MethodGet:
 		address := req.URL.Query().Get("address")
 		if address == "" {
-			writer.WriteHeader(http.StatusBadRequest)
+			writeErrorMessage(writer, block.ERROR_INVALID_REQUEST, "address is required")
+			return
 		}
 
-		amount := server.GetBlockchain().CalculateTotalAmount(address)
-		amountResponse := &block.AmountResponse{amount}
+		amount, _ := server.GetBlockchain().Balance(address)
+		amountResponse := &block.AmountResponse{Amount: amount}
 		marshal, _ := json.Marshal(amountResponse)
 
 		writer.Header().Add("Content-Type", "application/json")
 		io.WriteString(writer, string(marshal[:]))
 
 	default:
-		writer.WriteHeader(http.StatusMethodNotAllowed)
+		writeMethodNotAllowed(writer)
+	}
+}
+
+// UTXOs lists the unspent outputs of an address, so wallets can
+// pick inputs for their transactions
+func (server *Server) UTXOs(writer http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet:
+		blockchain := server.GetBlockchain()
+		if blockchain.LedgerMode() != block.LEDGER_MODE_UTXO {
+			writeErrorMessage(writer, block.ERROR_NOT_FOUND, "node does not keep a UTXO ledger")
+			return
+		}
+
+		address := req.URL.Query().Get("address")
+		if address == "" {
+			writeErrorMessage(writer, block.ERROR_INVALID_REQUEST, "address is required")
+			return
+		}
+
+		utxos := blockchain.UTXOs(address)
+		marshal, _ := json.Marshal(struct {
+			UTXOs  []*block.UTXO `json:"utxos"`
+			Length int           `json:"length"`
+		}{
+			UTXOs:  utxos,
+			Length: len(utxos),
+		})
+
+		writer.Header().Add("Content-Type", "application/json")
+		io.WriteString(writer, string(marshal[:]))
+
+	default:
+		writeMethodNotAllowed(writer)
+	}
+}
+
+// Validators lists the keys allowed to propose the next block with
+// their stake, for consensus engines that have validators
+func (server *Server) Validators(writer http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet:
+		validators, ok := server.GetBlockchain().Validators()
+		if !ok {
+			writeErrorMessage(writer, block.ERROR_NOT_FOUND, "consensus engine has no validators")
+			return
+		}
+
+		marshal, _ := json.Marshal(struct {
+			Validators []*block.Validator `json:"validators"`
+			Length     int                `json:"length"`
+		}{
+			Validators: validators,
+			Length:     len(validators),
+		})
+
+		writer.Header().Add("Content-Type", "application/json")
+		io.WriteString(writer, string(marshal[:]))
+
+	default:
+		writeMethodNotAllowed(writer)
+	}
+}
+
+// Finality returns the latest justified and finalized checkpoints
+func (server *Server) Finality(writer http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet:
+		status, ok := server.GetBlockchain().Finality()
+		if !ok {
+			writeErrorMessage(writer, block.ERROR_NOT_FOUND, "finality is disabled")
+			return
+		}
+
+		marshal, _ := json.Marshal(status)
+		writer.Header().Add("Content-Type", "application/json")
+		io.WriteString(writer, string(marshal[:]))
+
+	default:
+		writeMethodNotAllowed(writer)
+	}
+}
+
+// Votes lists the finality votes for the checkpoint at a height,
+// or takes a vote of another validator
+func (server *Server) Votes(writer http.ResponseWriter, req *http.Request) {
+	blockchain := server.GetBlockchain()
+	if _, ok := blockchain.Finality(); !ok {
+		writeErrorMessage(writer, block.ERROR_NOT_FOUND, "finality is disabled")
+		return
+	}
+
+	switch req.Method {
+	case http.MethodGet:
+		height, err := intFromQuery(req.URL.Query().Get("height"), 0)
+		if err != nil {
+			writeError(writer, block.ERROR_INVALID_REQUEST, err)
+			return
+		}
+
+		votes := blockchain.Votes(height)
+		marshal, _ := json.Marshal(struct {
+			Votes  []*block.Vote `json:"votes"`
+			Length int           `json:"length"`
+		}{
+			Votes:  votes,
+			Length: len(votes),
+		})
+
+		writer.Header().Add("Content-Type", "application/json")
+		io.WriteString(writer, string(marshal[:]))
+
+	case http.MethodPost:
+		decoder := json.NewDecoder(req.Body)
+		var voteRequest block.VoteRequest
+
+		if err := decoder.Decode(&voteRequest); err != nil {
+			writeError(writer, block.ERROR_INVALID_REQUEST, err)
+			return
+		}
+		if !voteRequest.Validate() {
+			writeErrorMessage(writer, block.ERROR_INVALID_REQUEST, "vote request is missing required fields")
+			return
+		}
+
+		vote, err := voteRequest.Vote()
+		if err != nil {
+			writeError(writer, block.ERROR_INVALID_REQUEST, err)
+			return
+		}
+		if err := blockchain.AddVote(vote); err != nil {
+			writeError(writer, block.ERROR_INVALID_VOTE, err)
+			return
+		}
+
+		writer.WriteHeader(http.StatusCreated)
+
+	default:
+		writeMethodNotAllowed(writer)
+	}
+}
+
+// Blocks returns the known block with the hash, or the tips of the
+// chain and its forks without one, and takes blocks from other nodes
+func (server *Server) Blocks(writer http.ResponseWriter, req *http.Request) {
+	blockchain := server.GetBlockchain()
+
+	switch req.Method {
+	case http.MethodGet:
+		var marshal []byte
+		if hashStr := req.URL.Query().Get("hash"); hashStr != "" {
+			hash, err := hex.DecodeString(hashStr)
+			if err != nil || len(hash) != 32 {
+				writeErrorMessage(writer, block.ERROR_INVALID_REQUEST, "invalid block hash")
+				return
+			}
+
+			found, height, ok := blockchain.GetBlock(*(*[32]byte)(hash))
+			if !ok {
+				writeErrorMessage(writer, block.ERROR_NOT_FOUND, fmt.Sprintf("block %s is unknown", hashStr))
+				return
+			}
+			marshal, _ = json.Marshal(struct {
+				Block   *block.Block `json:"block"`
+				Height  int          `json:"height"`
+				InChain bool         `json:"inChain"`
+			}{
+				Block:   found,
+				Height:  height,
+				InChain: blockchain.InChain(found, height),
+			})
+		} else {
+			tips := blockchain.Tips()
+			marshal, _ = json.Marshal(struct {
+				Tips   []*block.Block `json:"tips"`
+				Length int            `json:"length"`
+			}{
+				Tips:   tips,
+				Length: len(tips),
+			})
+		}
+
+		writer.Header().Add("Content-Type", "application/json")
+		io.WriteString(writer, string(marshal[:]))
+
+	case http.MethodPost:
+		// Blocks of another network would fail on their transactions anyway
+		if chainId := req.Header.Get(CHAIN_ID_HEADER); chainId != "" && chainId != blockchain.ChainId() {
+			writeErrorMessage(writer, block.ERROR_WRONG_CHAIN,
+				fmt.Sprintf("block is from chain %s, this node is on %s", chainId, blockchain.ChainId()))
+			return
+		}
+
+		decoder := json.NewDecoder(req.Body)
+		var relayed block.Block
+
+		if err := decoder.Decode(&relayed); err != nil {
+			writeError(writer, block.ERROR_INVALID_REQUEST, err)
+			return
+		}
+		// The node relaying the block is asked for its missing ancestors,
+		// as long as it is a peer. Nobody else makes this node call out.
+		// Orphans are kept, answered with 202 Accepted and orphan_block
+		source := req.URL.Query().Get("source")
+		if source != "" && !server.isPeer(source) {
+			writeErrorMessage(writer, block.ERROR_INVALID_REQUEST, fmt.Sprintf("source %s is not a peer of this node", source))
+			return
+		}
+		err := blockchain.AddBlock(&relayed, source)
+		if err != nil {
+			writeError(writer, block.ERROR_INVALID_BLOCK, err)
+			return
+		}
+
+		writer.WriteHeader(http.StatusCreated)
+
+	default:
+		writeMethodNotAllowed(writer)
+	}
+}
+
+// fetchBlock requests the block with the hash from the node at the
+// source, given as host:port, once it proved to be on the same network
+func (server *Server) fetchBlock(source string, hash [32]byte) (*block.Block, error) {
+	if err := server.handshake(source); err != nil {
+		return nil, err
+	}
+
+	client := &http.Client{Timeout: time.Second * FETCH_TIMEOUT_SEC}
+	fetchReq, err := http.NewRequest(http.MethodGet, fmt.Sprintf("http://%s/blocks?hash=%x", source, hash), nil)
+	if err != nil {
+		return nil, err
+	}
+	fetchReq.Header.Set(CHAIN_ID_HEADER, server.GetBlockchain().ChainId())
+
+	res, err := client.Do(fetchReq)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s answered %s", source, res.Status)
+	}
+
+	var found struct {
+		Block *block.Block `json:"block"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&found); err != nil {
+		return nil, err
+	}
+	if found.Block == nil {
+		return nil, fmt.Errorf("%s sent no block", source)
+	}
+
+	return found.Block, nil
+}
+
+// handshake checks that the source is a peer sharing the chain ID
+// and genesis block of this node. Peers passing it are remembered
+func (server *Server) handshake(source string) error {
+	server.peersMux.Lock()
+	passed, ok := server.peers[source]
+	server.peersMux.Unlock()
+	if !ok {
+		return fmt.Errorf("%s is not a peer of this node", source)
+	}
+	if passed {
+		return nil
+	}
+
+	client := &http.Client{Timeout: time.Second * FETCH_TIMEOUT_SEC}
+	res, err := client.Get(fmt.Sprintf("http://%s/network", source))
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s answered %s", source, res.Status)
+	}
+
+	var network struct {
+		ChainId     string `json:"chainId"`
+		GenesisHash string `json:"genesisHash"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&network); err != nil {
+		return err
+	}
+
+	blockchain := server.GetBlockchain()
+	if network.ChainId != blockchain.ChainId() {
+		return fmt.Errorf("%s is on chain %s, this node is on %s", source, network.ChainId, blockchain.ChainId())
+	}
+	if network.GenesisHash != fmt.Sprintf("%x", blockchain.GenesisHash()) {
+		return fmt.Errorf("%s has another genesis block %s", source, network.GenesisHash)
+	}
+
+	server.peersMux.Lock()
+	server.peers[source] = true
+	server.peersMux.Unlock()
+
+	return nil
+}
+
+// Generate mines blocks right away on regtest, paying their coinbases
+// to the address, so tests can fund wallets and confirm transactions
+func (server *Server) Generate(writer http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodPost:
+		decoder := json.NewDecoder(req.Body)
+		var generateRequest block.GenerateRequest
+
+		if err := decoder.Decode(&generateRequest); err != nil {
+			writeError(writer, block.ERROR_INVALID_REQUEST, err)
+			return
+		}
+		if !generateRequest.Validate() {
+			writeErrorMessage(writer, block.ERROR_INVALID_REQUEST, "blocks and address are required")
+			return
+		}
+
+		blocks, err := server.GetBlockchain().Generate(*generateRequest.Blocks, *generateRequest.Address)
+		if err != nil {
+			writeError(writer, block.ERROR_INVALID_REQUEST, err)
+			return
+		}
+
+		hashes := make([]string, 0, len(blocks))
+		for _, generated := range blocks {
+			hashes = append(hashes, fmt.Sprintf("%x", generated.Hash()))
+		}
+		marshal, _ := json.Marshal(struct {
+			Hashes []string `json:"hashes"`
+			Length int      `json:"length"`
+		}{
+			Hashes: hashes,
+			Length: len(hashes),
+		})
+
+		writer.Header().Add("Content-Type", "application/json")
+		writer.WriteHeader(http.StatusCreated)
+		io.WriteString(writer, string(marshal[:]))
+
+	default:
+		writeMethodNotAllowed(writer)
 	}
 }
 
+// Clock shows the mock clock of regtest, and sets or advances it
+func (server *Server) Clock(writer http.ResponseWriter, req *http.Request) {
+	clock, ok := server.config.Clock.(*block.MockClock)
+	if !ok {
+		writeErrorMessage(writer, block.ERROR_NOT_FOUND, "node is not in regtest mode")
+		return
+	}
+
+	switch req.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		decoder := json.NewDecoder(req.Body)
+		var clockRequest block.ClockRequest
+
+		if err := decoder.Decode(&clockRequest); err != nil {
+			writeError(writer, block.ERROR_INVALID_REQUEST, err)
+			return
+		}
+		if !clockRequest.Validate() {
+			writeErrorMessage(writer, block.ERROR_INVALID_REQUEST, "either time or advance is required")
+			return
+		}
+		if err := clockRequest.Apply(clock); err != nil {
+			writeError(writer, block.ERROR_INVALID_REQUEST, err)
+			return
+		}
+
+	default:
+		writeMethodNotAllowed(writer)
+		return
+	}
+
+	now := clock.Now()
+	marshal, _ := json.Marshal(struct {
+		Time  int64 `json:"time"`
+		Nanos int64 `json:"nanos"`
+	}{
+		Time:  time.Unix(0, now).Unix(),
+		Nanos: now,
+	})
+
+	writer.Header().Add("Content-Type", "application/json")
+	io.WriteString(writer, string(marshal[:]))
+}
+
+// Network describes the network of the node, for peers
+// to check they share its chain ID and genesis block
+func (server *Server) Network(writer http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet:
+		blockchain := server.GetBlockchain()
+		marshal, _ := json.Marshal(struct {
+			ChainId     string         `json:"chainId"`
+			GenesisHash string         `json:"genesisHash"`
+			Genesis     *block.Genesis `json:"genesis"`
+		}{
+			ChainId:     blockchain.ChainId(),
+			GenesisHash: fmt.Sprintf("%x", blockchain.GenesisHash()),
+			Genesis:     server.config.Genesis,
+		})
+
+		writer.Header().Add("Content-Type", "application/json")
+		io.WriteString(writer, string(marshal[:]))
+
+	default:
+		writeMethodNotAllowed(writer)
+	}
+}
+
+// Reorgs lists the latest chain reorganisations with their depth
+func (server *Server) Reorgs(writer http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet:
+		reorgs := server.GetBlockchain().Reorgs()
+		marshal, _ := json.Marshal(struct {
+			Reorgs []*block.ReorgEvent `json:"reorgs"`
+			Length int                 `json:"length"`
+		}{
+			Reorgs: reorgs,
+			Length: len(reorgs),
+		})
+
+		writer.Header().Add("Content-Type", "application/json")
+		io.WriteString(writer, string(marshal[:]))
+
+	default:
+		writeMethodNotAllowed(writer)
+	}
+}
+
+// mempoolQueryFromRequest reads the sender and recipient filters, the
+// sort field and order (sort=time|fee, order=asc|desc) and the page
+// (offset, limit) of a GET /transactions request
+func mempoolQueryFromRequest(req *http.Request) (*block.MempoolQuery, error) {
+	values := req.URL.Query()
+	query := &block.MempoolQuery{
+		Sender:    values.Get("sender"),
+		Recipient: values.Get("recipient"),
+		SortBy:    block.MEMPOOL_SORT_TIME,
+	}
+
+	switch sortBy := values.Get("sort"); sortBy {
+	case "", block.MEMPOOL_SORT_TIME:
+	case block.MEMPOOL_SORT_FEE:
+		// Highest fee first unless asked otherwise
+		query.SortBy = sortBy
+		query.Descending = true
+	default:
+		return nil, fmt.Errorf("unsupported sort %q", sortBy)
+	}
+
+	switch order := values.Get("order"); order {
+	case "":
+	case "asc", "desc":
+		query.Descending = order == "desc"
+	default:
+		return nil, fmt.Errorf("unsupported order %q", order)
+	}
+
+	var err error
+	if query.Offset, err = intFromQuery(values.Get("offset"), 0); err != nil || query.Offset < 0 {
+		return nil, fmt.Errorf("invalid offset %q", values.Get("offset"))
+	}
+	if query.Limit, err = intFromQuery(values.Get("limit"), 0); err != nil || query.Limit < 0 || query.Limit > MAX_PAGE_LIMIT {
+		return nil, fmt.Errorf("limit must be between 0 and %d", MAX_PAGE_LIMIT)
+	}
+
+	return query, nil
+}
+
+func intFromQuery(str string, fallback int) (int, error) {
+	if str == "" {
+		return fallback, nil
+	}
+
+	return strconv.Atoi(str)
+}
+
 func (server *Server) Run() {
 	http.HandleFunc("/", server.GetChain)
 	http.HandleFunc("/transactions", server.Transactions)
 	http.HandleFunc("/mine", server.Mine)
 	http.HandleFunc("/mine/start", server.StartMine)
 	http.HandleFunc("/amount", server.Amount)
+	http.HandleFunc("/utxos", server.UTXOs)
+	http.HandleFunc("/validators", server.Validators)
+	http.HandleFunc("/finality", server.Finality)
+	http.HandleFunc("/finality/votes", server.Votes)
+	http.HandleFunc("/blocks", server.Blocks)
+	http.HandleFunc("/reorgs", server.Reorgs)
+	http.HandleFunc("/network", server.Network)
+	http.HandleFunc("/rpc", server.RPC)
+	http.HandleFunc("/events", server.Events)
+	if server.webhooks != nil {
+		http.HandleFunc("/webhooks", server.Webhooks)
+	}
+
+	if server.grpcPort != 0 {
+		go server.serveGRPC()
+	}
+
+	// Regtest runs on a mock clock and mines on demand
+	if _, ok := server.config.Clock.(*block.MockClock); ok {
+		http.HandleFunc("/regtest/generate", server.Generate)
+		http.HandleFunc("/regtest/clock", server.Clock)
+	}
 	log.Fatal(http.ListenAndServe("0.0.0.0:"+strconv.Itoa(int(server.Port())), nil))
 }
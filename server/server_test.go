@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bytes"
+	"crypto-blockchain/block"
+	"crypto-blockchain/wallet"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestBlocksRelayedFromPeersOnly(t *testing.T) {
+	const peer = "127.0.0.1:5001"
+
+	cases := []struct {
+		name    string
+		source  string
+		status  int
+		fetched bool
+	}{
+		{"from a peer", peer, http.StatusAccepted, true},
+		{"without a source", "", http.StatusAccepted, false},
+		{"from another node", "127.0.0.1:5002", http.StatusBadRequest, false},
+	}
+
+	for _, test := range cases {
+		t.Run(test.name, func(t *testing.T) {
+			delete(cache, "blockchain")
+			t.Cleanup(func() { delete(cache, "blockchain") })
+			config := block.DefaultChainConfig()
+			config.Engine = block.NewProofOfWorkEngine(0)
+			config.Clock = block.NewMockClock(time.Unix(TEST_CLOCK_START, 0).UnixNano())
+			server := NewServer(5000, config, wallet.NewWallet())
+			server.SetPeers([]string{peer})
+
+			fetched := make(chan string, 1)
+			server.GetBlockchain().SetBlockFetcher(func(source string, hash [32]byte) (*block.Block, error) {
+				fetched <- source
+				return nil, block.NewError(block.ERROR_NOT_FOUND, "not found")
+			})
+
+			orphan, err := json.Marshal(block.NewBlock(0, [32]byte{1}, nil))
+			if err != nil {
+				t.Fatal(err)
+			}
+			req := httptest.NewRequest(http.MethodPost, "/blocks?source="+test.source, bytes.NewReader(orphan))
+			recorder := httptest.NewRecorder()
+			server.Blocks(recorder, req)
+
+			if recorder.Code != test.status {
+				t.Errorf("answered %d, want %d", recorder.Code, test.status)
+			}
+			select {
+			case source := <-fetched:
+				if !test.fetched || source != test.source {
+					t.Errorf("fetched the parent from %q", source)
+				}
+			case <-time.After(100 * time.Millisecond):
+				if test.fetched {
+					t.Error("the parent was never fetched")
+				}
+			}
+		})
+	}
+}
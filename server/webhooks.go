@@ -0,0 +1,763 @@
+package main
+
+import (
+	"bytes"
+	"crypto-blockchain/block"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Webhook asks for a POST to the URL when a payment to one of the
+// addresses is included in a block, and again once it has the
+// confirmations. Payloads are signed with the secret
+type Webhook struct {
+	Id            string   `json:"id"`
+	Url           string   `json:"url"`
+	Addresses     []string `json:"addresses"`
+	Confirmations int      `json:"confirmations"`
+	Secret        string   `json:"secret"`
+}
+
+type WebhookRequest struct {
+	Url           *string  `json:"url"`
+	Addresses     []string `json:"addresses"`
+	Confirmations *int     `json:"confirmations"`
+}
+
+// WebhookRegistry keeps the webhooks in a file, follows the payments
+// they watch until they are confirmed and delivers the notifications.
+// The watched payments and the undelivered notifications are kept in
+// the file too, so they survive a restart, as is the last Block every
+// Webhook was notified of
+type WebhookRegistry struct {
+	mux           sync.Mutex
+	path          string
+	webhooks      map[string]*Webhook
+	notified      map[string]*notifiedBlock
+	watches       []*paymentWatch
+	deliveries    []*delivery
+	queue         chan *delivery
+	client        *http.Client
+	retryInterval time.Duration
+}
+
+// notifiedBlock is the last Block a Webhook was notified of. A restored
+// one was read from the file, and the chain connected again from genesis
+// after a restart is not notified again until it gets past the Block
+type notifiedBlock struct {
+	blockHash [32]byte
+	height    int
+	restored  bool
+}
+
+// paymentWatch is a payment included at the height that has not
+// reached the confirmations of its Webhook yet. A restored watch was
+// read from the file and waits for the chain to reach its height again
+type paymentWatch struct {
+	webhookId     string
+	address       string
+	transactionId [32]byte
+	transaction   json.RawMessage
+	blockHash     [32]byte
+	height        int
+	restored      bool
+}
+
+// delivery is a notification that has not been delivered yet
+type delivery struct {
+	webhookId string
+	event     string
+	body      []byte
+	attempt   int
+}
+
+const (
+	WEBHOOK_EVENT_INCLUDED  = "included"
+	WEBHOOK_EVENT_CONFIRMED = "confirmed"
+	WEBHOOK_EVENT_REVERTED  = "reverted"
+
+	WEBHOOK_SIGNATURE_HEADER = "X-Webhook-Signature"
+	WEBHOOK_EVENT_HEADER     = "X-Webhook-Event"
+	WEBHOOK_ID_HEADER        = "X-Webhook-Id"
+	WEBHOOK_AUTH_SCHEME      = "Webhook"
+
+	MAX_WEBHOOK_ADDRESSES      = 1000
+	MAX_WEBHOOK_CONFIRMATIONS  = 1000
+	MAX_WEBHOOK_ATTEMPTS       = 6
+	WEBHOOK_QUEUE_SIZE         = 1000
+	WEBHOOK_TIMEOUT_SEC        = 10
+	WEBHOOK_RETRY_INTERVAL_SEC = 5
+)
+
+// Validate checks that the URL and the addresses are given
+func (webhookRequest *WebhookRequest) Validate() bool {
+	return webhookRequest.Url != nil && len(webhookRequest.Addresses) > 0
+}
+
+// Webhook generates and returns new Webhook with a random ID and secret,
+// waiting for a single confirmation unless told otherwise
+func (webhookRequest *WebhookRequest) Webhook() (*Webhook, error) {
+	target, err := url.Parse(*webhookRequest.Url)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		return nil, block.Errorf(block.ERROR_INVALID_REQUEST, "invalid webhook URL %q", *webhookRequest.Url)
+	}
+	if len(webhookRequest.Addresses) > MAX_WEBHOOK_ADDRESSES {
+		return nil, block.Errorf(block.ERROR_INVALID_REQUEST, "at most %d addresses can be watched", MAX_WEBHOOK_ADDRESSES)
+	}
+
+	confirmations := 1
+	if webhookRequest.Confirmations != nil {
+		confirmations = *webhookRequest.Confirmations
+	}
+	if confirmations < 1 || confirmations > MAX_WEBHOOK_CONFIRMATIONS {
+		return nil, block.Errorf(block.ERROR_INVALID_REQUEST, "confirmations must be between 1 and %d", MAX_WEBHOOK_CONFIRMATIONS)
+	}
+
+	addresses := make([]string, 0, len(webhookRequest.Addresses))
+	for _, address := range webhookRequest.Addresses {
+		if address == "" {
+			return nil, block.NewError(block.ERROR_INVALID_REQUEST, "address must not be empty")
+		}
+		addresses = append(addresses, address)
+	}
+
+	id, err := randomHex(16)
+	if err != nil {
+		return nil, err
+	}
+	secret, err := randomHex(32)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Webhook{
+		Id:            id,
+		Url:           target.String(),
+		Addresses:     addresses,
+		Confirmations: confirmations,
+		Secret:        secret,
+	}, nil
+}
+
+// watches tells which address of the Webhook the Transaction pays to
+func (webhook *Webhook) watches(transaction *block.Transaction) (string, bool) {
+	for _, address := range webhook.Addresses {
+		if transaction.PaysTo(address) {
+			return address, true
+		}
+	}
+
+	return "", false
+}
+
+// LoadWebhookRegistry restores the webhooks registered in the file,
+// a missing file holds none
+func LoadWebhookRegistry(path string) (*WebhookRegistry, error) {
+	registry := &WebhookRegistry{
+		path:          path,
+		webhooks:      make(map[string]*Webhook),
+		notified:      make(map[string]*notifiedBlock),
+		queue:         make(chan *delivery, WEBHOOK_QUEUE_SIZE),
+		client:        &http.Client{Timeout: time.Second * WEBHOOK_TIMEOUT_SEC},
+		retryInterval: time.Second * WEBHOOK_RETRY_INTERVAL_SEC,
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return registry, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var decoded struct {
+		Webhooks   []*Webhook                `json:"webhooks"`
+		Notified   map[string]*notifiedBlock `json:"notified"`
+		Watches    []*paymentWatch           `json:"watches"`
+		Deliveries []*delivery               `json:"deliveries"`
+	}
+	// Files written before watches were kept only hold the webhooks
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("[")) {
+		err = json.Unmarshal(data, &decoded.Webhooks)
+	} else {
+		err = json.Unmarshal(data, &decoded)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading webhooks %s: %w", path, err)
+	}
+	for _, webhook := range decoded.Webhooks {
+		registry.webhooks[webhook.Id] = webhook
+	}
+	for id, notified := range decoded.Notified {
+		registry.notified[id] = notified
+	}
+	registry.watches = decoded.Watches
+	registry.deliveries = decoded.Deliveries
+	log.Printf("Loaded %d webhooks, %d watched payments and %d undelivered events from %s",
+		len(decoded.Webhooks), len(decoded.Watches), len(decoded.Deliveries), path)
+
+	return registry, nil
+}
+
+// Listen follows the blocks of the Blockchain and starts delivering,
+// beginning with the events left undelivered by the last run
+func (registry *WebhookRegistry) Listen(blockchain *block.Blockchain) {
+	blockchain.OnBlock(registry.connectBlock)
+
+	registry.mux.Lock()
+	deliveries := append([]*delivery{}, registry.deliveries...)
+	registry.mux.Unlock()
+	for _, delivery := range deliveries {
+		registry.enqueue(delivery)
+	}
+
+	go registry.deliver()
+}
+
+// Register adds the Webhook and stores the registry. The Webhook is
+// notified of the blocks after the head, the Block at the height
+func (registry *WebhookRegistry) Register(webhook *Webhook, head [32]byte, height int) error {
+	registry.mux.Lock()
+	defer registry.mux.Unlock()
+
+	registry.webhooks[webhook.Id] = webhook
+	registry.notified[webhook.Id] = &notifiedBlock{blockHash: head, height: height}
+	if err := registry.save(); err != nil {
+		delete(registry.webhooks, webhook.Id)
+		delete(registry.notified, webhook.Id)
+		return err
+	}
+
+	return nil
+}
+
+// Remove deletes the Webhook with the ID and stores the registry
+func (registry *WebhookRegistry) Remove(id string) error {
+	registry.mux.Lock()
+	defer registry.mux.Unlock()
+
+	webhook, ok := registry.webhooks[id]
+	if !ok {
+		return block.Errorf(block.ERROR_NOT_FOUND, "webhook %s is unknown", id)
+	}
+
+	notified := registry.notified[id]
+	delete(registry.webhooks, id)
+	delete(registry.notified, id)
+	if err := registry.save(); err != nil {
+		registry.webhooks[id] = webhook
+		registry.notified[id] = notified
+		return err
+	}
+
+	return nil
+}
+
+// Authorize returns the Webhook with the ID when the authorization
+// proves the secret: it is the hex HMAC-SHA256 of the ID under the secret
+func (registry *WebhookRegistry) Authorize(id string, authorization string) (*Webhook, error) {
+	registry.mux.Lock()
+	defer registry.mux.Unlock()
+
+	webhook, ok := registry.webhooks[id]
+	if !ok {
+		return nil, block.Errorf(block.ERROR_NOT_FOUND, "webhook %s is unknown", id)
+	}
+
+	proof := strings.TrimPrefix(authorization, WEBHOOK_AUTH_SCHEME+" ")
+	if proof == authorization ||
+		!hmac.Equal([]byte(proof), []byte(signPayload(webhook.Secret, []byte(webhook.Id)))) {
+		return nil, block.Errorf(block.ERROR_UNAUTHORIZED, "authorization for webhook %s is missing or wrong", id)
+	}
+
+	return webhook, nil
+}
+
+// save writes the webhooks, the watched payments and the undelivered
+// events to a temporary file first, so a crash never leaves the
+// registry half written
+func (registry *WebhookRegistry) save() error {
+	webhooks := make([]*Webhook, 0, len(registry.webhooks))
+	for _, webhook := range registry.webhooks {
+		webhooks = append(webhooks, webhook)
+	}
+
+	data, err := json.MarshalIndent(struct {
+		Webhooks   []*Webhook                `json:"webhooks"`
+		Notified   map[string]*notifiedBlock `json:"notified"`
+		Watches    []*paymentWatch           `json:"watches"`
+		Deliveries []*delivery               `json:"deliveries"`
+	}{
+		Webhooks:   webhooks,
+		Notified:   registry.notified,
+		Watches:    registry.watches,
+		Deliveries: registry.deliveries,
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(registry.path+".tmp", data, 0600); err != nil {
+		return block.WrapError(block.ERROR_INTERNAL, err)
+	}
+
+	return block.WrapError(block.ERROR_INTERNAL, os.Rename(registry.path+".tmp", registry.path))
+}
+
+// connectBlock reports the payments of the Block and the ones it
+// confirms. A Block at the height of a watched payment replaced the
+// Block that included it, so the payment is reported as reverted.
+// The chain is connected again from genesis after a restart, so a
+// restored payment is only reverted by another Block at its height,
+// and the blocks a Webhook was notified of before are not reported again
+func (registry *WebhookRegistry) connectBlock(connected *block.Block, height int) {
+	registry.mux.Lock()
+	defer registry.mux.Unlock()
+
+	if len(registry.webhooks) == 0 && len(registry.watches) == 0 {
+		return
+	}
+
+	hash := connected.Hash()
+	replayed := registry.replayed(hash, height)
+	reconnected := make(map[string]bool)
+	watches := make([]*paymentWatch, 0, len(registry.watches))
+	for _, watch := range registry.watches {
+		switch {
+		case watch.restored && watch.height != height:
+		case watch.restored && watch.blockHash == hash:
+			watch.restored = false
+			reconnected[watch.webhookId+string(watch.transactionId[:])] = true
+		case watch.restored || watch.height >= height:
+			registry.notify(watch, WEBHOOK_EVENT_REVERTED, 0)
+			continue
+		}
+		watches = append(watches, watch)
+	}
+
+	for _, transaction := range connected.Transactions() {
+		transactionId := transaction.Hash()
+		for _, webhook := range registry.webhooks {
+			address, ok := webhook.watches(transaction)
+			if !ok || replayed[webhook.Id] || reconnected[webhook.Id+string(transactionId[:])] {
+				continue
+			}
+			marshal, _ := json.Marshal(transaction)
+			watch := &paymentWatch{
+				webhookId:     webhook.Id,
+				address:       address,
+				transactionId: transactionId,
+				transaction:   marshal,
+				blockHash:     hash,
+				height:        height,
+			}
+			registry.notify(watch, WEBHOOK_EVENT_INCLUDED, 1)
+			watches = append(watches, watch)
+		}
+	}
+	for id := range registry.webhooks {
+		if !replayed[id] {
+			registry.notified[id] = &notifiedBlock{blockHash: hash, height: height}
+		}
+	}
+
+	registry.watches = watches[:0]
+	for _, watch := range watches {
+		if watch.restored {
+			registry.watches = append(registry.watches, watch)
+			continue
+		}
+
+		webhook, ok := registry.webhooks[watch.webhookId]
+		if !ok {
+			continue
+		}
+
+		confirmations := height - watch.height + 1
+		if confirmations >= webhook.Confirmations {
+			registry.notify(watch, WEBHOOK_EVENT_CONFIRMED, confirmations)
+			continue
+		}
+		registry.watches = append(registry.watches, watch)
+	}
+
+	if err := registry.save(); err != nil {
+		log.Printf("ERROR Storing webhooks: %v", err)
+	}
+}
+
+// replayed tells which webhooks were notified of the Block before a
+// restart: their restored notifiedBlock is above its height, or is the
+// Block itself. The chain gets past a notifiedBlock at its height, so
+// another Block there is reported like any new one
+func (registry *WebhookRegistry) replayed(hash [32]byte, height int) map[string]bool {
+	replayed := make(map[string]bool)
+	for id, notified := range registry.notified {
+		if !notified.restored || height > notified.height {
+			continue
+		}
+		if height == notified.height {
+			notified.restored = false
+			if hash != notified.blockHash {
+				continue
+			}
+		}
+		replayed[id] = true
+	}
+
+	return replayed
+}
+
+// notify queues the event of the payment for delivery. It runs while
+// Blockchain is locked, so the event waits out a full queue on a timer
+func (registry *WebhookRegistry) notify(watch *paymentWatch, event string, confirmations int) {
+	webhook, ok := registry.webhooks[watch.webhookId]
+	if !ok {
+		return
+	}
+
+	body, _ := json.Marshal(struct {
+		WebhookId     string          `json:"webhookId"`
+		Event         string          `json:"event"`
+		Address       string          `json:"address"`
+		TransactionId string          `json:"transactionId"`
+		BlockHash     string          `json:"blockHash"`
+		Height        int             `json:"height"`
+		Confirmations int             `json:"confirmations"`
+		Transaction   json.RawMessage `json:"transaction"`
+	}{
+		WebhookId:     webhook.Id,
+		Event:         event,
+		Address:       watch.address,
+		TransactionId: fmt.Sprintf("%x", watch.transactionId),
+		BlockHash:     fmt.Sprintf("%x", watch.blockHash),
+		Height:        watch.height,
+		Confirmations: confirmations,
+		Transaction:   watch.transaction,
+	})
+
+	queued := &delivery{webhookId: webhook.Id, event: event, body: body}
+	registry.deliveries = append(registry.deliveries, queued)
+	registry.enqueue(queued)
+}
+
+// enqueue hands the delivery to deliver, or tries again later
+// when the queue is full
+func (registry *WebhookRegistry) enqueue(delivery *delivery) {
+	select {
+	case registry.queue <- delivery:
+	default:
+		log.Printf("Queue of webhooks is full, retrying %s event of webhook %s later", delivery.event, delivery.webhookId)
+		time.AfterFunc(time.Second*WEBHOOK_RETRY_INTERVAL_SEC, func() { registry.enqueue(delivery) })
+	}
+}
+
+// finish forgets the delivery once it is delivered or given up on
+func (registry *WebhookRegistry) finish(finished *delivery) {
+	registry.mux.Lock()
+	defer registry.mux.Unlock()
+
+	for i, delivery := range registry.deliveries {
+		if delivery == finished {
+			registry.deliveries = append(registry.deliveries[:i], registry.deliveries[i+1:]...)
+			break
+		}
+	}
+	if err := registry.save(); err != nil {
+		log.Printf("ERROR Storing webhooks: %v", err)
+	}
+}
+
+// deliver posts the queued events one after another. Failed deliveries
+// are retried later, waiting twice as long after every attempt
+func (registry *WebhookRegistry) deliver() {
+	for delivery := range registry.queue {
+		registry.mux.Lock()
+		webhook, ok := registry.webhooks[delivery.webhookId]
+		registry.mux.Unlock()
+		if !ok {
+			registry.finish(delivery)
+			continue
+		}
+
+		err := registry.post(webhook, delivery)
+		if err == nil {
+			registry.finish(delivery)
+			continue
+		}
+
+		registry.mux.Lock()
+		delivery.attempt++
+		attempt := delivery.attempt
+		if attempt < MAX_WEBHOOK_ATTEMPTS {
+			if err := registry.save(); err != nil {
+				log.Printf("ERROR Storing webhooks: %v", err)
+			}
+		}
+		registry.mux.Unlock()
+		if attempt >= MAX_WEBHOOK_ATTEMPTS {
+			log.Printf("ERROR Giving up on %s event of webhook %s: %v", delivery.event, webhook.Id, err)
+			registry.finish(delivery)
+			continue
+		}
+
+		retry := delivery
+		delay := registry.retryInterval << (attempt - 1)
+		log.Printf("Retrying %s event of webhook %s in %v: %v", delivery.event, webhook.Id, delay, err)
+		time.AfterFunc(delay, func() { registry.enqueue(retry) })
+	}
+}
+
+func (watch *paymentWatch) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		WebhookId     string          `json:"webhookId"`
+		Address       string          `json:"address"`
+		TransactionId string          `json:"transactionId"`
+		Transaction   json.RawMessage `json:"transaction"`
+		BlockHash     string          `json:"blockHash"`
+		Height        int             `json:"height"`
+	}{
+		WebhookId:     watch.webhookId,
+		Address:       watch.address,
+		TransactionId: fmt.Sprintf("%x", watch.transactionId),
+		Transaction:   watch.transaction,
+		BlockHash:     fmt.Sprintf("%x", watch.blockHash),
+		Height:        watch.height,
+	})
+}
+
+// UnmarshalJSON restores a watch saved by a previous run
+func (watch *paymentWatch) UnmarshalJSON(data []byte) error {
+	var decoded struct {
+		WebhookId     string          `json:"webhookId"`
+		Address       string          `json:"address"`
+		TransactionId string          `json:"transactionId"`
+		Transaction   json.RawMessage `json:"transaction"`
+		BlockHash     string          `json:"blockHash"`
+		Height        int             `json:"height"`
+	}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return err
+	}
+
+	*watch = paymentWatch{
+		webhookId:   decoded.WebhookId,
+		address:     decoded.Address,
+		transaction: decoded.Transaction,
+		height:      decoded.Height,
+		restored:    true,
+	}
+	if err := decodeHash(decoded.TransactionId, &watch.transactionId); err != nil {
+		return fmt.Errorf("transaction ID: %w", err)
+	}
+	if err := decodeHash(decoded.BlockHash, &watch.blockHash); err != nil {
+		return fmt.Errorf("block hash: %w", err)
+	}
+
+	return nil
+}
+
+func (notified *notifiedBlock) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		BlockHash string `json:"blockHash"`
+		Height    int    `json:"height"`
+	}{
+		BlockHash: fmt.Sprintf("%x", notified.blockHash),
+		Height:    notified.height,
+	})
+}
+
+// UnmarshalJSON restores the last Block notified by a previous run
+func (notified *notifiedBlock) UnmarshalJSON(data []byte) error {
+	var decoded struct {
+		BlockHash string `json:"blockHash"`
+		Height    int    `json:"height"`
+	}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return err
+	}
+
+	*notified = notifiedBlock{height: decoded.Height, restored: true}
+	if err := decodeHash(decoded.BlockHash, &notified.blockHash); err != nil {
+		return fmt.Errorf("block hash: %w", err)
+	}
+
+	return nil
+}
+
+func (delivery *delivery) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		WebhookId string          `json:"webhookId"`
+		Event     string          `json:"event"`
+		Body      json.RawMessage `json:"body"`
+		Attempt   int             `json:"attempt"`
+	}{
+		WebhookId: delivery.webhookId,
+		Event:     delivery.event,
+		Body:      delivery.body,
+		Attempt:   delivery.attempt,
+	})
+}
+
+// UnmarshalJSON restores a delivery saved by a previous run
+func (delivery *delivery) UnmarshalJSON(data []byte) error {
+	var decoded struct {
+		WebhookId string          `json:"webhookId"`
+		Event     string          `json:"event"`
+		Body      json.RawMessage `json:"body"`
+		Attempt   int             `json:"attempt"`
+	}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return err
+	}
+
+	delivery.webhookId = decoded.WebhookId
+	delivery.event = decoded.Event
+	delivery.body = decoded.Body
+	delivery.attempt = decoded.Attempt
+
+	return nil
+}
+
+// decodeHash reads the hex of a 32 byte hash into the hash
+func decodeHash(encoded string, hash *[32]byte) error {
+	decoded, err := hex.DecodeString(encoded)
+	if err != nil {
+		return err
+	}
+	if len(decoded) != len(hash) {
+		return fmt.Errorf("%d bytes instead of %d", len(decoded), len(hash))
+	}
+	copy(hash[:], decoded)
+
+	return nil
+}
+
+// post sends the event signed with an HMAC-SHA256 of the body
+// under the secret of the Webhook
+func (registry *WebhookRegistry) post(webhook *Webhook, delivery *delivery) error {
+	req, err := http.NewRequest(http.MethodPost, webhook.Url, bytes.NewReader(delivery.body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(WEBHOOK_ID_HEADER, webhook.Id)
+	req.Header.Set(WEBHOOK_EVENT_HEADER, delivery.event)
+	req.Header.Set(WEBHOOK_SIGNATURE_HEADER, "sha256="+signPayload(webhook.Secret, delivery.body))
+
+	resp, err := registry.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("%s answered %s", webhook.Url, resp.Status)
+	}
+
+	return nil
+}
+
+// signPayload returns the hex HMAC-SHA256 of the body under the secret
+func signPayload(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func randomHex(size int) (string, error) {
+	random := make([]byte, size)
+	if _, err := rand.Read(random); err != nil {
+		return "", block.WrapError(block.ERROR_INTERNAL, err)
+	}
+
+	return hex.EncodeToString(random), nil
+}
+
+// Webhooks registers new webhooks, and shows or removes the one with
+// the id to whoever proves its secret in the Authorization header
+func (server *Server) Webhooks(writer http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet:
+		webhook, err := server.webhooks.Authorize(req.URL.Query().Get("id"), req.Header.Get("Authorization"))
+		if err != nil {
+			writeError(writer, block.ERROR_UNAUTHORIZED, err)
+			return
+		}
+
+		marshal, _ := json.Marshal(struct {
+			Id            string   `json:"id"`
+			Url           string   `json:"url"`
+			Addresses     []string `json:"addresses"`
+			Confirmations int      `json:"confirmations"`
+		}{
+			Id:            webhook.Id,
+			Url:           webhook.Url,
+			Addresses:     webhook.Addresses,
+			Confirmations: webhook.Confirmations,
+		})
+		writer.Header().Add("Content-Type", "application/json")
+		io.WriteString(writer, string(marshal[:]))
+
+	case http.MethodPost:
+		decoder := json.NewDecoder(req.Body)
+		var webhookRequest WebhookRequest
+		if err := decoder.Decode(&webhookRequest); err != nil {
+			writeError(writer, block.ERROR_INVALID_REQUEST, err)
+			return
+		}
+		if !webhookRequest.Validate() {
+			writeErrorMessage(writer, block.ERROR_INVALID_REQUEST, "webhook request needs a url and addresses")
+			return
+		}
+
+		webhook, err := webhookRequest.Webhook()
+		if err != nil {
+			writeError(writer, block.ERROR_INVALID_REQUEST, err)
+			return
+		}
+
+		// The webhook only sees blocks once the Blockchain exists,
+		// the ones after the head
+		head, height := server.GetBlockchain().Head()
+		if err := server.webhooks.Register(webhook, head.Hash(), height); err != nil {
+			writeError(writer, block.ERROR_INTERNAL, err)
+			return
+		}
+
+		// The secret is only ever shown here
+		marshal, _ := json.Marshal(webhook)
+		writer.Header().Add("Content-Type", "application/json")
+		writer.WriteHeader(http.StatusCreated)
+		io.WriteString(writer, string(marshal[:]))
+
+	case http.MethodDelete:
+		webhook, err := server.webhooks.Authorize(req.URL.Query().Get("id"), req.Header.Get("Authorization"))
+		if err != nil {
+			writeError(writer, block.ERROR_UNAUTHORIZED, err)
+			return
+		}
+		if err := server.webhooks.Remove(webhook.Id); err != nil {
+			writeError(writer, block.ERROR_INTERNAL, err)
+			return
+		}
+		writeMessage(writer, "webhook removed")
+
+	default:
+		writeMethodNotAllowed(writer)
+	}
+}
@@ -0,0 +1,265 @@
+package main
+
+import (
+	"crypto-blockchain/block"
+	"crypto-blockchain/wallet"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+const TEST_CLOCK_START = 1700000000
+
+// newRegtestChain starts a Blockchain that needs no proof of work,
+// on a MockClock at TEST_CLOCK_START
+func newRegtestChain() *block.Blockchain {
+	config := block.DefaultChainConfig()
+	config.Engine = block.NewProofOfWorkEngine(0)
+	config.CoinbaseMaturity = 0
+	config.Clock = block.NewMockClock(time.Unix(TEST_CLOCK_START, 0).UnixNano())
+
+	return block.NewBlockChainWithConfig("miner", 0, config)
+}
+
+// newTestRegistry loads a WebhookRegistry from the file and registers
+// the Webhook when it is not there yet
+func newTestRegistry(t *testing.T, path string, webhook *Webhook, blockchain *block.Blockchain) *WebhookRegistry {
+	t.Helper()
+	registry, err := LoadWebhookRegistry(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := registry.webhooks[webhook.Id]; !ok {
+		head, height := blockchain.Head()
+		if err := registry.Register(webhook, head.Hash(), height); err != nil {
+			t.Fatal(err)
+		}
+	}
+	blockchain.OnBlock(registry.connectBlock)
+
+	return registry
+}
+
+// queuedEvents lists the undelivered events of the WebhookRegistry
+// as the event and the height of its payment
+func queuedEvents(t *testing.T, registry *WebhookRegistry) []string {
+	t.Helper()
+	registry.mux.Lock()
+	defer registry.mux.Unlock()
+
+	events := make([]string, 0, len(registry.deliveries))
+	for _, delivery := range registry.deliveries {
+		var body struct {
+			Event  string `json:"event"`
+			Height int    `json:"height"`
+		}
+		if err := json.Unmarshal(delivery.body, &body); err != nil {
+			t.Fatal(err)
+		}
+		events = append(events, fmt.Sprintf("%s@%d", body.Event, body.Height))
+	}
+
+	return events
+}
+
+func TestWebhookRestartDoesNotRenotify(t *testing.T) {
+	address := wallet.NewWallet().Address()
+	before := []string{"included@1", "included@2", "confirmed@1", "included@3", "confirmed@2"}
+
+	cases := []struct {
+		name string
+		// restart connects the blocks of the first run again and mines more
+		restart func(t *testing.T, blockchain *block.Blockchain, mined []*block.Block)
+		want    []string
+	}{
+		{
+			name: "same chain",
+			restart: func(t *testing.T, blockchain *block.Blockchain, mined []*block.Block) {
+				for _, mined := range mined {
+					if err := blockchain.AddBlock(mined, ""); err != nil {
+						t.Fatal(err)
+					}
+				}
+				if _, err := blockchain.Generate(1, address); err != nil {
+					t.Fatal(err)
+				}
+			},
+			want: []string{"included@4", "confirmed@3"},
+		},
+		{
+			name: "another block at the last notified height",
+			restart: func(t *testing.T, blockchain *block.Blockchain, mined []*block.Block) {
+				for _, mined := range mined[:2] {
+					if err := blockchain.AddBlock(mined, ""); err != nil {
+						t.Fatal(err)
+					}
+				}
+				if _, err := blockchain.Generate(1, "elsewhere"); err != nil {
+					t.Fatal(err)
+				}
+				if _, err := blockchain.Generate(1, address); err != nil {
+					t.Fatal(err)
+				}
+			},
+			want: []string{"reverted@3", "included@4"},
+		},
+	}
+
+	for _, test := range cases {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "webhooks.json")
+			webhook := &Webhook{Id: "hook", Url: "http://127.0.0.1:1", Addresses: []string{address}, Confirmations: 2, Secret: "secret"}
+
+			blockchain := newRegtestChain()
+			registry := newTestRegistry(t, path, webhook, blockchain)
+			mined, err := blockchain.Generate(3, address)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if events := queuedEvents(t, registry); !reflect.DeepEqual(events, before) {
+				t.Fatalf("queued %v before the restart, want %v", events, before)
+			}
+
+			// Nothing was delivered, so the events of the first run are restored
+			restarted := newRegtestChain()
+			registry = newTestRegistry(t, path, webhook, restarted)
+			test.restart(t, restarted, mined)
+
+			want := append(append([]string{}, before...), test.want...)
+			if events := queuedEvents(t, registry); !reflect.DeepEqual(events, want) {
+				t.Errorf("queued %v after the restart, want %v", events, want)
+			}
+		})
+	}
+}
+
+func TestWebhookDeliveryRetries(t *testing.T) {
+	cases := []struct {
+		name     string
+		failures int
+		posts    int
+	}{
+		{"delivered at once", 0, 1},
+		{"delivered after failures", 2, 3},
+		{"given up", MAX_WEBHOOK_ATTEMPTS, MAX_WEBHOOK_ATTEMPTS},
+	}
+
+	for _, test := range cases {
+		t.Run(test.name, func(t *testing.T) {
+			webhook := &Webhook{Id: "hook", Addresses: []string{"address"}, Confirmations: 1, Secret: "secret"}
+
+			var mux sync.Mutex
+			posts := 0
+			receiver := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, req *http.Request) {
+				body, _ := io.ReadAll(req.Body)
+				mac := hmac.New(sha256.New, []byte(webhook.Secret))
+				mac.Write(body)
+				if signature := "sha256=" + hex.EncodeToString(mac.Sum(nil)); req.Header.Get(WEBHOOK_SIGNATURE_HEADER) != signature {
+					t.Errorf("signed %s, want %s", req.Header.Get(WEBHOOK_SIGNATURE_HEADER), signature)
+				}
+				if req.Header.Get(WEBHOOK_ID_HEADER) != webhook.Id || req.Header.Get(WEBHOOK_EVENT_HEADER) != WEBHOOK_EVENT_INCLUDED {
+					t.Errorf("headers %v do not name the webhook and the event", req.Header)
+				}
+
+				mux.Lock()
+				posts++
+				failed := posts <= test.failures
+				mux.Unlock()
+				if failed {
+					writer.WriteHeader(http.StatusInternalServerError)
+				}
+			}))
+			defer receiver.Close()
+			webhook.Url = receiver.URL
+
+			path := filepath.Join(t.TempDir(), "webhooks.json")
+			registry, err := LoadWebhookRegistry(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			registry.retryInterval = time.Millisecond
+			if err := registry.Register(webhook, [32]byte{}, 0); err != nil {
+				t.Fatal(err)
+			}
+			go registry.deliver()
+
+			registry.mux.Lock()
+			registry.notify(&paymentWatch{webhookId: webhook.Id, address: "address", height: 1}, WEBHOOK_EVENT_INCLUDED, 1)
+			registry.mux.Unlock()
+
+			for deadline := time.Now().Add(5 * time.Second); len(queuedEvents(t, registry)) > 0; time.Sleep(time.Millisecond) {
+				if time.Now().After(deadline) {
+					t.Fatal("the event was never delivered nor given up on")
+				}
+			}
+
+			mux.Lock()
+			defer mux.Unlock()
+			if posts != test.posts {
+				t.Errorf("posted %d times, want %d", posts, test.posts)
+			}
+			restored, err := LoadWebhookRegistry(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(restored.deliveries) != 0 {
+				t.Errorf("%d deliveries are still stored", len(restored.deliveries))
+			}
+		})
+	}
+}
+
+func TestWebhookAuthorize(t *testing.T) {
+	registry, err := LoadWebhookRegistry(filepath.Join(t.TempDir(), "webhooks.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	webhook := &Webhook{Id: "hook", Url: "http://127.0.0.1:1", Addresses: []string{"address"}, Confirmations: 1, Secret: "secret"}
+	if err := registry.Register(webhook, [32]byte{}, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	mac := hmac.New(sha256.New, []byte(webhook.Secret))
+	mac.Write([]byte(webhook.Id))
+	proof := hex.EncodeToString(mac.Sum(nil))
+
+	cases := []struct {
+		name          string
+		id            string
+		authorization string
+		code          block.ErrorCode
+	}{
+		{"proof of the secret", webhook.Id, WEBHOOK_AUTH_SCHEME + " " + proof, ""},
+		{"proof of another secret", webhook.Id, WEBHOOK_AUTH_SCHEME + " " + signPayload("other", []byte(webhook.Id)), block.ERROR_UNAUTHORIZED},
+		{"secret itself", webhook.Id, WEBHOOK_AUTH_SCHEME + " " + webhook.Secret, block.ERROR_UNAUTHORIZED},
+		{"without the scheme", webhook.Id, proof, block.ERROR_UNAUTHORIZED},
+		{"missing", webhook.Id, "", block.ERROR_UNAUTHORIZED},
+		{"unknown webhook", "other", WEBHOOK_AUTH_SCHEME + " " + proof, block.ERROR_NOT_FOUND},
+	}
+
+	for _, test := range cases {
+		t.Run(test.name, func(t *testing.T) {
+			authorized, err := registry.Authorize(test.id, test.authorization)
+			if test.code == "" {
+				if err != nil || authorized != webhook {
+					t.Errorf("authorized %v with %v, want the webhook", authorized, err)
+				}
+				return
+			}
+			if block.ErrorCodeOf(err) != test.code {
+				t.Errorf("failed with %v, want %s", err, test.code)
+			}
+		})
+	}
+}
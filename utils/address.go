@@ -0,0 +1,120 @@
+package utils
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/btcsuite/btcutil/base58"
+	"golang.org/x/crypto/ripemd160"
+)
+
+// Network holds the version bytes put in front of addresses, so
+// addresses of one network are never valid on another
+type Network struct {
+	name                   string
+	addressVersion         byte
+	multisigAddressVersion byte
+	scriptAddressVersion   byte
+}
+
+const (
+	ADDRESS_VERSION          = 0x00
+	MULTISIG_ADDRESS_VERSION = 0x05
+	SCRIPT_ADDRESS_VERSION   = 0x06
+	MAX_MULTISIG_KEYS        = 16
+
+	REGTEST_ADDRESS_VERSION          = 0x6f
+	REGTEST_MULTISIG_ADDRESS_VERSION = 0xc4
+	REGTEST_SCRIPT_ADDRESS_VERSION   = 0xc5
+)
+
+var (
+	MAIN_NETWORK    = &Network{"main", ADDRESS_VERSION, MULTISIG_ADDRESS_VERSION, SCRIPT_ADDRESS_VERSION}
+	REGTEST_NETWORK = &Network{"regtest", REGTEST_ADDRESS_VERSION, REGTEST_MULTISIG_ADDRESS_VERSION, REGTEST_SCRIPT_ADDRESS_VERSION}
+)
+
+var activeNetwork = MAIN_NETWORK
+
+// UseNetwork makes every address from now on derived with the version
+// bytes of the Network. It is meant to be called once at startup
+func UseNetwork(network *Network) {
+	activeNetwork = network
+}
+
+// ActiveNetwork returns the Network addresses are derived for
+func ActiveNetwork() *Network {
+	return activeNetwork
+}
+
+func (network *Network) Name() string {
+	return network.name
+}
+
+// AddressFromPublicKey derives the blockchain address of a single key
+func AddressFromPublicKey(publicKey Verifier) string {
+	// Perform SHA-256 hashing on the public key
+	sha256Digest := sha256.Sum256(publicKey.Bytes())
+
+	return encodeAddress(activeNetwork.addressVersion, sha256Digest[:])
+}
+
+// MultisigAddress derives the address controlled by threshold-of-N keys.
+// Keys are sorted first, so the same key set and threshold always give
+// the same address no matter in which order the keys are listed
+func MultisigAddress(threshold int, publicKeys []Verifier) (string, error) {
+	if len(publicKeys) == 0 || len(publicKeys) > MAX_MULTISIG_KEYS {
+		return "", fmt.Errorf("multisig needs between 1 and %d keys", MAX_MULTISIG_KEYS)
+	}
+	if threshold < 1 || threshold > len(publicKeys) {
+		return "", fmt.Errorf("threshold %d is out of range for %d keys", threshold, len(publicKeys))
+	}
+
+	keys := make([]string, 0, len(publicKeys))
+	for _, publicKey := range publicKeys {
+		keys = append(keys, fmt.Sprintf("%s:%s", publicKey.KeyType(), publicKey))
+	}
+	sort.Strings(keys)
+
+	for i := 1; i < len(keys); i++ {
+		if keys[i] == keys[i-1] {
+			return "", errors.New("multisig keys must be unique")
+		}
+	}
+
+	// Perform SHA-256 hashing on the threshold followed by the sorted keys
+	sha256Hash := sha256.New()
+	fmt.Fprintf(sha256Hash, "%d", threshold)
+	for _, key := range keys {
+		fmt.Fprintf(sha256Hash, "|%s", key)
+	}
+
+	return encodeAddress(activeNetwork.multisigAddressVersion, sha256Hash.Sum(nil)), nil
+}
+
+// ScriptAddress derives the address of outputs locked by a script
+func ScriptAddress(script []byte) string {
+	// Perform SHA-256 hashing on the serialized script
+	sha256Digest := sha256.Sum256(script)
+
+	return encodeAddress(activeNetwork.scriptAddressVersion, sha256Digest[:])
+}
+
+// encodeAddress turns a SHA-256 digest into a base58check address
+func encodeAddress(version byte, sha256Digest []byte) string {
+	// Perform RIPEMD-160 hashing on the result of sha256Hash
+	ripemd160Hash := ripemd160.New()
+	ripemd160Hash.Write(sha256Digest)
+	ripemd160Digest := ripemd160Hash.Sum(nil)
+
+	// Add version byte in front of ripemd160Hash (0x00 for Main Network,
+	// 0x6f for regtest)
+	versioned := make([]byte, 21)
+	versioned[0] = version
+	copy(versioned[1:], ripemd160Digest[:])
+
+	// Add the first 4 bytes of the double SHA-256 hash as a checksum
+	// at the end and convert the result from a byte string into base58
+	return base58.Encode(append(versioned, checksum(versioned)...))
+}
@@ -19,6 +19,15 @@ func (signature *Signature) String() string {
 	return fmt.Sprintf("%064x%064x", signature.R, signature.S)
 }
 
+// Bytes returns r and s as 32 zero-padded bytes each
+func (signature *Signature) Bytes() []byte {
+	bytes := make([]byte, 64)
+	signature.R.FillBytes(bytes[:32])
+	signature.S.FillBytes(bytes[32:])
+
+	return bytes
+}
+
 func StringToBigIntTuple(str string) (big.Int, big.Int) {
 	bytesX, _ := hex.DecodeString(str[:64])
 	bytesY, _ := hex.DecodeString(str[64:])
@@ -35,7 +44,7 @@ func StringToBigIntTuple(str string) (big.Int, big.Int) {
 func PublicKeyFromString(str string) *ecdsa.PublicKey {
 	x, y := StringToBigIntTuple(str)
 
-	return &ecdsa.PublicKey{elliptic.P256(), &x, &y}
+	return &ecdsa.PublicKey{Curve: elliptic.P256(), X: &x, Y: &y}
 }
 
 func PrivateKeyFromString(str string, publicKey *ecdsa.PublicKey) *ecdsa.PrivateKey {
@@ -44,7 +53,7 @@ func PrivateKeyFromString(str string, publicKey *ecdsa.PublicKey) *ecdsa.Private
 	var bi big.Int
 	_ = bi.SetBytes(bytes)
 
-	return &ecdsa.PrivateKey{*publicKey, &bi}
+	return &ecdsa.PrivateKey{PublicKey: *publicKey, D: &bi}
 }
 
 func SignatureFromString(str string) *Signature {
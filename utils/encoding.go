@@ -0,0 +1,212 @@
+package utils
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/btcsuite/btcutil/base58"
+)
+
+const (
+	PEM_PRIVATE_KEY_TYPE = "PRIVATE KEY"
+	PEM_PUBLIC_KEY_TYPE  = "PUBLIC KEY"
+	WIF_VERSION          = 0x80
+	WIF_COMPRESSED_FLAG  = 0x01
+)
+
+// PrivateKeyToDER encodes the private key as PKCS#8 DER
+func PrivateKeyToDER(privateKey *ecdsa.PrivateKey) ([]byte, error) {
+	if privateKey == nil {
+		return nil, errors.New("no ECDSA private key")
+	}
+
+	return x509.MarshalPKCS8PrivateKey(privateKey)
+}
+
+// PrivateKeyFromDER decodes a PKCS#8 DER encoded ECDSA private key
+func PrivateKeyFromDER(der []byte) (*ecdsa.PrivateKey, error) {
+	key, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, err
+	}
+
+	privateKey, ok := key.(*ecdsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("not an ECDSA private key")
+	}
+
+	return privateKey, nil
+}
+
+// PublicKeyToDER encodes the public key as PKIX DER
+func PublicKeyToDER(publicKey *ecdsa.PublicKey) ([]byte, error) {
+	if publicKey == nil {
+		return nil, errors.New("no ECDSA public key")
+	}
+
+	return x509.MarshalPKIXPublicKey(publicKey)
+}
+
+// PublicKeyFromDER decodes a PKIX DER encoded ECDSA public key
+func PublicKeyFromDER(der []byte) (*ecdsa.PublicKey, error) {
+	key, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return nil, err
+	}
+
+	publicKey, ok := key.(*ecdsa.PublicKey)
+	if !ok {
+		return nil, errors.New("not an ECDSA public key")
+	}
+
+	return publicKey, nil
+}
+
+// PrivateKeyToPEM encodes the private key as a PKCS#8 PEM block
+func PrivateKeyToPEM(privateKey *ecdsa.PrivateKey) (string, error) {
+	der, err := PrivateKeyToDER(privateKey)
+	if err != nil {
+		return "", err
+	}
+
+	return string(pem.EncodeToMemory(&pem.Block{Type: PEM_PRIVATE_KEY_TYPE, Bytes: der})), nil
+}
+
+// PrivateKeyFromPEM decodes a PKCS#8 PEM block into an ECDSA private key
+func PrivateKeyFromPEM(str string) (*ecdsa.PrivateKey, error) {
+	block, _ := pem.Decode([]byte(str))
+	if block == nil || block.Type != PEM_PRIVATE_KEY_TYPE {
+		return nil, errors.New("no private key PEM block found")
+	}
+
+	return PrivateKeyFromDER(block.Bytes)
+}
+
+// PublicKeyToPEM encodes the public key as a PKIX PEM block
+func PublicKeyToPEM(publicKey *ecdsa.PublicKey) (string, error) {
+	der, err := PublicKeyToDER(publicKey)
+	if err != nil {
+		return "", err
+	}
+
+	return string(pem.EncodeToMemory(&pem.Block{Type: PEM_PUBLIC_KEY_TYPE, Bytes: der})), nil
+}
+
+// PublicKeyFromPEM decodes a PKIX PEM block into an ECDSA public key
+func PublicKeyFromPEM(str string) (*ecdsa.PublicKey, error) {
+	block, _ := pem.Decode([]byte(str))
+	if block == nil || block.Type != PEM_PUBLIC_KEY_TYPE {
+		return nil, errors.New("no public key PEM block found")
+	}
+
+	return PublicKeyFromDER(block.Bytes)
+}
+
+// SignerToPEM encodes the private key of the Signer as a PKCS#8 PEM
+// block. x509 knows P-256 and Ed25519 keys, but not secp256k1 ones
+func SignerToPEM(signer Signer) (string, error) {
+	switch signer := signer.(type) {
+	case *ECDSASigner:
+		return PrivateKeyToPEM(signer.privateKey)
+	case *Ed25519Signer:
+		der, err := x509.MarshalPKCS8PrivateKey(signer.privateKey)
+		if err != nil {
+			return "", err
+		}
+
+		return string(pem.EncodeToMemory(&pem.Block{Type: PEM_PRIVATE_KEY_TYPE, Bytes: der})), nil
+	default:
+		return "", fmt.Errorf("%s keys have no PEM encoding", signer.KeyType())
+	}
+}
+
+// VerifierToPEM encodes the public key of the Verifier as a PKIX PEM block
+func VerifierToPEM(verifier Verifier) (string, error) {
+	switch verifier := verifier.(type) {
+	case *ECDSAVerifier:
+		return PublicKeyToPEM(verifier.publicKey)
+	case *Ed25519Verifier:
+		der, err := x509.MarshalPKIXPublicKey(ed25519.PublicKey(verifier.publicKey))
+		if err != nil {
+			return "", err
+		}
+
+		return string(pem.EncodeToMemory(&pem.Block{Type: PEM_PUBLIC_KEY_TYPE, Bytes: der})), nil
+	default:
+		return "", fmt.Errorf("%s keys have no PEM encoding", verifier.KeyType())
+	}
+}
+
+// CompressPublicKey returns the 33-byte SEC1 compressed form of the public key
+func CompressPublicKey(publicKey *ecdsa.PublicKey) []byte {
+	return elliptic.MarshalCompressed(publicKey.Curve, publicKey.X, publicKey.Y)
+}
+
+// DecompressPublicKey restores a P-256 public key from its SEC1 compressed form
+func DecompressPublicKey(compressed []byte) (*ecdsa.PublicKey, error) {
+	curve := elliptic.P256()
+
+	x, y := elliptic.UnmarshalCompressed(curve, compressed)
+	if x == nil {
+		return nil, errors.New("invalid compressed public key")
+	}
+
+	return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+}
+
+// PrivateKeyToWIF encodes the private key in Wallet Import Format:
+// version byte, 32-byte scalar, compression flag and a 4-byte
+// double SHA-256 checksum, all converted into base58
+func PrivateKeyToWIF(privateKey *ecdsa.PrivateKey) string {
+	payload := make([]byte, 34)
+	payload[0] = WIF_VERSION
+	privateKey.D.FillBytes(payload[1:33])
+	payload[33] = WIF_COMPRESSED_FLAG
+
+	return base58.Encode(append(payload, checksum(payload)...))
+}
+
+// PrivateKeyFromWIF decodes a Wallet Import Format string and
+// derives the matching P-256 public key
+func PrivateKeyFromWIF(str string) (*ecdsa.PrivateKey, error) {
+	decoded := base58.Decode(str)
+	if len(decoded) != 38 {
+		return nil, fmt.Errorf("invalid WIF length %d", len(decoded))
+	}
+
+	payload := decoded[:34]
+	if !bytes.Equal(checksum(payload), decoded[34:]) {
+		return nil, errors.New("invalid WIF checksum")
+	}
+	if payload[0] != WIF_VERSION || payload[33] != WIF_COMPRESSED_FLAG {
+		return nil, errors.New("unsupported WIF version")
+	}
+
+	curve := elliptic.P256()
+	d := new(big.Int).SetBytes(payload[1:33])
+	if d.Sign() == 0 || d.Cmp(curve.Params().N) >= 0 {
+		return nil, errors.New("private key out of range")
+	}
+
+	privateKey := &ecdsa.PrivateKey{D: d}
+	privateKey.PublicKey.Curve = curve
+	privateKey.PublicKey.X, privateKey.PublicKey.Y = curve.ScalarBaseMult(payload[1:33])
+
+	return privateKey, nil
+}
+
+// checksum returns the first 4 bytes of a double SHA-256 hash
+func checksum(payload []byte) []byte {
+	first := sha256.Sum256(payload)
+	second := sha256.Sum256(first[:])
+
+	return second[:4]
+}
@@ -0,0 +1,243 @@
+package utils
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/btcsuite/btcutil/base58"
+)
+
+// LEADING_ZEROS_KEY has a scalar and an X coordinate that both start
+// with a zero byte, which are dropped when they are printed with %x
+const LEADING_ZEROS_KEY = "00a6c2b9f3b9e822dfe8150f9e4d1380bc225bc82ed9900f207cc71674274f3a"
+
+type privateKeyEncoding struct {
+	name   string
+	encode func(privateKey *ecdsa.PrivateKey) (string, error)
+	decode func(str string) (*ecdsa.PrivateKey, error)
+}
+
+type publicKeyEncoding struct {
+	name   string
+	size   int
+	encode func(publicKey *ecdsa.PublicKey) (string, error)
+	decode func(str string) (*ecdsa.PublicKey, error)
+}
+
+var privateKeyEncodings = []privateKeyEncoding{
+	{
+		name:   "PEM",
+		encode: PrivateKeyToPEM,
+		decode: PrivateKeyFromPEM,
+	},
+	{
+		name: "DER",
+		encode: func(privateKey *ecdsa.PrivateKey) (string, error) {
+			der, err := PrivateKeyToDER(privateKey)
+			return hex.EncodeToString(der), err
+		},
+		decode: func(str string) (*ecdsa.PrivateKey, error) {
+			der, err := hex.DecodeString(str)
+			if err != nil {
+				return nil, err
+			}
+			return PrivateKeyFromDER(der)
+		},
+	},
+	{
+		name: "WIF",
+		encode: func(privateKey *ecdsa.PrivateKey) (string, error) {
+			return PrivateKeyToWIF(privateKey), nil
+		},
+		decode: PrivateKeyFromWIF,
+	},
+	{
+		name: "PrivateKeyStr",
+		encode: func(privateKey *ecdsa.PrivateKey) (string, error) {
+			signer, err := NewECDSASigner(privateKey)
+			if err != nil {
+				return "", err
+			}
+			return signer.String(), nil
+		},
+		decode: func(str string) (*ecdsa.PrivateKey, error) {
+			signer, err := SignerFromString(KEY_TYPE_P256, str)
+			if err != nil {
+				return nil, err
+			}
+			return signer.(*ECDSASigner).PrivateKey(), nil
+		},
+	},
+}
+
+var publicKeyEncodings = []publicKeyEncoding{
+	{
+		name:   "PEM",
+		encode: PublicKeyToPEM,
+		decode: PublicKeyFromPEM,
+	},
+	{
+		name: "DER",
+		encode: func(publicKey *ecdsa.PublicKey) (string, error) {
+			der, err := PublicKeyToDER(publicKey)
+			return hex.EncodeToString(der), err
+		},
+		decode: func(str string) (*ecdsa.PublicKey, error) {
+			der, err := hex.DecodeString(str)
+			if err != nil {
+				return nil, err
+			}
+			return PublicKeyFromDER(der)
+		},
+	},
+	{
+		name: "SEC1 compressed",
+		size: 33,
+		encode: func(publicKey *ecdsa.PublicKey) (string, error) {
+			return hex.EncodeToString(CompressPublicKey(publicKey)), nil
+		},
+		decode: func(str string) (*ecdsa.PublicKey, error) {
+			compressed, err := hex.DecodeString(str)
+			if err != nil {
+				return nil, err
+			}
+			return DecompressPublicKey(compressed)
+		},
+	},
+	{
+		// X and Y zero-padded, the SEC1 uncompressed form without its 0x04 tag
+		name: "uncompressed",
+		size: 64,
+		encode: func(publicKey *ecdsa.PublicKey) (string, error) {
+			return (&ECDSAVerifier{KEY_TYPE_P256, publicKey}).String(), nil
+		},
+		decode: func(str string) (*ecdsa.PublicKey, error) {
+			verifier, err := VerifierFromString(KEY_TYPE_P256, str)
+			if err != nil {
+				return nil, err
+			}
+			return verifier.(*ECDSAVerifier).PublicKey(), nil
+		},
+	},
+}
+
+func testKeys(t *testing.T) map[string]*ecdsa.PrivateKey {
+	signer, err := SignerFromString(KEY_TYPE_P256, LEADING_ZEROS_KEY)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leadingZeros := signer.(*ECDSASigner).PrivateKey()
+	if len(leadingZeros.D.Bytes()) == 32 || len(leadingZeros.X.Bytes()) == 32 {
+		t.Fatal("scalar and X of LEADING_ZEROS_KEY must start with a zero byte")
+	}
+
+	generated, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return map[string]*ecdsa.PrivateKey{
+		"leading zeros": leadingZeros,
+		"generated":     generated,
+	}
+}
+
+func TestPrivateKeyEncodingsRoundTrip(t *testing.T) {
+	for keyName, privateKey := range testKeys(t) {
+		for _, encoding := range privateKeyEncodings {
+			t.Run(keyName+"/"+encoding.name, func(t *testing.T) {
+				encoded, err := encoding.encode(privateKey)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				decoded, err := encoding.decode(encoded)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if decoded.D.Cmp(privateKey.D) != 0 {
+					t.Errorf("decoded scalar %x, want %x", decoded.D, privateKey.D)
+				}
+				if decoded.X.Cmp(privateKey.X) != 0 || decoded.Y.Cmp(privateKey.Y) != 0 {
+					t.Error("decoded key has another public key")
+				}
+
+				reencoded, err := encoding.encode(decoded)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if reencoded != encoded {
+					t.Errorf("encoded again as %s, want %s", reencoded, encoded)
+				}
+			})
+		}
+	}
+}
+
+func TestPublicKeyEncodingsRoundTrip(t *testing.T) {
+	for keyName, privateKey := range testKeys(t) {
+		for _, encoding := range publicKeyEncodings {
+			t.Run(keyName+"/"+encoding.name, func(t *testing.T) {
+				encoded, err := encoding.encode(&privateKey.PublicKey)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if encoding.size != 0 && len(encoded) != encoding.size*2 {
+					t.Errorf("encoded in %d bytes, want %d", len(encoded)/2, encoding.size)
+				}
+
+				decoded, err := encoding.decode(encoded)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if decoded.X.Cmp(privateKey.X) != 0 || decoded.Y.Cmp(privateKey.Y) != 0 {
+					t.Errorf("decoded (%x, %x), want (%x, %x)", decoded.X, decoded.Y, privateKey.X, privateKey.Y)
+				}
+
+				reencoded, err := encoding.encode(decoded)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if reencoded != encoded {
+					t.Errorf("encoded again as %s, want %s", reencoded, encoded)
+				}
+			})
+		}
+	}
+}
+
+func TestPrivateKeyFromStringKeepsLeadingZeros(t *testing.T) {
+	signer, err := SignerFromString(KEY_TYPE_P256, LEADING_ZEROS_KEY)
+	if err != nil {
+		t.Fatal(err)
+	}
+	privateKey := signer.(*ECDSASigner).PrivateKey()
+
+	if signer.String() != LEADING_ZEROS_KEY {
+		t.Fatalf("PrivateKeyStr %s, want %s", signer.String(), LEADING_ZEROS_KEY)
+	}
+	restored := PrivateKeyFromString(signer.String(), &privateKey.PublicKey)
+	if restored.D.Cmp(privateKey.D) != 0 {
+		t.Errorf("restored scalar %x, want %x", restored.D, privateKey.D)
+	}
+	if publicKey := signer.Verifier().String(); !strings.HasPrefix(publicKey, "00") || len(publicKey) != 128 {
+		t.Errorf("PublicKeyStr %s is not zero-padded", publicKey)
+	}
+}
+
+func TestPrivateKeyFromWIFRejectsCorruption(t *testing.T) {
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decoded := base58.Decode(PrivateKeyToWIF(privateKey))
+	decoded[10] ^= 0x01
+	if _, err := PrivateKeyFromWIF(base58.Encode(decoded)); err == nil {
+		t.Error("WIF with a flipped bit was accepted")
+	}
+}
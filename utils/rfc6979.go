@@ -0,0 +1,135 @@
+package utils
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/sha256"
+	"errors"
+	"math/big"
+)
+
+// SignDeterministic signs the hash with a nonce derived from the private key
+// and the hash itself (RFC 6979, HMAC-SHA256), so the same input always
+// produces the same signature. s is normalised to the lower half of the
+// curve order, which is the only form IsLowS accepts
+func SignDeterministic(privateKey *ecdsa.PrivateKey, hash []byte) (*Signature, error) {
+	curve := privateKey.Curve
+	n := curve.Params().N
+	e := hashToInt(hash, curve)
+
+	nextNonce := nonceGenerator(curve, privateKey.D, hash)
+	for i := 0; i < 64; i++ {
+		k := nextNonce()
+
+		x, _ := curve.ScalarBaseMult(int2octets(k, n))
+		r := new(big.Int).Mod(x, n)
+		if r.Sign() == 0 {
+			continue
+		}
+
+		// s = k^-1 * (e + r * d) mod n
+		s := new(big.Int).Mul(r, privateKey.D)
+		s.Add(s, e)
+		s.Mul(s, new(big.Int).ModInverse(k, n))
+		s.Mod(s, n)
+		if s.Sign() == 0 {
+			continue
+		}
+
+		if !IsLowS(curve, s) {
+			s.Sub(n, s)
+		}
+
+		return &Signature{R: r, S: s}, nil
+	}
+
+	return nil, errors.New("failed to find a valid deterministic nonce")
+}
+
+// IsLowS checks that s is not greater than half of the curve order,
+// ruling out the malleable (r, n-s) twin of every signature
+func IsLowS(curve elliptic.Curve, s *big.Int) bool {
+	halfOrder := new(big.Int).Rsh(curve.Params().N, 1)
+
+	return s.Cmp(halfOrder) <= 0
+}
+
+// nonceGenerator implements the HMAC-DRBG of RFC 6979 section 3.2,
+// every call returns the next candidate k in the range [1, n-1]
+func nonceGenerator(curve elliptic.Curve, d *big.Int, hash []byte) func() *big.Int {
+	n := curve.Params().N
+	rolen := (n.BitLen() + 7) / 8
+
+	x := int2octets(d, n)
+	h := int2octets(new(big.Int).Mod(hashToInt(hash, curve), n), n)
+
+	v := make([]byte, sha256.Size)
+	for i := range v {
+		v[i] = 0x01
+	}
+	k := make([]byte, sha256.Size)
+
+	mac := func(key []byte, data ...[]byte) []byte {
+		hm := hmac.New(sha256.New, key)
+		for _, chunk := range data {
+			hm.Write(chunk)
+		}
+		return hm.Sum(nil)
+	}
+
+	k = mac(k, v, []byte{0x00}, x, h)
+	v = mac(k, v)
+	k = mac(k, v, []byte{0x01}, x, h)
+	v = mac(k, v)
+
+	first := true
+	return func() *big.Int {
+		if !first {
+			k = mac(k, v, []byte{0x00})
+			v = mac(k, v)
+		}
+		first = false
+
+		for {
+			t := make([]byte, 0, rolen)
+			for len(t) < rolen {
+				v = mac(k, v)
+				t = append(t, v...)
+			}
+
+			nonce := bitsToInt(t, n.BitLen())
+			if nonce.Sign() > 0 && nonce.Cmp(n) < 0 {
+				return nonce
+			}
+
+			k = mac(k, v, []byte{0x00})
+			v = mac(k, v)
+		}
+	}
+}
+
+// hashToInt converts a hash into an integer the same way crypto/ecdsa does
+func hashToInt(hash []byte, curve elliptic.Curve) *big.Int {
+	return bitsToInt(hash, curve.Params().N.BitLen())
+}
+
+// bitsToInt keeps the leftmost qlen bits of b as an integer
+func bitsToInt(b []byte, qlen int) *big.Int {
+	orderBytes := (qlen + 7) / 8
+	if len(b) > orderBytes {
+		b = b[:orderBytes]
+	}
+
+	result := new(big.Int).SetBytes(b)
+	if excess := len(b)*8 - qlen; excess > 0 {
+		result.Rsh(result, uint(excess))
+	}
+
+	return result
+}
+
+// int2octets encodes x as a big-endian byte string of the curve order length
+func int2octets(x *big.Int, n *big.Int) []byte {
+	return x.FillBytes(make([]byte, (n.BitLen()+7)/8))
+}
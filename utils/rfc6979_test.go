@@ -0,0 +1,166 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"math/big"
+	"testing"
+)
+
+type rfc6979Vector struct {
+	name       string
+	keyType    KeyType
+	privateKey string
+	message    string
+	k          string
+	r          string
+	// s is as published, before it is normalised to low-S
+	s string
+}
+
+var rfc6979Vectors = []rfc6979Vector{
+	// RFC 6979 A.2.5, P-256 with SHA-256
+	{
+		name:       "P-256 sample",
+		keyType:    KEY_TYPE_P256,
+		privateKey: "c9afa9d845ba75166b5c215767b1d6934e50c3db36e89b127b8a622b120f6721",
+		message:    "sample",
+		k:          "a6e3c57dd01abe90086538398355dd4c3b17aa873382b0f24d6129493d8aad60",
+		r:          "efd48b2aacb6a8fd1140dd9cd45e81d69d2c877b56aaf991c34d0ea84eaf3716",
+		s:          "f7cb1c942d657c41d436c7a1b6e29f65f3e900dbb9aff4064dc4ab2f843acda8",
+	},
+	{
+		name:       "P-256 test",
+		keyType:    KEY_TYPE_P256,
+		privateKey: "c9afa9d845ba75166b5c215767b1d6934e50c3db36e89b127b8a622b120f6721",
+		message:    "test",
+		k:          "d16b6ae827f17175e040871a1c7ec3500192c4c92677336ec2537acaee0008e0",
+		r:          "f1abb023518351cd71d881567b1ea663ed3efcf6c5132b354f28d3b0b7d38367",
+		s:          "019f4113742a2b14bd25926b49c649155f267e60d3814b4c0cc84250e46f0083",
+	},
+	// secp256k1 with SHA-256, as used by Bitcoin wallets
+	{
+		name:       "secp256k1 Satoshi Nakamoto",
+		keyType:    KEY_TYPE_SECP256K1,
+		privateKey: "0000000000000000000000000000000000000000000000000000000000000001",
+		message:    "Satoshi Nakamoto",
+		k:          "8f8a276c19f4149656b280621e358cce24f5f52542772691ee69063b74f15d15",
+		r:          "934b1ea10a4b3c1757e2b0c017d0b6143ce3c9a7e6a4a49860d7a6ab210ee3d8",
+		s:          "2442ce9d2b916064108014783e923ec36b49743e2ffa1c4496f01a512aafd9e5",
+	},
+	{
+		name:       "secp256k1 tears in rain",
+		keyType:    KEY_TYPE_SECP256K1,
+		privateKey: "0000000000000000000000000000000000000000000000000000000000000001",
+		message:    "All those moments will be lost in time, like tears in rain. Time to die...",
+		k:          "38aa22d72376b4dbc472e06c3ba403ee0a394da63fc58d88686c611aba98d6b3",
+		r:          "8600dbd41e348fe5c9465ab92d23e3db8b98b873beecd930736488696438cb6b",
+		s:          "547fe64427496db33bf66019dacbf0039c04199abb0122918601db38a72cfc21",
+	},
+}
+
+// hexInt decodes a big-endian hex integer of a test vector
+func hexInt(t *testing.T, str string) *big.Int {
+	t.Helper()
+	x, ok := new(big.Int).SetString(str, 16)
+	if !ok {
+		t.Fatalf("invalid hex integer %s", str)
+	}
+
+	return x
+}
+
+func TestSignDeterministicVectors(t *testing.T) {
+	for _, test := range rfc6979Vectors {
+		t.Run(test.name, func(t *testing.T) {
+			signer, err := SignerFromString(test.keyType, test.privateKey)
+			if err != nil {
+				t.Fatal(err)
+			}
+			privateKey := signer.(*ECDSASigner).PrivateKey()
+			n := privateKey.Curve.Params().N
+			hash := sha256.Sum256([]byte(test.message))
+
+			if k := nonceGenerator(privateKey.Curve, privateKey.D, hash[:])(); k.Cmp(hexInt(t, test.k)) != 0 {
+				t.Errorf("nonce %x, want %s", k, test.k)
+			}
+
+			want := hexInt(t, test.s)
+			if !IsLowS(privateKey.Curve, want) {
+				want.Sub(n, want)
+			}
+			signature, err := SignDeterministic(privateKey, hash[:])
+			if err != nil {
+				t.Fatal(err)
+			}
+			if signature.R.Cmp(hexInt(t, test.r)) != 0 || signature.S.Cmp(want) != 0 {
+				t.Errorf("signature (%x, %x), want (%s, %x)", signature.R, signature.S, test.r, want)
+			}
+			if !signer.Verifier().Verify(hash[:], signature.Bytes()) {
+				t.Error("the signature does not verify")
+			}
+		})
+	}
+}
+
+func TestVerifyRejectsHighS(t *testing.T) {
+	for _, keyType := range []KeyType{KEY_TYPE_P256, KEY_TYPE_SECP256K1} {
+		t.Run(string(keyType), func(t *testing.T) {
+			signer, err := GenerateSigner(keyType)
+			if err != nil {
+				t.Fatal(err)
+			}
+			hash := sha256.Sum256([]byte("message"))
+			signature, err := SignDeterministic(signer.(*ECDSASigner).PrivateKey(), hash[:])
+			if err != nil {
+				t.Fatal(err)
+			}
+			n := signer.(*ECDSASigner).PrivateKey().Curve.Params().N
+			twin := &Signature{R: signature.R, S: new(big.Int).Sub(n, signature.S)}
+
+			cases := []struct {
+				name      string
+				signature *Signature
+				valid     bool
+			}{
+				{"low S", signature, true},
+				{"high S twin", twin, false},
+			}
+
+			for _, test := range cases {
+				if valid := signer.Verifier().Verify(hash[:], test.signature.Bytes()); valid != test.valid {
+					t.Errorf("%s verified %t, want %t", test.name, valid, test.valid)
+				}
+			}
+		})
+	}
+}
+
+func TestSignReturnsLowS(t *testing.T) {
+	for _, keyType := range []KeyType{KEY_TYPE_P256, KEY_TYPE_SECP256K1} {
+		t.Run(string(keyType), func(t *testing.T) {
+			signer, err := GenerateSigner(keyType)
+			if err != nil {
+				t.Fatal(err)
+			}
+			curve := signer.(*ECDSASigner).PrivateKey().Curve
+
+			for i := 0; i < 200; i++ {
+				hash := make([]byte, sha256.Size)
+				if _, err := rand.Read(hash); err != nil {
+					t.Fatal(err)
+				}
+				signature, err := signer.Sign(hash)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if s := new(big.Int).SetBytes(signature[32:]); !IsLowS(curve, s) {
+					t.Fatalf("signed %x with high S %x", hash, s)
+				}
+				if !signer.Verifier().Verify(hash, signature) {
+					t.Fatalf("signature of %x does not verify", hash)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,290 @@
+package utils
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+)
+
+// KeyType identifies the signature scheme a key belongs to.
+// It travels next to the public key in transactions, so the chain
+// knows how to verify wallets of different kinds
+type KeyType string
+
+const (
+	KEY_TYPE_P256      KeyType = "p256"
+	KEY_TYPE_SECP256K1 KeyType = "secp256k1"
+	KEY_TYPE_ED25519   KeyType = "ed25519"
+	DEFAULT_KEY_TYPE           = KEY_TYPE_P256
+)
+
+// Verifier checks signatures made with the matching Signer
+type Verifier interface {
+	KeyType() KeyType
+	// Bytes returns the raw public key, used for address derivation
+	Bytes() []byte
+	// String returns the public key in hex
+	String() string
+	Verify(hash []byte, signature []byte) bool
+}
+
+// Signer signs transaction hashes with a private key
+type Signer interface {
+	KeyType() KeyType
+	Verifier() Verifier
+	// String returns the private key in hex
+	String() string
+	Sign(hash []byte) ([]byte, error)
+}
+
+// ParseKeyType converts a string into a supported KeyType,
+// an empty string stands for the DEFAULT_KEY_TYPE
+func ParseKeyType(str string) (KeyType, error) {
+	switch keyType := KeyType(str); keyType {
+	case "":
+		return DEFAULT_KEY_TYPE, nil
+	case KEY_TYPE_P256, KEY_TYPE_SECP256K1, KEY_TYPE_ED25519:
+		return keyType, nil
+	default:
+		return "", fmt.Errorf("unsupported key type %q", str)
+	}
+}
+
+// GenerateSigner creates a new random key of the given type
+func GenerateSigner(keyType KeyType) (Signer, error) {
+	if keyType == KEY_TYPE_ED25519 {
+		_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+
+		return &Ed25519Signer{privateKey}, nil
+	}
+
+	curve, err := curveOf(keyType)
+	if err != nil {
+		return nil, err
+	}
+
+	privateKey, err := ecdsa.GenerateKey(curve, rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ECDSASigner{keyType, privateKey}, nil
+}
+
+// SignerFromString decodes a hex private key of the given type
+func SignerFromString(keyType KeyType, str string) (Signer, error) {
+	bytes, err := hex.DecodeString(str)
+	if err != nil {
+		return nil, err
+	}
+	if len(bytes) != 32 {
+		return nil, fmt.Errorf("invalid %s private key length %d", keyType, len(bytes))
+	}
+
+	if keyType == KEY_TYPE_ED25519 {
+		return &Ed25519Signer{ed25519.NewKeyFromSeed(bytes)}, nil
+	}
+
+	curve, err := curveOf(keyType)
+	if err != nil {
+		return nil, err
+	}
+
+	d := new(big.Int).SetBytes(bytes)
+	if d.Sign() == 0 || d.Cmp(curve.Params().N) >= 0 {
+		return nil, fmt.Errorf("%s private key out of range", keyType)
+	}
+
+	privateKey := &ecdsa.PrivateKey{D: d}
+	privateKey.PublicKey.Curve = curve
+	privateKey.PublicKey.X, privateKey.PublicKey.Y = curve.ScalarBaseMult(bytes)
+
+	return &ECDSASigner{keyType, privateKey}, nil
+}
+
+// VerifierFromString decodes a hex public key of the given type
+func VerifierFromString(keyType KeyType, str string) (Verifier, error) {
+	bytes, err := hex.DecodeString(str)
+	if err != nil {
+		return nil, err
+	}
+
+	return VerifierFromBytes(keyType, bytes)
+}
+
+// VerifierFromBytes decodes a raw public key of the given type
+func VerifierFromBytes(keyType KeyType, bytes []byte) (Verifier, error) {
+	if keyType == KEY_TYPE_ED25519 {
+		if len(bytes) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("invalid ed25519 public key length %d", len(bytes))
+		}
+
+		return &Ed25519Verifier{ed25519.PublicKey(bytes)}, nil
+	}
+
+	curve, err := curveOf(keyType)
+	if err != nil {
+		return nil, err
+	}
+	if len(bytes) != 64 {
+		return nil, fmt.Errorf("invalid %s public key length %d", keyType, len(bytes))
+	}
+
+	x := new(big.Int).SetBytes(bytes[:32])
+	y := new(big.Int).SetBytes(bytes[32:])
+	if !curve.IsOnCurve(x, y) {
+		return nil, fmt.Errorf("%s public key is not on the curve", keyType)
+	}
+
+	return &ECDSAVerifier{keyType, &ecdsa.PublicKey{Curve: curve, X: x, Y: y}}, nil
+}
+
+// NewECDSASigner wraps an existing ECDSA private key, its KeyType
+// is taken from the curve
+func NewECDSASigner(privateKey *ecdsa.PrivateKey) (*ECDSASigner, error) {
+	switch privateKey.Curve {
+	case elliptic.P256():
+		return &ECDSASigner{KEY_TYPE_P256, privateKey}, nil
+	case secp256k1.S256():
+		return &ECDSASigner{KEY_TYPE_SECP256K1, privateKey}, nil
+	default:
+		return nil, fmt.Errorf("unsupported curve %s", privateKey.Curve.Params().Name)
+	}
+}
+
+func curveOf(keyType KeyType) (elliptic.Curve, error) {
+	switch keyType {
+	case KEY_TYPE_P256:
+		return elliptic.P256(), nil
+	case KEY_TYPE_SECP256K1:
+		return secp256k1.S256(), nil
+	default:
+		return nil, fmt.Errorf("key type %q is not an ECDSA curve", keyType)
+	}
+}
+
+// ECDSASigner signs with a P-256 or secp256k1 private key,
+// signatures are encoded as r and s, 32 bytes each
+type ECDSASigner struct {
+	keyType    KeyType
+	privateKey *ecdsa.PrivateKey
+}
+
+func (signer *ECDSASigner) KeyType() KeyType {
+	return signer.keyType
+}
+
+func (signer *ECDSASigner) PrivateKey() *ecdsa.PrivateKey {
+	return signer.privateKey
+}
+
+func (signer *ECDSASigner) Verifier() Verifier {
+	return &ECDSAVerifier{signer.keyType, &signer.privateKey.PublicKey}
+}
+
+func (signer *ECDSASigner) String() string {
+	return fmt.Sprintf("%064x", signer.privateKey.D)
+}
+
+// Sign produces the deterministic, low-S signature of the hash
+func (signer *ECDSASigner) Sign(hash []byte) ([]byte, error) {
+	signature, err := SignDeterministic(signer.privateKey, hash)
+	if err != nil {
+		return nil, err
+	}
+
+	return signature.Bytes(), nil
+}
+
+// ECDSAVerifier verifies signatures of the ECDSASigner
+type ECDSAVerifier struct {
+	keyType   KeyType
+	publicKey *ecdsa.PublicKey
+}
+
+func (verifier *ECDSAVerifier) KeyType() KeyType {
+	return verifier.keyType
+}
+
+func (verifier *ECDSAVerifier) PublicKey() *ecdsa.PublicKey {
+	return verifier.publicKey
+}
+
+func (verifier *ECDSAVerifier) Bytes() []byte {
+	bytes := make([]byte, 64)
+	verifier.publicKey.X.FillBytes(bytes[:32])
+	verifier.publicKey.Y.FillBytes(bytes[32:])
+
+	return bytes
+}
+
+func (verifier *ECDSAVerifier) String() string {
+	return hex.EncodeToString(verifier.Bytes())
+}
+
+// Verify accepts only low-S signatures, so every message has
+// exactly one valid signature per key
+func (verifier *ECDSAVerifier) Verify(hash []byte, signature []byte) bool {
+	if len(signature) != 64 {
+		return false
+	}
+
+	r := new(big.Int).SetBytes(signature[:32])
+	s := new(big.Int).SetBytes(signature[32:])
+	if !IsLowS(verifier.publicKey.Curve, s) {
+		return false
+	}
+
+	return ecdsa.Verify(verifier.publicKey, hash, r, s)
+}
+
+// Ed25519Signer signs with an Ed25519 private key
+type Ed25519Signer struct {
+	privateKey ed25519.PrivateKey
+}
+
+func (signer *Ed25519Signer) KeyType() KeyType {
+	return KEY_TYPE_ED25519
+}
+
+func (signer *Ed25519Signer) Verifier() Verifier {
+	return &Ed25519Verifier{signer.privateKey.Public().(ed25519.PublicKey)}
+}
+
+func (signer *Ed25519Signer) String() string {
+	return hex.EncodeToString(signer.privateKey.Seed())
+}
+
+func (signer *Ed25519Signer) Sign(hash []byte) ([]byte, error) {
+	return ed25519.Sign(signer.privateKey, hash), nil
+}
+
+// Ed25519Verifier verifies signatures of the Ed25519Signer
+type Ed25519Verifier struct {
+	publicKey ed25519.PublicKey
+}
+
+func (verifier *Ed25519Verifier) KeyType() KeyType {
+	return KEY_TYPE_ED25519
+}
+
+func (verifier *Ed25519Verifier) Bytes() []byte {
+	return verifier.publicKey
+}
+
+func (verifier *Ed25519Verifier) String() string {
+	return hex.EncodeToString(verifier.publicKey)
+}
+
+func (verifier *Ed25519Verifier) Verify(hash []byte, signature []byte) bool {
+	return len(signature) == ed25519.SignatureSize && ed25519.Verify(verifier.publicKey, hash, signature)
+}
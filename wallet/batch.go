@@ -0,0 +1,122 @@
+package wallet
+
+import (
+	"crypto-blockchain/utils"
+	"encoding/csv"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+type BatchTransactionRequest struct {
+	SenderPublicKey  *string     `json:"senderPublicKey"`
+	SenderPrivateKey *string     `json:"senderPrivateKey"`
+	SenderAddress    *string     `json:"senderAddress"`
+	KeyType          *string     `json:"keyType"`
+	Payouts          []*TxOutput `json:"payouts"`
+	PayoutsCSV       *string     `json:"payoutsCsv"`
+	Fee              *float32    `json:"fee"`
+	LockHeight       *int        `json:"lockHeight"`
+	LockTime         *int64      `json:"lockTime"`
+}
+
+// NewBatchTransaction pays every payout from the sender's
+// balance under a single signature
+func NewBatchTransaction(signer utils.Signer, sender string, payouts []*TxOutput) *Transaction {
+	transaction := NewTransaction(signer, sender, "", 0)
+	transaction.outputs = payouts
+
+	return transaction
+}
+
+// Validate checks that the sender fields are not nil
+// and that payouts are given either as JSON or as CSV
+func (batchRequest *BatchTransactionRequest) Validate() bool {
+	if batchRequest.SenderPublicKey == nil ||
+		batchRequest.SenderPrivateKey == nil ||
+		batchRequest.SenderAddress == nil {
+		return false
+	}
+
+	return (len(batchRequest.Payouts) > 0) != (batchRequest.PayoutsCSV != nil)
+}
+
+// ParsePayouts returns the payouts of the request. CSV payouts are
+// "address,value" rows, optionally preceded by a header row
+func (batchRequest *BatchTransactionRequest) ParsePayouts() ([]*TxOutput, error) {
+	payouts := batchRequest.Payouts
+	if batchRequest.PayoutsCSV != nil {
+		var err error
+		if payouts, err = parsePayoutsCSV(*batchRequest.PayoutsCSV); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(payouts) == 0 {
+		return nil, errors.New("no payouts given")
+	}
+	for i, payout := range payouts {
+		if payout != nil && payout.Script != "" {
+			script, err := hex.DecodeString(payout.Script)
+			if err != nil {
+				return nil, fmt.Errorf("payout %d has an invalid script", i+1)
+			}
+
+			// The blockchain signs the lowercase hex and derives the
+			// address of a script output when it is omitted
+			payout.Script = hex.EncodeToString(script)
+			if payout.Address == "" {
+				payout.Address = utils.ScriptAddress(script)
+			}
+		}
+
+		if payout == nil || payout.Address == "" || payout.Value <= 0 {
+			return nil, fmt.Errorf("payout %d needs an address and a positive value", i+1)
+		}
+	}
+
+	return payouts, nil
+}
+
+func parsePayoutsCSV(str string) ([]*TxOutput, error) {
+	reader := csv.NewReader(strings.NewReader(str))
+	reader.FieldsPerRecord = 2
+	reader.TrimLeadingSpace = true
+
+	payouts := make([]*TxOutput, 0)
+	for row := 1; ; row++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if row == 1 && strings.EqualFold(record[0], "address") {
+			continue
+		}
+
+		value, err := strconv.ParseFloat(record[1], 32)
+		if err != nil {
+			return nil, fmt.Errorf("row %d: invalid value %q", row, record[1])
+		}
+
+		payouts = append(payouts, &TxOutput{Address: record[0], Value: float32(value)})
+	}
+
+	return payouts, nil
+}
+
+// Lock returns the optional locks of the request, zero when omitted
+func (batchRequest *BatchTransactionRequest) Lock() (int, int64) {
+	return lockFromRequest(batchRequest.LockHeight, batchRequest.LockTime)
+}
+
+// FeeOrZero returns the optional fee of the request, zero when omitted
+func (batchRequest *BatchTransactionRequest) FeeOrZero() float32 {
+	return feeFromRequest(batchRequest.Fee)
+}
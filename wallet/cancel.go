@@ -0,0 +1,32 @@
+package wallet
+
+import "crypto-blockchain/utils"
+
+type CancelTransactionRequest struct {
+	SenderPublicKey  *string `json:"senderPublicKey"`
+	SenderPrivateKey *string `json:"senderPrivateKey"`
+	SenderAddress    *string `json:"senderAddress"`
+	KeyType          *string `json:"keyType"`
+	TransactionId    *string `json:"transactionId"`
+}
+
+// NewCancelTransaction cancels the sender's pending Transaction with the
+// hex-encoded ID. It pays nothing and is not mined itself
+func NewCancelTransaction(signer utils.Signer, sender string, transactionId string) *Transaction {
+	transaction := NewTransaction(signer, sender, "", 0)
+	transaction.replaces = transactionId
+
+	return transaction
+}
+
+// Validate checks that all fields are not nil
+func (cancelRequest *CancelTransactionRequest) Validate() bool {
+	if cancelRequest.SenderPublicKey == nil ||
+		cancelRequest.SenderPrivateKey == nil ||
+		cancelRequest.SenderAddress == nil ||
+		cancelRequest.TransactionId == nil {
+		return false
+	}
+
+	return true
+}
@@ -0,0 +1,91 @@
+package wallet
+
+import (
+	"crypto-blockchain/utils"
+	"fmt"
+)
+
+// TxInput references an unspent output by its transaction ID and index
+type TxInput struct {
+	TransactionId string `json:"transactionId"`
+	Index         int    `json:"index"`
+}
+
+// TxOutput pays value to an address. An output with a hex-encoded
+// lock script can only be spent by satisfying that script
+type TxOutput struct {
+	Address string  `json:"address"`
+	Value   float32 `json:"value"`
+	Script  string  `json:"script,omitempty"`
+}
+
+// UTXO is an unspent output as listed by the blockchain server
+type UTXO struct {
+	TransactionId string  `json:"transactionId"`
+	Index         int     `json:"index"`
+	Address       string  `json:"address"`
+	Value         float32 `json:"value"`
+}
+
+// NewUTXOTransaction picks unspent outputs of the sender until they cover
+// the value and the fee, pays the value to the recipient and sends what
+// is left back to the sender as a change output
+func NewUTXOTransaction(
+	signer utils.Signer,
+	sender string,
+	recipient string,
+	value float32,
+	fee float32,
+	utxos []*UTXO,
+) (*Transaction, error) {
+	return NewUTXOBatchTransaction(signer, sender, []*TxOutput{{Address: recipient, Value: value}}, fee, utxos)
+}
+
+// NewUTXOBatchTransaction works like NewUTXOTransaction,
+// paying every payout from the same set of inputs
+func NewUTXOBatchTransaction(
+	signer utils.Signer,
+	sender string,
+	payouts []*TxOutput,
+	fee float32,
+	utxos []*UTXO,
+) (*Transaction, error) {
+	transaction := NewTransaction(signer, sender, "", 0)
+	transaction.fee = fee
+
+	value := fee
+	for _, payout := range payouts {
+		value += payout.Value
+	}
+
+	var total float32
+	for _, utxo := range utxos {
+		if total >= value {
+			break
+		}
+
+		transaction.inputs = append(transaction.inputs, &TxInput{utxo.TransactionId, utxo.Index})
+		total += utxo.Value
+	}
+
+	if total < value {
+		return nil, fmt.Errorf("insufficient funds: have %.8f, need %.8f", total, value)
+	}
+
+	transaction.outputs = append(transaction.outputs, payouts...)
+	if change := total - value; change > 0 {
+		transaction.outputs = append(transaction.outputs, &TxOutput{Address: sender, Value: change})
+	}
+
+	return transaction, nil
+}
+
+// Inputs returns the outputs spent by the Transaction
+func (transaction *Transaction) Inputs() []*TxInput {
+	return transaction.inputs
+}
+
+// Outputs returns the outputs created by the Transaction
+func (transaction *Transaction) Outputs() []*TxOutput {
+	return transaction.outputs
+}
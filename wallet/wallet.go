@@ -8,103 +8,161 @@ import (
 	"crypto/sha256"
 	"encoding/json"
 	"fmt"
-	"github.com/btcsuite/btcutil/base58"
-	"golang.org/x/crypto/ripemd160"
 )
 
 type Wallet struct {
-	privateKey *ecdsa.PrivateKey
-	publicKey  *ecdsa.PublicKey
-	address    string
+	signer  utils.Signer
+	address string
 }
 
 type Transaction struct {
-	senderPublicKey  *ecdsa.PublicKey
-	senderPrivateKey *ecdsa.PrivateKey
+	signer           utils.Signer
 	senderAddress    string
 	recipientAddress string
 	value            float32
+	fee              float32
+	inputs           []*TxInput
+	outputs          []*TxOutput
+	lockHeight       int
+	lockTime         int64
+	replaces         string
+	chainId          string
 }
 
 type TransactionRequest struct {
-	SenderPublicKey  *string `json:"senderPublicKey"`
-	SenderPrivateKey *string `json:"senderPrivateKey"`
-	SenderAddress    *string `json:"senderAddress"`
-	RecipientAddress *string `json:"recipientAddress"`
-	Value            *string `json:"value"`
+	SenderPublicKey  *string  `json:"senderPublicKey"`
+	SenderPrivateKey *string  `json:"senderPrivateKey"`
+	SenderAddress    *string  `json:"senderAddress"`
+	RecipientAddress *string  `json:"recipientAddress"`
+	Value            *string  `json:"value"`
+	Fee              *float32 `json:"fee"`
+	KeyType          *string  `json:"keyType"`
+	LockHeight       *int     `json:"lockHeight"`
+	LockTime         *int64   `json:"lockTime"`
+	Replaces         *string  `json:"replaces"`
 }
 
 func NewWallet() *Wallet {
-	wallet := new(Wallet)
-
 	// Creating ECDSA private and public keys
 	privateKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
-	wallet.privateKey = privateKey
-	wallet.publicKey = &wallet.privateKey.PublicKey
-
-	// Perform SHA-256 hashing on the public key
-	sha256Hash := sha256.New()
-	sha256Hash.Write(wallet.publicKey.X.Bytes())
-	sha256Hash.Write(wallet.publicKey.Y.Bytes())
-	sha256Digest := sha256Hash.Sum(nil)
-
-	// Perform RIPEMD-160 hashing on the result of sha256Hash
-	ripemd160Hash := ripemd160.New()
-	ripemd160Hash.Write(sha256Digest)
-	ripemd160Digest := ripemd160Hash.Sum(nil)
-
-	// Add version byte in front of ripemd160Hash (0x00 for Main Network)
-	version := make([]byte, 21)
-	version[0] = 0x00
-	copy(version[1:], ripemd160Digest[:])
-
-	// Perform SHA-256 hash on the extended result
-	sha256Hash = sha256.New()
-	sha256Hash.Write(version)
-	sha256Digest = sha256Hash.Sum(nil)
-
-	// One more SHA-256 hash :D
-	sha256Hash = sha256.New()
-	sha256Hash.Write(sha256Digest)
-	sha256Digest = sha256Hash.Sum(nil)
-
-	// Take the first 4 bytes of the summary SHA-256 hash for checksum
-	checksum := sha256Digest[:4]
-
-	// Add the 4 bytes from the checksum at the end of RIPEMD-160 hash
-	result := make([]byte, 25)
-	copy(result[:21], version[:])
-	copy(result[21:], checksum[:])
-
-	// Convert the result from a byte string into base58
-	address := base58.Encode(result)
-	wallet.address = address
+
+	return NewWalletFromPrivateKey(privateKey)
+}
+
+// NewWalletWithKeyType creates a Wallet with a new random key
+// of the given signature scheme
+func NewWalletWithKeyType(keyType utils.KeyType) (*Wallet, error) {
+	signer, err := utils.GenerateSigner(keyType)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewWalletFromSigner(signer), nil
+}
+
+// NewWalletFromPrivateKey restores the Wallet and its address
+// from an existing P-256 private key
+func NewWalletFromPrivateKey(privateKey *ecdsa.PrivateKey) *Wallet {
+	signer, _ := utils.NewECDSASigner(privateKey)
+
+	return NewWalletFromSigner(signer)
+}
+
+// NewWalletFromSigner restores the Wallet and its address
+// from a key of any supported signature scheme
+func NewWalletFromSigner(signer utils.Signer) *Wallet {
+	wallet := new(Wallet)
+	wallet.signer = signer
+
+	wallet.address = utils.AddressFromPublicKey(signer.Verifier())
 
 	return wallet
 }
 
 func NewTransaction(
-	privateKey *ecdsa.PrivateKey,
-	publicKey *ecdsa.PublicKey,
+	signer utils.Signer,
 	sender string,
 	recipient string,
 	value float32,
 ) *Transaction {
 	return &Transaction{
-		senderPrivateKey: privateKey,
-		senderPublicKey:  publicKey,
+		signer:           signer,
 		senderAddress:    sender,
 		recipientAddress: recipient,
 		value:            value,
 	}
 }
 
-func (transaction *Transaction) GenerateSignature() *utils.Signature {
+// GenerateSignature signs the SHA-256 hash of the Transaction
+// with the sender's key. Signatures are deterministic: signing
+// the same Transaction twice gives the same bytes
+func (transaction *Transaction) GenerateSignature() ([]byte, error) {
 	marshal, _ := json.Marshal(transaction)
 	hash := sha256.Sum256(marshal)
-	r, s, _ := ecdsa.Sign(rand.Reader, transaction.senderPrivateKey, hash[:])
 
-	return &utils.Signature{r, s}
+	return transaction.signer.Sign(hash[:])
+}
+
+func (transaction *Transaction) SenderAddress() string {
+	return transaction.senderAddress
+}
+
+func (transaction *Transaction) RecipientAddress() string {
+	return transaction.recipientAddress
+}
+
+func (transaction *Transaction) Value() float32 {
+	return transaction.value
+}
+
+// SetFee sets the fee the Transaction pays to the miner
+func (transaction *Transaction) SetFee(fee float32) {
+	transaction.fee = fee
+}
+
+func (transaction *Transaction) Fee() float32 {
+	return transaction.fee
+}
+
+// SetReplaces makes the Transaction supersede the pending
+// Transaction with the hex-encoded ID, sent from the same key
+func (transaction *Transaction) SetReplaces(transactionId string) {
+	transaction.replaces = transactionId
+}
+
+func (transaction *Transaction) Replaces() string {
+	return transaction.replaces
+}
+
+// SetChainId binds the Transaction to the network with the ID,
+// so its signature is rejected on any other network
+func (transaction *Transaction) SetChainId(chainId string) {
+	transaction.chainId = chainId
+}
+
+func (transaction *Transaction) ChainId() string {
+	return transaction.chainId
+}
+
+// SetLock makes the Transaction valid only from the block height
+// and the unix time on, zero leaves the lock out. Locks are covered
+// by the signature, so they have to be set before signing
+func (transaction *Transaction) SetLock(lockHeight int, lockTime int64) {
+	transaction.lockHeight = lockHeight
+	transaction.lockTime = lockTime
+}
+
+func (transaction *Transaction) LockHeight() int {
+	return transaction.lockHeight
+}
+
+func (transaction *Transaction) LockTime() int64 {
+	return transaction.lockTime
+}
+
+// Signer returns the key the Transaction is signed with
+func (transaction *Transaction) Signer() utils.Signer {
+	return transaction.signer
 }
 
 // Validate checks that all fields are not nil
@@ -120,20 +178,75 @@ func (transactionRequest *TransactionRequest) Validate() bool {
 	return true
 }
 
+// Signer returns the key the Wallet signs transactions with
+func (wallet *Wallet) Signer() utils.Signer {
+	return wallet.signer
+}
+
+func (wallet *Wallet) KeyType() utils.KeyType {
+	return wallet.signer.KeyType()
+}
+
+// PrivateKey returns the ECDSA private key,
+// or nil when the Wallet uses another signature scheme
 func (wallet *Wallet) PrivateKey() *ecdsa.PrivateKey {
-	return wallet.privateKey
+	if signer, ok := wallet.signer.(*utils.ECDSASigner); ok {
+		return signer.PrivateKey()
+	}
+
+	return nil
 }
 
+// PrivateKeyStr returns the private key as 32 zero-padded bytes in hex,
+// so it always round-trips through utils.SignerFromString
 func (wallet *Wallet) PrivateKeyStr() string {
-	return fmt.Sprintf("%x", wallet.privateKey.D.Bytes())
+	return wallet.signer.String()
 }
 
+// PrivateKeyWIF returns the private key in Wallet Import Format,
+// which is only defined for P-256 keys
+func (wallet *Wallet) PrivateKeyWIF() string {
+	if wallet.KeyType() != utils.KEY_TYPE_P256 {
+		return ""
+	}
+
+	return utils.PrivateKeyToWIF(wallet.PrivateKey())
+}
+
+// PrivateKeyPEM returns the private key as a PKCS#8 PEM block,
+// which exists for P-256 and Ed25519 keys
+func (wallet *Wallet) PrivateKeyPEM() (string, error) {
+	return utils.SignerToPEM(wallet.signer)
+}
+
+// PublicKey returns the ECDSA public key,
+// or nil when the Wallet uses another signature scheme
 func (wallet *Wallet) PublicKey() *ecdsa.PublicKey {
-	return wallet.publicKey
+	if privateKey := wallet.PrivateKey(); privateKey != nil {
+		return &privateKey.PublicKey
+	}
+
+	return nil
 }
 
 func (wallet *Wallet) PublicKeyStr() string {
-	return fmt.Sprintf("%064x%064x", wallet.publicKey.X.Bytes(), wallet.publicKey.Y.Bytes())
+	return wallet.signer.Verifier().String()
+}
+
+// PublicKeyCompressedStr returns the 33-byte compressed public key in hex,
+// or an empty string for non-ECDSA keys
+func (wallet *Wallet) PublicKeyCompressedStr() string {
+	if wallet.PublicKey() == nil {
+		return ""
+	}
+
+	return fmt.Sprintf("%x", utils.CompressPublicKey(wallet.PublicKey()))
+}
+
+// PublicKeyPEM returns the public key as a PKIX PEM block,
+// which exists for P-256 and Ed25519 keys
+func (wallet *Wallet) PublicKeyPEM() (string, error) {
+	return utils.VerifierToPEM(wallet.signer.Verifier())
 }
 
 func (wallet *Wallet) Address() string {
@@ -142,24 +255,77 @@ func (wallet *Wallet) Address() string {
 
 func (transaction *Transaction) MarshalJSON() ([]byte, error) {
 	return json.Marshal(struct {
-		Sender    string  `json:"senderAddress"`
-		Recipient string  `json:"recipientAddress"`
-		Value     float32 `json:"value"`
+		Sender     string      `json:"senderAddress"`
+		Recipient  string      `json:"recipientAddress"`
+		Value      float32     `json:"value"`
+		Fee        float32     `json:"fee,omitempty"`
+		Inputs     []*TxInput  `json:"inputs,omitempty"`
+		Outputs    []*TxOutput `json:"outputs,omitempty"`
+		LockHeight int         `json:"lockHeight,omitempty"`
+		LockTime   int64       `json:"lockTime,omitempty"`
+		Replaces   string      `json:"replaces,omitempty"`
+		ChainId    string      `json:"chainId,omitempty"`
 	}{
-		Sender:    transaction.senderAddress,
-		Recipient: transaction.recipientAddress,
-		Value:     transaction.value,
+		Sender:     transaction.senderAddress,
+		Recipient:  transaction.recipientAddress,
+		Value:      transaction.value,
+		Fee:        transaction.fee,
+		Inputs:     transaction.inputs,
+		Outputs:    transaction.outputs,
+		LockHeight: transaction.lockHeight,
+		LockTime:   transaction.lockTime,
+		Replaces:   transaction.replaces,
+		ChainId:    transaction.chainId,
 	})
 }
 
 func (wallet *Wallet) MarshalJSON() ([]byte, error) {
 	return json.Marshal(struct {
-		PrivateKey string `json:"privateKey"`
-		PublicKey  string `json:"publicKey"`
-		Address    string `json:"address"`
+		KeyType             utils.KeyType `json:"keyType"`
+		PrivateKey          string        `json:"privateKey"`
+		PrivateKeyWIF       string        `json:"privateKeyWif,omitempty"`
+		PublicKey           string        `json:"publicKey"`
+		PublicKeyCompressed string        `json:"publicKeyCompressed,omitempty"`
+		Address             string        `json:"address"`
 	}{
-		PrivateKey: wallet.PrivateKeyStr(),
-		PublicKey:  wallet.PublicKeyStr(),
-		Address:    wallet.Address(),
+		KeyType:             wallet.KeyType(),
+		PrivateKey:          wallet.PrivateKeyStr(),
+		PrivateKeyWIF:       wallet.PrivateKeyWIF(),
+		PublicKey:           wallet.PublicKeyStr(),
+		PublicKeyCompressed: wallet.PublicKeyCompressedStr(),
+		Address:             wallet.Address(),
 	})
 }
+
+// lockFromRequest returns the optional locks of a request, zero when omitted
+func lockFromRequest(lockHeight *int, lockTime *int64) (int, int64) {
+	var height int
+	var time int64
+	if lockHeight != nil {
+		height = *lockHeight
+	}
+	if lockTime != nil {
+		time = *lockTime
+	}
+
+	return height, time
+}
+
+// Lock returns the optional locks of the request, zero when omitted
+func (transactionRequest *TransactionRequest) Lock() (int, int64) {
+	return lockFromRequest(transactionRequest.LockHeight, transactionRequest.LockTime)
+}
+
+// feeFromRequest returns the optional fee of a request, zero when omitted
+func feeFromRequest(fee *float32) float32 {
+	if fee == nil {
+		return 0
+	}
+
+	return *fee
+}
+
+// FeeOrZero returns the optional fee of the request, zero when omitted
+func (transactionRequest *TransactionRequest) FeeOrZero() float32 {
+	return feeFromRequest(transactionRequest.Fee)
+}
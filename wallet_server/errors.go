@@ -0,0 +1,45 @@
+package main
+
+import (
+	"crypto-blockchain/block"
+	"crypto-blockchain/client"
+	"encoding/json"
+	"errors"
+	"net/http"
+)
+
+// writeError answers with the ErrorResponse of the error. Errors
+// without an ErrorCode of their own are reported with the code
+func writeError(writer http.ResponseWriter, code block.ErrorCode, err error) {
+	err = block.WrapError(code, err)
+	marshal, _ := json.Marshal(block.NewErrorResponse(err))
+
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(block.ErrorCodeOf(err).StatusCode())
+	writer.Write(marshal)
+}
+
+// writeErrorMessage answers with an ErrorResponse of the code and message
+func writeErrorMessage(writer http.ResponseWriter, code block.ErrorCode, message string) {
+	writeError(writer, code, block.NewError(code, message))
+}
+
+func writeMethodNotAllowed(writer http.ResponseWriter) {
+	writeErrorMessage(writer, block.ERROR_METHOD_NOT_ALLOWED, "405 - Method not allowed")
+}
+
+// writeGatewayError passes an ErrorResponse of the blockchain server on
+// with its status code, so clients see why the node refused the request.
+// Failing to reach the node at all is a gateway error
+func writeGatewayError(writer http.ResponseWriter, err error) {
+	var gatewayErr *client.Error
+	if !errors.As(err, &gatewayErr) {
+		writeError(writer, block.ERROR_GATEWAY, err)
+		return
+	}
+
+	marshal, _ := json.Marshal(&block.ErrorResponse{Error: gatewayErr.Body})
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(gatewayErr.StatusCode)
+	writer.Write(marshal)
+}
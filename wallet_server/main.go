@@ -1,6 +1,8 @@
 package main
 
 import (
+	"crypto-blockchain/block"
+	"crypto-blockchain/utils"
 	"flag"
 	"log"
 )
@@ -12,8 +14,26 @@ func init() {
 func main() {
 	port := flag.Uint("port", 9657, "TCP Port Number For Wallet Server")
 	gateway := flag.String("gateway", "http://127.0.0.1:5655", "Blockhain Gateway")
+	ledger := flag.String("ledger", string(block.LEDGER_MODE_ACCOUNT), "Ledger Mode Of The Gateway: account or utxo")
+	chainId := flag.String("chain-id", "", "ID Of The Gateway's Network, Defaults To devnet Or To regtest With -regtest")
+	regtest := flag.Bool("regtest", false, "Use Regtest Addresses Of A Gateway Started With -regtest")
 	flag.Parse()
 
-	app := NewWalletServer(uint16(*port), *gateway)
+	if *regtest {
+		utils.UseNetwork(utils.REGTEST_NETWORK)
+	}
+	if *chainId == "" {
+		*chainId = block.DEFAULT_CHAIN_ID
+		if *regtest {
+			*chainId = block.REGTEST_CHAIN_ID
+		}
+	}
+
+	ledgerMode, err := block.ParseLedgerMode(*ledger)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	app := NewWalletServer(uint16(*port), *gateway, ledgerMode, *chainId)
 	app.Run()
 }
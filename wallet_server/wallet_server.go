@@ -1,12 +1,12 @@
 package main
 
 import (
-	"bytes"
 	"crypto-blockchain/block"
+	"crypto-blockchain/client"
 	"crypto-blockchain/utils"
 	"crypto-blockchain/wallet"
+	"encoding/hex"
 	"encoding/json"
-	"fmt"
 	"io"
 	"log"
 	"net/http"
@@ -18,12 +18,16 @@ import (
 const tmplDir = "/Users/mac/Desktop/Work/blockchain/wallet_server/templates/"
 
 type WalletServer struct {
-	port    uint16
-	gateway string
+	port       uint16
+	client     *client.Client
+	ledgerMode block.LedgerMode
+	chainId    string
 }
 
-func NewWalletServer(port uint16, gateway string) *WalletServer {
-	return &WalletServer{port, gateway}
+// NewWalletServer generates and returns new WalletServer
+// talking to the blockchain server at the gateway
+func NewWalletServer(port uint16, gateway string, ledgerMode block.LedgerMode, chainId string) *WalletServer {
+	return &WalletServer{port, client.NewClient(gateway), ledgerMode, chainId}
 }
 
 func (walletServer *WalletServer) Index(writer http.ResponseWriter, req *http.Request) {
@@ -32,8 +36,7 @@ func (walletServer *WalletServer) Index(writer http.ResponseWriter, req *http.Re
 		tmpl, _ := template.ParseFiles(path.Join(tmplDir + "index.html"))
 		tmpl.Execute(writer, "")
 	default:
-		writer.WriteHeader(http.StatusMethodNotAllowed)
-		writer.Write([]byte("405 - Method not allowed"))
+		writeMethodNotAllowed(writer)
 	}
 }
 
@@ -42,121 +45,355 @@ func (walletServer *WalletServer) Port() uint16 {
 }
 
 func (walletServer *WalletServer) Gateway() string {
-	return walletServer.gateway
+	return walletServer.client.Gateway()
 }
 
 func (walletServer *WalletServer) Wallet(writer http.ResponseWriter, req *http.Request) {
 	switch req.Method {
 	case http.MethodPost:
+		keyType, err := utils.ParseKeyType(req.URL.Query().Get("keyType"))
+		if err != nil {
+			writeError(writer, block.ERROR_MALFORMED_KEY, err)
+			return
+		}
+
+		newWallet, err := wallet.NewWalletWithKeyType(keyType)
+		if err != nil {
+			writeError(writer, block.ERROR_INTERNAL, err)
+			return
+		}
+
 		writer.Header().Add("Content-Type", "application/json")
-		newWallet := wallet.NewWallet()
 
 		marshal, _ := newWallet.MarshalJSON()
 		io.WriteString(writer, string(marshal[:]))
 	default:
-		writer.WriteHeader(http.StatusMethodNotAllowed)
+		writeMethodNotAllowed(writer)
 	}
 }
 
-func (walletServer *WalletServer) CreateTransaction(writer http.ResponseWriter, req *http.Request) {
+// MultisigAddress derives the address controlled by the posted
+// threshold and key set. Signatures in the request are ignored
+func (walletServer *WalletServer) MultisigAddress(writer http.ResponseWriter, req *http.Request) {
 	switch req.Method {
 	case http.MethodPost:
+		decoder := json.NewDecoder(req.Body)
+		var multisigRequest block.MultisigRequest
+		if err := decoder.Decode(&multisigRequest); err != nil {
+			writeError(writer, block.ERROR_INVALID_REQUEST, err)
+			return
+		}
+		if !multisigRequest.Validate() {
+			writeErrorMessage(writer, block.ERROR_INVALID_REQUEST, "threshold and signers are required")
+			return
+		}
+
+		multisig, err := multisigRequest.Multisig()
+		if err != nil {
+			writeError(writer, block.ERROR_INVALID_REQUEST, err)
+			return
+		}
+
+		address, err := multisig.Address()
+		if err != nil {
+			writeError(writer, block.ERROR_INVALID_REQUEST, err)
+			return
+		}
+
+		marshal, _ := json.Marshal(struct {
+			Threshold int    `json:"threshold"`
+			Address   string `json:"address"`
+		}{
+			Threshold: *multisigRequest.Threshold,
+			Address:   address,
+		})
+
 		writer.Header().Add("Content-Type", "application/json")
+		io.WriteString(writer, string(marshal[:]))
+	default:
+		writeMethodNotAllowed(writer)
+	}
+}
 
+func (walletServer *WalletServer) CreateTransaction(writer http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodPost:
 		decoder := json.NewDecoder(req.Body)
 		var transactionRequest wallet.TransactionRequest
-		err := decoder.Decode(&transactionRequest)
 
-		if err != nil {
-			writer.WriteHeader(http.StatusBadRequest)
+		if err := decoder.Decode(&transactionRequest); err != nil {
+			writeError(writer, block.ERROR_INVALID_REQUEST, err)
 			return
 		}
 		if !transactionRequest.Validate() {
-			writer.WriteHeader(http.StatusBadRequest)
+			writeErrorMessage(writer, block.ERROR_INVALID_REQUEST, "transaction request is missing required fields")
 			return
 		}
 
-		publicKey := utils.PublicKeyFromString(*transactionRequest.SenderPublicKey)
-		privateKey := utils.PrivateKeyFromString(*transactionRequest.SenderPrivateKey, publicKey)
+		signer, err := signerFromRequest(transactionRequest.KeyType, *transactionRequest.SenderPrivateKey)
+		if err != nil {
+			writeError(writer, block.ERROR_MALFORMED_KEY, err)
+			return
+		}
 
 		value, err := strconv.ParseFloat(*transactionRequest.Value, 32)
 		if err != nil {
-			writer.WriteHeader(http.StatusBadRequest)
+			writeError(writer, block.ERROR_INVALID_REQUEST, err)
+			return
 		}
 		value32 := float32(value)
 
-		transaction := wallet.NewTransaction(privateKey,
-			publicKey,
-			*transactionRequest.SenderAddress,
-			*transactionRequest.RecipientAddress,
-			value32)
-		signature := transaction.GenerateSignature()
-		signatureStr := signature.String()
-
-		bcTransactionRequest := &block.TransactionRequest{
-			transactionRequest.SenderAddress,
-			transactionRequest.RecipientAddress,
-			transactionRequest.SenderPublicKey,
-			&value32,
-			&signatureStr,
-		}
-		marshal, _ := json.Marshal(bcTransactionRequest)
-		buff := bytes.NewBuffer(marshal)
-
-		resp, _ := http.Post(walletServer.Gateway()+"/transactions", "application/json", buff)
-		writer.WriteHeader(resp.StatusCode)
+		var transaction *wallet.Transaction
+		if walletServer.ledgerMode == block.LEDGER_MODE_UTXO {
+			utxos, err := walletServer.client.UTXOs(*transactionRequest.SenderAddress)
+			if err != nil {
+				writeGatewayError(writer, err)
+				return
+			}
+
+			transaction, err = wallet.NewUTXOTransaction(signer,
+				*transactionRequest.SenderAddress,
+				*transactionRequest.RecipientAddress,
+				value32,
+				transactionRequest.FeeOrZero(),
+				utxos)
+			if err != nil {
+				writeError(writer, block.ERROR_INSUFFICIENT_FUNDS, err)
+				return
+			}
+		} else {
+			transaction = wallet.NewTransaction(signer,
+				*transactionRequest.SenderAddress,
+				*transactionRequest.RecipientAddress,
+				value32)
+			transaction.SetFee(transactionRequest.FeeOrZero())
+		}
+
+		transaction.SetLock(transactionRequest.Lock())
+		if transactionRequest.Replaces != nil {
+			transaction.SetReplaces(*transactionRequest.Replaces)
+		}
+
+		id, err := walletServer.submitTransaction(transaction)
+		if err != nil {
+			writeGatewayError(writer, err)
+			return
+		}
+		writeTransactionId(writer, id)
 	default:
-		writer.WriteHeader(http.StatusMethodNotAllowed)
+		writeMethodNotAllowed(writer)
 	}
 }
 
-func (server *WalletServer) GetBalance(writer http.ResponseWriter, req *http.Request) {
+// CreateBatchTransaction pays a list of payouts, posted as JSON
+// or as CSV, with a single signed transaction
+func (walletServer *WalletServer) CreateBatchTransaction(writer http.ResponseWriter, req *http.Request) {
 	switch req.Method {
-	case http.MethodGet:
-		address := req.URL.Query().Get("address")
-		if address == "" {
-			writer.WriteHeader(http.StatusBadRequest)
-		}
+	case http.MethodPost:
+		decoder := json.NewDecoder(req.Body)
+		var batchRequest wallet.BatchTransactionRequest
 
-		endpoint := fmt.Sprintf("%s/amount", server.Gateway())
+		if err := decoder.Decode(&batchRequest); err != nil {
+			writeError(writer, block.ERROR_INVALID_REQUEST, err)
+			return
+		}
+		if !batchRequest.Validate() {
+			writeErrorMessage(writer, block.ERROR_INVALID_REQUEST, "batch request is missing required fields")
+			return
+		}
 
-		client := &http.Client{}
-		blockchainServerRequest, _ := http.NewRequest("GET", endpoint, nil)
-		query := blockchainServerRequest.URL.Query()
-		query.Add("address", address)
-		blockchainServerRequest.URL.RawQuery = query.Encode()
+		payouts, err := batchRequest.ParsePayouts()
+		if err != nil {
+			writeError(writer, block.ERROR_INVALID_REQUEST, err)
+			return
+		}
 
-		blockchainServerResponse, err := client.Do(blockchainServerRequest)
+		signer, err := signerFromRequest(batchRequest.KeyType, *batchRequest.SenderPrivateKey)
 		if err != nil {
-			writer.WriteHeader(http.StatusInternalServerError)
+			writeError(writer, block.ERROR_MALFORMED_KEY, err)
 			return
 		}
 
-		writer.Header().Add("Content-Type", "application/json")
-		if blockchainServerResponse.StatusCode == http.StatusOK {
-			decoder := json.NewDecoder(blockchainServerResponse.Body)
+		var transaction *wallet.Transaction
+		if walletServer.ledgerMode == block.LEDGER_MODE_UTXO {
+			utxos, err := walletServer.client.UTXOs(*batchRequest.SenderAddress)
+			if err != nil {
+				writeGatewayError(writer, err)
+				return
+			}
 
-			var bar block.AmountResponse
-			err := decoder.Decode(&bar)
+			transaction, err = wallet.NewUTXOBatchTransaction(signer,
+				*batchRequest.SenderAddress,
+				payouts,
+				batchRequest.FeeOrZero(),
+				utxos)
 			if err != nil {
-				writer.WriteHeader(http.StatusInternalServerError)
+				writeError(writer, block.ERROR_INSUFFICIENT_FUNDS, err)
 				return
 			}
+		} else {
+			transaction = wallet.NewBatchTransaction(signer, *batchRequest.SenderAddress, payouts)
+			transaction.SetFee(batchRequest.FeeOrZero())
+		}
 
-			marshal, _ := json.Marshal(struct {
-				Message string  `json:"message"`
-				Amount  float32 `json:"amount"`
-			}{
-				Message: "success",
-				Amount:  bar.Amount,
-			})
+		transaction.SetLock(batchRequest.Lock())
 
-			io.WriteString(writer, string(marshal[:]))
-		} else {
-			writer.WriteHeader(http.StatusBadRequest)
+		id, err := walletServer.submitTransaction(transaction)
+		if err != nil {
+			writeGatewayError(writer, err)
+			return
+		}
+		writeTransactionId(writer, id)
+	default:
+		writeMethodNotAllowed(writer)
+	}
+}
+
+// signerFromRequest decodes the sender's private key,
+// keyType may be nil for the default signature scheme
+func signerFromRequest(keyType *string, privateKey string) (utils.Signer, error) {
+	parsedKeyType := utils.DEFAULT_KEY_TYPE
+	if keyType != nil {
+		var err error
+		if parsedKeyType, err = utils.ParseKeyType(*keyType); err != nil {
+			return nil, err
 		}
+	}
+
+	return utils.SignerFromString(parsedKeyType, privateKey)
+}
+
+// CancelTransaction cancels a pending transaction of the sender
+func (walletServer *WalletServer) CancelTransaction(writer http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodPost:
+		decoder := json.NewDecoder(req.Body)
+		var cancelRequest wallet.CancelTransactionRequest
+
+		if err := decoder.Decode(&cancelRequest); err != nil {
+			writeError(writer, block.ERROR_INVALID_REQUEST, err)
+			return
+		}
+		if !cancelRequest.Validate() {
+			writeErrorMessage(writer, block.ERROR_INVALID_REQUEST, "cancel request is missing required fields")
+			return
+		}
+
+		signer, err := signerFromRequest(cancelRequest.KeyType, *cancelRequest.SenderPrivateKey)
+		if err != nil {
+			writeError(writer, block.ERROR_MALFORMED_KEY, err)
+			return
+		}
+
+		transaction := wallet.NewCancelTransaction(signer, *cancelRequest.SenderAddress, *cancelRequest.TransactionId)
+
+		id, err := walletServer.submitTransaction(transaction)
+		if err != nil {
+			writeGatewayError(writer, err)
+			return
+		}
+		writeTransactionId(writer, id)
+	default:
+		writeMethodNotAllowed(writer)
+	}
+}
+
+// submitTransaction signs the Transaction for the gateway's
+// network and posts it to the blockchain server
+func (walletServer *WalletServer) submitTransaction(transaction *wallet.Transaction) (string, error) {
+	transaction.SetChainId(walletServer.chainId)
+	signature, err := transaction.GenerateSignature()
+	if err != nil {
+		return "", err
+	}
+
+	senderAddress := transaction.SenderAddress()
+	publicKeyStr := transaction.Signer().Verifier().String()
+	keyTypeStr := string(transaction.Signer().KeyType())
+	signatureStr := hex.EncodeToString(signature)
+
+	bcTransactionRequest := &block.TransactionRequest{
+		SenderAddress:   &senderAddress,
+		SenderPublicKey: &publicKeyStr,
+		Signature:       &signatureStr,
+		KeyType:         &keyTypeStr,
+	}
+	if fee := transaction.Fee(); fee != 0 {
+		bcTransactionRequest.Fee = &fee
+	}
+	if replaces := transaction.Replaces(); replaces != "" {
+		bcTransactionRequest.Replaces = &replaces
+	}
+	if chainId := transaction.ChainId(); chainId != "" {
+		bcTransactionRequest.ChainId = &chainId
+	}
+	if lockHeight := transaction.LockHeight(); lockHeight != 0 {
+		bcTransactionRequest.LockHeight = &lockHeight
+	}
+	if lockTime := transaction.LockTime(); lockTime != 0 {
+		bcTransactionRequest.LockTime = &lockTime
+	}
+	if recipientAddress, value := transaction.RecipientAddress(), transaction.Value(); recipientAddress != "" {
+		bcTransactionRequest.RecipientAddress = &recipientAddress
+		bcTransactionRequest.Value = &value
+	}
+	for _, input := range transaction.Inputs() {
+		input := input
+		bcTransactionRequest.Inputs = append(bcTransactionRequest.Inputs,
+			&block.TxInputRequest{TransactionId: &input.TransactionId, Index: &input.Index})
+	}
+	for _, output := range transaction.Outputs() {
+		output := output
+		outputRequest := &block.TxOutputRequest{Address: &output.Address, Value: &output.Value}
+		if output.Script != "" {
+			outputRequest.Script = &output.Script
+		}
+		bcTransactionRequest.Outputs = append(bcTransactionRequest.Outputs, outputRequest)
+	}
+
+	return walletServer.client.SubmitTransaction(bcTransactionRequest)
+}
+
+// writeTransactionId answers with the ID of the submitted transaction
+func writeTransactionId(writer http.ResponseWriter, id string) {
+	marshal, _ := json.Marshal(struct {
+		Id string `json:"id"`
+	}{
+		Id: id,
+	})
+
+	writer.Header().Add("Content-Type", "application/json")
+	writer.WriteHeader(http.StatusCreated)
+	io.WriteString(writer, string(marshal[:]))
+}
+
+func (server *WalletServer) GetBalance(writer http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet:
+		address := req.URL.Query().Get("address")
+		if address == "" {
+			writeErrorMessage(writer, block.ERROR_INVALID_REQUEST, "address is required")
+			return
+		}
+
+		amount, err := server.client.Amount(address)
+		if err != nil {
+			writeGatewayError(writer, err)
+			return
+		}
+
+		marshal, _ := json.Marshal(struct {
+			Message string  `json:"message"`
+			Amount  float32 `json:"amount"`
+		}{
+			Message: "success",
+			Amount:  amount,
+		})
+
+		writer.Header().Add("Content-Type", "application/json")
+		io.WriteString(writer, string(marshal[:]))
 	default:
-		writer.WriteHeader(http.StatusMethodNotAllowed)
+		writeMethodNotAllowed(writer)
 	}
 }
 
@@ -164,6 +401,9 @@ func (walletServer *WalletServer) Run() {
 	http.HandleFunc("/", walletServer.Index)
 	http.HandleFunc("/wallet", walletServer.Wallet)
 	http.HandleFunc("/wallet/balance", walletServer.GetBalance)
+	http.HandleFunc("/wallet/multisig", walletServer.MultisigAddress)
 	http.HandleFunc("/transaction", walletServer.CreateTransaction)
+	http.HandleFunc("/transaction/batch", walletServer.CreateBatchTransaction)
+	http.HandleFunc("/transaction/cancel", walletServer.CancelTransaction)
 	log.Fatal(http.ListenAndServe("127.0.0.1:"+strconv.Itoa(int(walletServer.Port())), nil))
 }